@@ -0,0 +1,202 @@
+// Command walchaos runs a write workload against a WAL and repeatedly kills
+// it, fills its disk quota, tears its writes and skips its clock, checking
+// after every crash
+// that the log recovers with its invariants intact. Run it on the hardware
+// and filesystem a deployment will use to qualify them.
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"math/rand"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rachitsh92/write-ahead-log/wal"
+)
+
+// accounts is how many accounts the workload moves money between
+const accounts = 16
+
+func main() {
+	child := flag.Bool("child", false, "run as the writer process (internal)")
+	dir := flag.String("dir", "", "directory for the log (default: a new temporary directory)")
+	rounds := flag.Int("rounds", 100, "number of crashes to survive")
+	maxRun := flag.Duration("max-run", 500*time.Millisecond, "longest a writer runs before it is killed")
+	seed := flag.Int64("seed", time.Now().UnixNano(), "random seed, printed so a failing run can be repeated")
+	quota := flag.Int64("quota", 0, "disk quota of the writer, in bytes (internal)")
+	skip := flag.Bool("skip-clock", false, "make the writer's clock jump (internal)")
+	torn := flag.Bool("torn-writes", false, "make some of the writer's writes fail part way (internal)")
+	flag.Parse()
+
+	var err error
+	if *child {
+		err = runWriter(*seed, *quota, *skip, *torn)
+	} else {
+		err = run(*dir, *rounds, *maxRun, *seed)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "walchaos:", err)
+		os.Exit(1)
+	}
+}
+
+// logName is the log the writer appends to, relative to the working directory
+const logName = "chaos.log"
+
+// run drives the rounds of the test from the parent process
+func run(dir string, rounds int, maxRun time.Duration, seed int64) error {
+	if dir == "" {
+		var err error
+		if dir, err = os.MkdirTemp("", "walchaos"); err != nil {
+			return err
+		}
+	}
+	// The database snapshot is written to the working directory
+	if err := os.Chdir(dir); err != nil {
+		return err
+	}
+	fmt.Printf("seed %d, log %s\n", seed, filepath.Join(dir, logName))
+
+	self, err := os.Executable()
+	if err != nil {
+		return err
+	}
+
+	rng := rand.New(rand.NewSource(seed))
+	acked := int64(0)
+	for round := 1; round <= rounds; round++ {
+		usage, err := logSize()
+		if err != nil {
+			return err
+		}
+
+		args := []string{"-child", "-seed", strconv.FormatInt(rng.Int63(), 10)}
+		fault := "kill"
+		switch rng.Intn(5) {
+		case 0:
+			// Leave room for a handful of transactions only
+			args = append(args, "-quota", strconv.FormatInt(usage+int64(rng.Intn(4096)), 10))
+			fault = "disk full"
+		case 1:
+			args = append(args, "-skip-clock")
+			fault = "clock skip"
+		case 2:
+			args = append(args, "-torn-writes")
+			fault = "torn writes"
+		}
+
+		last, err := runRound(self, args, time.Duration(rng.Int63n(int64(maxRun))+1))
+		if err != nil {
+			return fmt.Errorf("round %d (%s): %w", round, fault, err)
+		}
+		if last > acked {
+			acked = last
+		}
+
+		seq, err := check(acked)
+		if err != nil {
+			return fmt.Errorf("round %d (%s): %w", round, fault, err)
+		}
+		fmt.Printf("round %d (%s): %d transactions acknowledged, recovered through %d\n", round, fault, acked, seq)
+	}
+
+	fmt.Println("ok")
+	return nil
+}
+
+// runRound starts a writer, kills it after d, and returns the last
+// transaction it acknowledged
+func runRound(self string, args []string, d time.Duration) (int64, error) {
+	cmd := exec.Command(self, args...)
+	cmd.Stderr = os.Stderr
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return 0, err
+	}
+	if err := cmd.Start(); err != nil {
+		return 0, err
+	}
+
+	acks := make(chan int64)
+	go func() {
+		defer close(acks)
+		last := int64(0)
+		scanner := bufio.NewScanner(stdout)
+		for scanner.Scan() {
+			if seq, err := strconv.ParseInt(strings.TrimPrefix(scanner.Text(), "ack "), 10, 64); err == nil {
+				last = seq
+			}
+		}
+		acks <- last
+	}()
+
+	timer := time.AfterFunc(d, func() {
+		cmd.Process.Kill()
+	})
+	last := <-acks
+	waitErr := cmd.Wait()
+	timer.Stop()
+
+	// The writer is expected to be killed, or to stop when its disk is full
+	if exitErr, ok := waitErr.(*exec.ExitError); ok && exitErr.Exited() && exitErr.ExitCode() != exitDiskFull {
+		return 0, fmt.Errorf("writer failed: %v", waitErr)
+	}
+	return last, nil
+}
+
+// check recovers the log and verifies the workload's invariants: money is
+// neither created nor destroyed, and every acknowledged transaction survived
+func check(acked int64) (int64, error) {
+	log, err := wal.NewWAL(logName)
+	if err != nil {
+		return 0, fmt.Errorf("recovery failed: %w", err)
+	}
+	defer log.Close()
+
+	total := int64(0)
+	for i := 0; i < accounts; i++ {
+		balance, _, err := log.GetInt64(accountKey(i))
+		if err != nil {
+			return 0, err
+		}
+		total += balance
+	}
+	if total != 0 {
+		return 0, fmt.Errorf("balances sum to %d, not 0", total)
+	}
+
+	seq, _, err := log.GetInt64("seq")
+	if err != nil {
+		return 0, err
+	}
+	if seq < acked {
+		return 0, fmt.Errorf("transaction %d was acknowledged but recovery stopped at %d", acked, seq)
+	}
+
+	if err := wal.VerifyLog(logName); err != nil {
+		return 0, fmt.Errorf("recovered log does not verify: %w", err)
+	}
+	return seq, nil
+}
+
+// logSize returns the size of the log, zero before it exists
+func logSize() (int64, error) {
+	info, err := os.Stat(logName)
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return info.Size(), nil
+}
+
+func accountKey(i int) string {
+	return fmt.Sprintf("account/%02d", i)
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/rachitsh92/write-ahead-log/wal"
+)
+
+// exitDiskFull is the writer's exit code when it runs out of disk quota
+const exitDiskFull = 3
+
+// tornWriteRate is the share of writes that fail part way with -torn-writes
+const tornWriteRate = 0.05
+
+// runWriter moves money between accounts, one transaction at a time, until
+// it is killed. It prints "ack <seq>" once transaction seq has committed.
+// With torn writes, a transaction whose write fails is aborted and tried
+// again under the same seq.
+func runWriter(seed, quota int64, skip, torn bool) error {
+	rng := rand.New(rand.NewSource(seed))
+
+	opts := []wal.Option{}
+	if quota > 0 {
+		opts = append(opts, wal.WithDiskQuota(quota))
+	}
+	if skip {
+		opts = append(opts, wal.WithClock(&skippingClock{rng: rand.New(rand.NewSource(seed))}))
+	}
+	if torn {
+		opts = append(opts, wal.WithFaultInjector(wal.FaultInjector{
+			WriteErrorRate: tornWriteRate,
+			PartialWrites:  true,
+			Seed:           seed,
+		}))
+	}
+
+	log, err := wal.NewWAL(logName, opts...)
+	if err != nil {
+		return err
+	}
+
+	seq, _, err := log.GetInt64("seq")
+	if err != nil {
+		return err
+	}
+
+	for {
+		seq++
+		from, to := rng.Intn(accounts), rng.Intn(accounts)
+		amount := rng.Int63n(100)
+
+		err := log.Increment(accountKey(from), -amount)
+		if err == nil {
+			err = log.Increment(accountKey(to), amount)
+		}
+		if err == nil {
+			// Keys that expire exercise the clock
+			err = log.PutWithTTL(fmt.Sprintf("session/%d", seq%32), "x", time.Duration(rng.Intn(1000))*time.Millisecond)
+		}
+		if err == nil {
+			err = log.PutInt64("seq", seq)
+		}
+		if err == nil {
+			_, err = log.Commit()
+		}
+
+		if errors.Is(err, wal.ErrQuotaExceeded) {
+			log.AbortTransaction()
+			log.Close()
+			os.Exit(exitDiskFull)
+		}
+		if errors.Is(err, wal.ErrInjectedFault) {
+			// The abort can be torn too; until it is written, the
+			// transaction's records would be committed with the next one
+			for err = log.AbortTransaction(); errors.Is(err, wal.ErrInjectedFault); err = log.AbortTransaction() {
+			}
+			if err != nil {
+				return err
+			}
+			seq--
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		fmt.Printf("ack %d\n", seq)
+	}
+}
+
+// skippingClock is a system clock that now and then jumps forward by up to
+// an hour, as a clock stepped by NTP or a resumed VM might
+type skippingClock struct {
+	mu     sync.Mutex
+	rng    *rand.Rand
+	offset time.Duration
+}
+
+func (c *skippingClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.rng.Intn(100) == 0 {
+		c.offset += time.Duration(c.rng.Int63n(int64(time.Hour)))
+	}
+	return time.Now().Add(c.offset)
+}
+
+func (c *skippingClock) NewTicker(d time.Duration) wal.Ticker {
+	return systemTicker{time.NewTicker(d)}
+}
+
+// systemTicker adapts a time.Ticker to wal.Ticker
+type systemTicker struct {
+	ticker *time.Ticker
+}
+
+func (t systemTicker) C() <-chan time.Time {
+	return t.ticker.C
+}
+
+func (t systemTicker) Stop() {
+	t.ticker.Stop()
+}
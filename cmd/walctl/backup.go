@@ -0,0 +1,75 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/rachitsh92/write-ahead-log/wal"
+)
+
+func runSnapshot(args []string) error {
+	fs := flag.NewFlagSet("snapshot", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: walctl snapshot [-json] <log> <backup>\n\ncopy a log, up to its last complete transaction, to a new file; the log may be in use")
+	}
+	addJSONFlag(fs)
+	fs.Parse(args)
+
+	if fs.NArg() != 2 {
+		fs.Usage()
+		return fmt.Errorf("snapshot needs a log and a backup file")
+	}
+
+	lsn, err := wal.BackupLog(fs.Arg(0), fs.Arg(1))
+	if err != nil {
+		return err
+	}
+
+	if jsonOutput {
+		return printJSON(struct {
+			File   string `json:"file"`
+			Backup string `json:"backup"`
+			LSN    uint64 `json:"lsn"`
+		}{fs.Arg(0), fs.Arg(1), lsn})
+	}
+	fmt.Printf("%s: backed up to %s through LSN %d\n", fs.Arg(0), fs.Arg(1), lsn)
+	return nil
+}
+
+func runRestore(args []string) error {
+	fs := flag.NewFlagSet("restore", flag.ExitOnError)
+	force := fs.Bool("force", false, "replace the log if it exists")
+	addJSONFlag(fs)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: walctl restore [-force] [-json] <backup> <log>\n\nput a backup in place of a log; the log must not be open")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if fs.NArg() != 2 {
+		fs.Usage()
+		return fmt.Errorf("restore needs a backup and a log file")
+	}
+	backup, filename := fs.Arg(0), fs.Arg(1)
+
+	if _, err := os.Stat(filename); err == nil && !*force {
+		return fmt.Errorf("%s exists; use -force to replace it", filename)
+	} else if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	if err := wal.RestoreLog(backup, filename); err != nil {
+		return err
+	}
+
+	if jsonOutput {
+		return printJSON(struct {
+			File   string `json:"file"`
+			Backup string `json:"backup"`
+		}{filename, backup})
+	}
+	fmt.Printf("%s: restored from %s\n", filename, backup)
+	return nil
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rachitsh92/write-ahead-log/wal"
+)
+
+// benchResult is what one benchmark worker measured
+type benchResult struct {
+	latencies []time.Duration
+	err       error
+}
+
+func runBench(args []string) error {
+	fs := flag.NewFlagSet("bench", flag.ExitOnError)
+	dir := fs.String("dir", ".", "directory on the disk to measure; a scratch directory is created in it and removed afterwards")
+	recordSize := fs.Int("record-size", 256, "bytes of value per record")
+	concurrency := fs.Int("concurrency", 1, "goroutines committing at once")
+	txnSize := fs.Int("txn-size", 1, "records per transaction")
+	keys := fs.Int("keys", 1000, "distinct keys written")
+	duration := fs.Duration("duration", 10*time.Second, "how long to run")
+	syncMode := fs.String("sync", "on-commit", "on-commit: commit and sync every transaction; none: append records without committing")
+	addJSONFlag(fs)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: walctl bench [flags]")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if fs.NArg() != 0 {
+		fs.Usage()
+		return fmt.Errorf("bench takes no arguments")
+	}
+	if *recordSize < 0 || *concurrency < 1 || *txnSize < 1 || *keys < 1 {
+		return fmt.Errorf("record-size must not be negative; concurrency, txn-size and keys must be positive")
+	}
+	if *syncMode != "on-commit" && *syncMode != "none" {
+		return fmt.Errorf("bad sync mode %q: want on-commit or none", *syncMode)
+	}
+
+	// The WAL keeps its database snapshot in the working directory, so
+	// work in a directory of our own
+	scratch, err := os.MkdirTemp(*dir, "walbench")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(scratch)
+	cwd, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+	if err := os.Chdir(scratch); err != nil {
+		return err
+	}
+	defer os.Chdir(cwd)
+
+	log, err := wal.NewWAL(filepath.Join(scratch, "bench.log"))
+	if err != nil {
+		return err
+	}
+	defer log.Close()
+
+	value := strings.Repeat("x", *recordSize)
+	deadline := time.Now().Add(*duration)
+	results := make([]benchResult, *concurrency)
+	var wg sync.WaitGroup
+	start := time.Now()
+	for i := range results {
+		i := i
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r := &results[i]
+			for n := 0; time.Now().Before(deadline); n++ {
+				began := time.Now()
+				if *syncMode == "none" {
+					r.err = log.Put(fmt.Sprintf("bench-%d", (i+n*(*concurrency))%*keys), value)
+				} else {
+					txn := &wal.Txn{}
+					for j := 0; j < *txnSize; j++ {
+						txn.Put(fmt.Sprintf("bench-%d", (i+(n*(*txnSize)+j)*(*concurrency))%*keys), value)
+					}
+					_, r.err = log.CommitTxn(txn)
+				}
+				if r.err != nil {
+					return
+				}
+				r.latencies = append(r.latencies, time.Since(began))
+			}
+		}()
+	}
+	wg.Wait()
+	elapsed := time.Since(start)
+
+	var latencies []time.Duration
+	for _, r := range results {
+		if r.err != nil {
+			return r.err
+		}
+		latencies = append(latencies, r.latencies...)
+	}
+	if *syncMode == "none" {
+		if err := log.AbortTransaction(); err != nil {
+			return err
+		}
+	}
+	if len(latencies) == 0 {
+		return fmt.Errorf("nothing completed in %s", *duration)
+	}
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+
+	unit, perUnit := "transactions", *txnSize
+	if *syncMode == "none" {
+		unit, perUnit = "appends", 1
+	}
+	records := len(latencies) * perUnit
+	seconds := elapsed.Seconds()
+	if jsonOutput {
+		return printJSON(struct {
+			Sync          string           `json:"sync"`
+			Operations    int              `json:"operations"`
+			Records       int              `json:"records"`
+			RecordSize    int              `json:"record_size"`
+			Concurrency   int              `json:"concurrency"`
+			Seconds       float64          `json:"seconds"`
+			OpsPerSec     float64          `json:"ops_per_sec"`
+			RecordsPerSec float64          `json:"records_per_sec"`
+			LatencyNanos  map[string]int64 `json:"latency_ns"`
+		}{
+			*syncMode, len(latencies), records, *recordSize, *concurrency, seconds,
+			float64(len(latencies)) / seconds, float64(records) / seconds,
+			map[string]int64{
+				"p50":   int64(percentile(latencies, 0.50)),
+				"p90":   int64(percentile(latencies, 0.90)),
+				"p99":   int64(percentile(latencies, 0.99)),
+				"p99.9": int64(percentile(latencies, 0.999)),
+				"max":   int64(percentile(latencies, 1)),
+			},
+		})
+	}
+	fmt.Printf("%d %s of %d records of %d bytes in %s with %d goroutines\n",
+		len(latencies), unit, perUnit, *recordSize, elapsed.Round(time.Millisecond), *concurrency)
+	fmt.Printf("throughput:  %.0f %s/s, %.0f records/s, %.2f MB/s of values\n",
+		float64(len(latencies))/seconds, unit, float64(records)/seconds, float64(records*(*recordSize))/seconds/1e6)
+	fmt.Printf("latency:     p50 %s  p90 %s  p99 %s  p99.9 %s  max %s\n",
+		percentile(latencies, 0.50), percentile(latencies, 0.90), percentile(latencies, 0.99),
+		percentile(latencies, 0.999), percentile(latencies, 1))
+	return nil
+}
+
+// percentile returns the p-th quantile of sorted latencies
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	i := int(p * float64(len(sorted)))
+	if i >= len(sorted) {
+		i = len(sorted) - 1
+	}
+	return sorted[i].Round(time.Microsecond)
+}
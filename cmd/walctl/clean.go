@@ -0,0 +1,53 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/rachitsh92/write-ahead-log/wal"
+)
+
+func runClean(args []string) error {
+	fs := flag.NewFlagSet("clean", flag.ExitOnError)
+	dryRun := fs.Bool("dry-run", false, "list leftover temporary files without removing them")
+	addJSONFlag(fs)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: walctl clean [-dry-run] [-json] <log>")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return fmt.Errorf("clean needs a log file")
+	}
+
+	orphans, err := wal.FindOrphans(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	for _, name := range orphans {
+		if *dryRun {
+			if !jsonOutput {
+				fmt.Println(name)
+			}
+			continue
+		}
+		if err := os.Remove(name); err != nil {
+			return err
+		}
+		if !jsonOutput {
+			fmt.Println("removed", name)
+		}
+	}
+
+	if jsonOutput {
+		return printJSON(struct {
+			Orphans []string `json:"orphans"`
+			Removed bool     `json:"removed"`
+		}{orphans, !*dryRun})
+	}
+	return nil
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+
+	"github.com/rachitsh92/write-ahead-log/wal"
+)
+
+func runDiff(args []string) error {
+	fs := flag.NewFlagSet("diff", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: walctl diff [-json] <log> <log>")
+	}
+	addJSONFlag(fs)
+	fs.Parse(args)
+
+	if fs.NArg() != 2 {
+		fs.Usage()
+		return fmt.Errorf("diff needs two logs")
+	}
+	a, b := fs.Arg(0), fs.Arg(1)
+
+	report, err := wal.DiffLogs(a, b)
+	if err != nil {
+		return err
+	}
+
+	if jsonOutput {
+		return diffJSON(a, b, report)
+	}
+
+	fmt.Printf("%s: last LSN %d\n", a, report.LastA)
+	fmt.Printf("%s: last LSN %d\n", b, report.LastB)
+	if report.Divergent == nil {
+		fmt.Printf("logs agree through LSN %d\n", report.Agreed)
+		return nil
+	}
+
+	fmt.Printf("logs agree through LSN %d and diverge at LSN %d\n", report.Agreed, report.Divergent.LSN)
+	printDivergent(a, report.Divergent)
+	printDivergent(b, report.Other)
+	return fmt.Errorf("logs diverge")
+}
+
+// printDivergent prints one side of a divergent record
+func printDivergent(filename string, record *wal.LogRecord) {
+	fmt.Printf("  %s: term %d, %s, %d bytes, crc %08x\n", filename, record.Term, record.Operation, len(record.Data), record.CRC32)
+}
+
+// diffJSON prints the outcome of a diff as JSON
+func diffJSON(a, b string, report *wal.DiffReport) error {
+	result := struct {
+		A         string      `json:"a"`
+		B         string      `json:"b"`
+		LastA     uint64      `json:"last_a"`
+		LastB     uint64      `json:"last_b"`
+		Agreed    uint64      `json:"agreed"`
+		Divergent bool        `json:"divergent"`
+		RecordA   *jsonRecord `json:"record_a,omitempty"`
+		RecordB   *jsonRecord `json:"record_b,omitempty"`
+	}{A: a, B: b, LastA: report.LastA, LastB: report.LastB, Agreed: report.Agreed}
+
+	if report.Divergent != nil {
+		ra, rb := newJSONRecord(*report.Divergent), newJSONRecord(*report.Other)
+		result.Divergent, result.RecordA, result.RecordB = true, &ra, &rb
+	}
+	if err := printJSON(result); err != nil {
+		return err
+	}
+	if result.Divergent {
+		return fmt.Errorf("logs diverge")
+	}
+	return nil
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/rachitsh92/write-ahead-log/wal/load"
+)
+
+func runImport(args []string) error {
+	fs := flag.NewFlagSet("import", flag.ExitOnError)
+	format := fs.String("format", "", "input format, csv or jsonl (default: from the file extension)")
+	txnSize := fs.Int("txn-size", 1000, "rows per transaction")
+	name := fs.String("name", "", "name of the load, so that running it again resumes where it stopped")
+	header := fs.Bool("header", false, "skip the first row of CSV input")
+	addJSONFlag(fs)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: walctl import [-format csv|jsonl] [-txn-size n] [-name name] [-header] [-json] <log> <file>\n\nload key-value rows into a log: CSV rows of key and value, or JSON lines\nwith \"key\" and \"value\" members")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if fs.NArg() != 2 {
+		fs.Usage()
+		return fmt.Errorf("import needs a log and an input file")
+	}
+	filename, input := fs.Arg(0), fs.Arg(1)
+
+	if *format == "" {
+		switch strings.ToLower(filepath.Ext(input)) {
+		case ".csv":
+			*format = string(load.CSV)
+		case ".jsonl", ".ndjson":
+			*format = string(load.JSONL)
+		default:
+			return fmt.Errorf("cannot tell the format of %s; use -format", input)
+		}
+	}
+
+	in, err := os.Open(input)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	log, done, err := openLog(filename)
+	if err != nil {
+		return err
+	}
+	defer done()
+
+	// An interrupted load stops after its current transaction
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	start := time.Now()
+	lastReport := start
+	loader := &load.Loader{
+		WAL:     log,
+		Format:  load.Format(*format),
+		Name:    *name,
+		TxnSize: *txnSize,
+		Header:  *header,
+		OnProgress: func(p load.Progress) {
+			if jsonOutput || time.Since(lastReport) < time.Second {
+				return
+			}
+			lastReport = time.Now()
+			fmt.Fprintf(os.Stderr, "%d rows in %d transactions, last LSN %d\n", p.Rows, p.Txns, p.LSN)
+		},
+	}
+
+	progress, err := loader.Run(ctx, in)
+	if err != nil {
+		if progress.Txns > 0 {
+			fmt.Fprintf(os.Stderr, "stopped after %d rows, through LSN %d\n", progress.Rows, progress.LSN)
+		}
+		return err
+	}
+
+	if jsonOutput {
+		return printJSON(struct {
+			File    string  `json:"file"`
+			Input   string  `json:"input"`
+			Rows    int     `json:"rows"`
+			Skipped int     `json:"skipped"`
+			Txns    int     `json:"txns"`
+			LastLSN uint64  `json:"last_lsn"`
+			Seconds float64 `json:"seconds"`
+		}{filename, input, progress.Rows, progress.Skipped, progress.Txns, progress.LSN, time.Since(start).Seconds()})
+	}
+	if progress.Skipped > 0 {
+		fmt.Printf("%s: skipped %d rows loaded earlier\n", input, progress.Skipped)
+	}
+	fmt.Printf("%s: loaded %d rows in %d transactions in %v\n", input, progress.Rows-progress.Skipped, progress.Txns, time.Since(start).Round(time.Millisecond))
+	return nil
+}
@@ -0,0 +1,159 @@
+// Command walctl provides offline maintenance operations for WAL files.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/rachitsh92/write-ahead-log/wal"
+)
+
+// jsonOutput is set by the -json flag every command takes
+var jsonOutput bool
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+	if err := registerDictionary(); err != nil {
+		fmt.Fprintln(os.Stderr, "walctl:", err)
+		os.Exit(1)
+	}
+
+	var err error
+	switch os.Args[1] {
+	case "migrate":
+		err = runMigrate(os.Args[2:])
+	case "recover":
+		err = runRecover(os.Args[2:])
+	case "verify":
+		err = runVerify(os.Args[2:])
+	case "repair":
+		err = runRepair(os.Args[2:])
+	case "clean":
+		err = runClean(os.Args[2:])
+	case "redact":
+		err = runRedact(os.Args[2:])
+	case "diff":
+		err = runDiff(os.Args[2:])
+	case "tail":
+		err = runTail(os.Args[2:])
+	case "truncate":
+		err = runTruncate(os.Args[2:])
+	case "purge":
+		err = runPurge(os.Args[2:])
+	case "bench":
+		err = runBench(os.Args[2:])
+	case "snapshot":
+		err = runSnapshot(os.Args[2:])
+	case "restore":
+		err = runRestore(os.Args[2:])
+	case "import":
+		err = runImport(os.Args[2:])
+	default:
+		usage()
+		os.Exit(2)
+	}
+
+	if err != nil {
+		if jsonOutput {
+			json.NewEncoder(os.Stderr).Encode(map[string]string{"error": err.Error()})
+		} else {
+			fmt.Fprintln(os.Stderr, "walctl:", err)
+		}
+		os.Exit(1)
+	}
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, `usage: walctl <command> [arguments]
+
+commands:
+  migrate   rewrite a legacy or older log into the current format
+  recover   replay a log after a crash, or report what replay would do
+  verify    check every record of one or more logs
+  repair    repair a damaged log from a mirror or archived copy
+  clean     remove temporary files left by interrupted operations
+  redact    replace the records of some keys with redaction markers
+  diff      find the first record at which two copies of a log differ
+  tail      print the records of a log, optionally as they are appended
+  truncate  delete every record after an LSN
+  purge     delete the transactions that ended before an LSN
+  bench     measure commit throughput and latency on this disk
+  snapshot  back up a log, even one in use
+  restore   put a backup in place of a log
+  import    load key-value rows from CSV or JSON lines into a log
+
+Every command takes -json to print its result as JSON on stdout, and any
+error as a JSON object with an "error" field on stderr. To read a log
+compressed with a dictionary, set WAL_COMPRESSION_DICTIONARY to the file
+holding it.`)
+}
+
+// registerDictionary registers the compression dictionary held in the file
+// named by WAL_COMPRESSION_DICTIONARY, the variable LoadConfig reads, if set
+func registerDictionary() error {
+	name := os.Getenv("WAL_COMPRESSION_DICTIONARY")
+	if name == "" {
+		return nil
+	}
+	dict, err := os.ReadFile(name)
+	if err != nil {
+		return err
+	}
+	return wal.RegisterCompressionDictionary(dict)
+}
+
+// addJSONFlag adds the -json flag to a command's flags
+func addJSONFlag(fs *flag.FlagSet) {
+	fs.BoolVar(&jsonOutput, "json", false, "print the result as JSON")
+}
+
+// printJSON prints v as one line of JSON
+func printJSON(v interface{}) error {
+	return json.NewEncoder(os.Stdout).Encode(v)
+}
+
+// stringList is a flag that may be repeated
+type stringList []string
+
+func (s *stringList) String() string {
+	return fmt.Sprint(*s)
+}
+
+func (s *stringList) Set(value string) error {
+	*s = append(*s, value)
+	return nil
+}
+
+// openLog opens the WAL at filename from the log's own directory: the WAL
+// saves its database snapshot in the working directory, and walctl must not
+// leave one wherever it happens to be run. done closes the WAL and returns
+// to the original working directory.
+func openLog(filename string) (log *wal.WAL, done func() error, err error) {
+	abs, err := filepath.Abs(filename)
+	if err != nil {
+		return nil, nil, err
+	}
+	cwd, err := os.Getwd()
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := os.Chdir(filepath.Dir(abs)); err != nil {
+		return nil, nil, err
+	}
+
+	log, err = wal.NewWAL(abs)
+	if err != nil {
+		os.Chdir(cwd)
+		return nil, nil, err
+	}
+	return log, func() error {
+		defer os.Chdir(cwd)
+		return log.Close()
+	}, nil
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+
+	"github.com/rachitsh92/write-ahead-log/wal"
+)
+
+func runMigrate(args []string) error {
+	fs := flag.NewFlagSet("migrate", flag.ExitOnError)
+	var operations stringList
+	fs.Var(&operations, "op", "operation string used by the application, for legacy logs (repeatable)")
+	addJSONFlag(fs)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: walctl migrate [-json] [-op operation]... <old-log> <new-log>")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if fs.NArg() != 2 {
+		fs.Usage()
+		return fmt.Errorf("migrate needs a source and a destination")
+	}
+
+	count, err := wal.MigrateLegacyLog(fs.Arg(0), fs.Arg(1), operations)
+	if err != nil {
+		return err
+	}
+
+	if jsonOutput {
+		return printJSON(struct {
+			Source      string `json:"source"`
+			Destination string `json:"destination"`
+			Records     int    `json:"records"`
+		}{fs.Arg(0), fs.Arg(1), count})
+	}
+	fmt.Printf("migrated %d records from %s to %s\n", count, fs.Arg(0), fs.Arg(1))
+	return nil
+}
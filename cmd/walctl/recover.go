@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+
+	"github.com/rachitsh92/write-ahead-log/wal"
+)
+
+func runRecover(args []string) error {
+	fs := flag.NewFlagSet("recover", flag.ExitOnError)
+	dryRun := fs.Bool("dry-run", false, "report what recovery would do without changing the log")
+	addJSONFlag(fs)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: walctl recover [-dry-run] [-json] <log>")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return fmt.Errorf("recover needs a log file")
+	}
+
+	report, err := wal.DryRunRecovery(context.Background(), fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	if jsonOutput {
+		return recoverJSON(report, *dryRun, fs.Arg(0))
+	}
+
+	fmt.Printf("file:              %s (%d bytes)\n", report.File, report.FileSize)
+	fmt.Printf("records:           %d\n", report.Records)
+	fmt.Printf("committed txns:    %d (last LSN %d)\n", report.CommittedTxns, report.LastCommittedLSN)
+	fmt.Printf("aborted txns:      %d (%d records discarded)\n", report.AbortedTxns, report.DiscardedRecords)
+	if report.DuplicateRecords > 0 {
+		fmt.Printf("duplicates:        %d (skipped)\n", report.DuplicateRecords)
+	}
+	if report.TailError != nil {
+		fmt.Printf("tail error:        %v\n", report.TailError)
+	}
+	if report.TruncateOffset < report.FileSize {
+		fmt.Printf("truncate at:       %d\n", report.TruncateOffset)
+	}
+
+	if *dryRun {
+		return nil
+	}
+
+	_, done, err := openLog(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer done()
+
+	fmt.Println("recovered")
+	return nil
+}
+
+// recoverJSON prints the recovery report as JSON, recovering the log first
+// unless dryRun is set
+func recoverJSON(report *wal.RecoveryReport, dryRun bool, filename string) error {
+	if !dryRun {
+		_, done, err := openLog(filename)
+		if err != nil {
+			return err
+		}
+		if err := done(); err != nil {
+			return err
+		}
+	}
+
+	tailError := ""
+	if report.TailError != nil {
+		tailError = report.TailError.Error()
+	}
+	return printJSON(struct {
+		File             string `json:"file"`
+		FileSize         int64  `json:"file_size"`
+		Records          int    `json:"records"`
+		CommittedTxns    int    `json:"committed_txns"`
+		AbortedTxns      int    `json:"aborted_txns"`
+		DiscardedRecords int    `json:"discarded_records"`
+		DuplicateRecords int    `json:"duplicate_records"`
+		LastCommittedLSN uint64 `json:"last_committed_lsn"`
+		TruncateOffset   int64  `json:"truncate_offset"`
+		TailError        string `json:"tail_error,omitempty"`
+		Recovered        bool   `json:"recovered"`
+	}{
+		report.File, report.FileSize, report.Records, report.CommittedTxns, report.AbortedTxns,
+		report.DiscardedRecords, report.DuplicateRecords, report.LastCommittedLSN,
+		report.TruncateOffset, tailError, !dryRun,
+	})
+}
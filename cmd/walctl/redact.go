@@ -0,0 +1,36 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+
+	"github.com/rachitsh92/write-ahead-log/wal"
+)
+
+func runRedact(args []string) error {
+	fs := flag.NewFlagSet("redact", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: walctl redact [-json] <log> <key>...")
+	}
+	addJSONFlag(fs)
+	fs.Parse(args)
+
+	if fs.NArg() < 2 {
+		fs.Usage()
+		return fmt.Errorf("redact needs a log and at least one key")
+	}
+
+	redacted, err := wal.RedactLog(fs.Arg(0), fs.Args()[1:]...)
+	if err != nil {
+		return err
+	}
+
+	if jsonOutput {
+		return printJSON(struct {
+			File     string `json:"file"`
+			Redacted int    `json:"redacted"`
+		}{fs.Arg(0), redacted})
+	}
+	fmt.Printf("%s: redacted %d records\n", fs.Arg(0), redacted)
+	return nil
+}
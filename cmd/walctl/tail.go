@@ -0,0 +1,143 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/rachitsh92/write-ahead-log/wal"
+)
+
+// jsonRecord is a record as printed with -json
+type jsonRecord struct {
+	LSN       uint64   `json:"lsn"`
+	Term      uint64   `json:"term,omitempty"`
+	Operation string   `json:"op"`
+	Key       string   `json:"key,omitempty"`
+	Fields    []string `json:"fields,omitempty"`
+	Data      string   `json:"data,omitempty"`
+	CRC32     uint32   `json:"crc32"`
+}
+
+func runTail(args []string) error {
+	fs := flag.NewFlagSet("tail", flag.ExitOnError)
+	follow := fs.Bool("follow", false, "keep printing records as they are appended")
+	sinceLSN := fs.Uint64("since-lsn", 0, "print only records from this LSN on")
+	interval := fs.Duration("interval", 200*time.Millisecond, "how often to check for new records with -follow")
+	var filters stringList
+	fs.Var(&filters, "filter", "print only matching records: op=OPERATION or key=PREFIX (repeatable; ops are ORed)")
+	addJSONFlag(fs)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: walctl tail [-follow] [-since-lsn N] [-filter op=PUT] [-json] <log>")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return fmt.Errorf("tail needs a log file")
+	}
+
+	var ops []string
+	keyPrefix := ""
+	for _, f := range filters {
+		name, value, ok := strings.Cut(f, "=")
+		switch {
+		case ok && name == "op":
+			ops = append(ops, value)
+		case ok && name == "key":
+			keyPrefix = value
+		default:
+			return fmt.Errorf("bad filter %q: want op=OPERATION or key=PREFIX", f)
+		}
+	}
+
+	lr, err := wal.OpenLogReader(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer lr.Close()
+
+	for {
+		record, err := lr.Next()
+		if err == io.EOF || errors.Is(err, wal.ErrCorruptRecord) {
+			// A damaged record may just be one still being written
+			if !*follow {
+				return nil
+			}
+			time.Sleep(*interval)
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		if record.LSN < *sinceLSN || !matchTail(record, ops, keyPrefix) {
+			continue
+		}
+		if jsonOutput {
+			err = printJSON(newJSONRecord(record))
+		} else {
+			_, err = fmt.Println(formatRecord(record))
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// matchTail reports whether record passes the filters
+func matchTail(record wal.LogRecord, ops []string, keyPrefix string) bool {
+	if len(ops) > 0 {
+		found := false
+		for _, op := range ops {
+			if op == record.Operation {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if keyPrefix == "" {
+		return true
+	}
+
+	key, ok := record.Key()
+	return ok && strings.HasPrefix(key, keyPrefix)
+}
+
+// newJSONRecord converts a record to what -json prints
+func newJSONRecord(record wal.LogRecord) jsonRecord {
+	t := jsonRecord{LSN: record.LSN, Term: record.Term, Operation: record.Operation, CRC32: record.CRC32}
+	if key, ok := record.Key(); ok {
+		t.Key = key
+		t.Fields, _ = record.Fields()
+	} else {
+		t.Data = record.Data
+	}
+	return t
+}
+
+// formatRecord formats a record for people to read
+func formatRecord(record wal.LogRecord) string {
+	line := fmt.Sprintf("%8d", record.LSN)
+	if record.Term != 0 {
+		line += fmt.Sprintf(" term %d", record.Term)
+	}
+	line += " " + record.Operation
+
+	if _, ok := record.Key(); ok {
+		fields, _ := record.Fields()
+		for _, field := range fields {
+			line += " " + fmt.Sprintf("%q", field)
+		}
+	} else if record.Data != "" {
+		line += " " + fmt.Sprintf("%q", record.Data)
+	}
+	return line
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/rachitsh92/write-ahead-log/wal"
+)
+
+func runTruncate(args []string) error {
+	return runTrim(args, "truncate", "<log> <after-lsn>", "delete every record after an LSN",
+		wal.PlanTruncate, func(w *wal.WAL, lsn uint64) error { return w.Truncate(lsn) })
+}
+
+func runPurge(args []string) error {
+	return runTrim(args, "purge", "<log> <before-lsn>", "delete the transactions that ended before an LSN",
+		wal.PlanDropBefore, func(w *wal.WAL, lsn uint64) error { return w.DropBefore(lsn) })
+}
+
+// runTrim implements truncate and purge: it shows what would be removed
+// and, once confirmed, removes it
+func runTrim(args []string, name, operands, what string,
+	plan func(string, uint64) (*wal.TrimPlan, error), trim func(*wal.WAL, uint64) error) error {
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	dryRun := fs.Bool("dry-run", false, "show what would be removed without changing the log")
+	yes := fs.Bool("yes", false, "do not ask for confirmation")
+	addJSONFlag(fs)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: walctl %s [-dry-run] [-yes] [-json] %s\n\n%s; the log must not be open\n", name, operands, what)
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if fs.NArg() != 2 {
+		fs.Usage()
+		return fmt.Errorf("%s needs a log file and an LSN", name)
+	}
+	filename := fs.Arg(0)
+	lsn, err := strconv.ParseUint(fs.Arg(1), 10, 64)
+	if err != nil {
+		return fmt.Errorf("bad LSN %q", fs.Arg(1))
+	}
+
+	p, err := plan(filename, lsn)
+	if err != nil {
+		return err
+	}
+	if p.Records == 0 || *dryRun {
+		return printTrim(filename, p, false)
+	}
+	if !jsonOutput {
+		fmt.Printf("%s: would remove LSNs %d to %d: %d records, %d committed transactions\n",
+			filename, p.FirstLSN, p.LastLSN, p.Records, p.Committed)
+	}
+
+	if !*yes && !confirm(fmt.Sprintf("%s %s? [y/N] ", name, filename)) {
+		return fmt.Errorf("%s cancelled", name)
+	}
+
+	log, done, err := openLog(filename)
+	if err != nil {
+		return err
+	}
+	if err := trim(log, lsn); err != nil {
+		done()
+		return err
+	}
+	if err := done(); err != nil {
+		return err
+	}
+
+	return printTrim(filename, p, true)
+}
+
+// printTrim prints what truncate or purge removed, or would remove
+func printTrim(filename string, p *wal.TrimPlan, removed bool) error {
+	if jsonOutput {
+		return printJSON(struct {
+			File      string `json:"file"`
+			FirstLSN  uint64 `json:"first_lsn"`
+			LastLSN   uint64 `json:"last_lsn"`
+			Records   int    `json:"records"`
+			Committed int    `json:"committed_txns"`
+			Removed   bool   `json:"removed"`
+		}{filename, p.FirstLSN, p.LastLSN, p.Records, p.Committed, removed})
+	}
+
+	switch {
+	case p.Records == 0:
+		fmt.Printf("%s: nothing to remove\n", filename)
+	case removed:
+		fmt.Printf("%s: removed %d records\n", filename, p.Records)
+	default:
+		fmt.Printf("%s: would remove LSNs %d to %d: %d records, %d committed transactions\n",
+			filename, p.FirstLSN, p.LastLSN, p.Records, p.Committed)
+	}
+	return nil
+}
+
+// confirm asks a yes or no question on the terminal
+func confirm(question string) bool {
+	fmt.Fprint(os.Stderr, question)
+	answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes"
+}
@@ -10,7 +10,7 @@ func main() {
 		fmt.Println("Error creating WAL:", err)
 		return
 	}
-	defer write_ahead_log.File.Close()
+	defer write_ahead_log.Close()
 
 	// Example transactions
 	err = write_ahead_log.WriteRecord("BEGIN TRANSACTION", "T1")
@@ -0,0 +1,55 @@
+package wal
+
+import "strings"
+
+// opPad marks a padding record. Padding carries LSN 0, is checksummed like
+// any other record, and is skipped by replay and ingestion.
+const opPad = "PAD"
+
+// WithRecordAlignment pads the log so that no record smaller than size
+// bytes straddles a size-byte boundary, and larger records start on one.
+// Use the device's sector size (512 or 4096) so a torn write damages at
+// most the record being written. A size of zero disables alignment.
+func WithRecordAlignment(size int) Option {
+	return func(wal *WAL) {
+		wal.alignment = int64(size)
+	}
+}
+
+// padding returns the padding to write before a record of n bytes so that
+// it does not cross an alignment boundary, or nil if none is needed
+func (wal *WAL) padding(n int) []byte {
+	return wal.paddingAt(wal.logSize, n)
+}
+
+// paddingAt is padding for a record written at offset
+func (wal *WAL) paddingAt(offset int64, n int) []byte {
+	if wal.alignment <= 0 {
+		return nil
+	}
+
+	used := offset % wal.alignment
+	if used == 0 || used+int64(n) <= wal.alignment {
+		return nil
+	}
+
+	return wal.paddingRecord(wal.alignment - used)
+}
+
+// paddingRecord returns a padding record at least gap bytes long that moves
+// the next record the same distance from a boundary as gap would
+func (wal *WAL) paddingRecord(gap int64) []byte {
+	// A padding record has a minimum size, so a short gap is widened by
+	// whole blocks
+	minPadding := int64(frameOverhead(wal.logVersion) + len(opPad))
+	for gap < minPadding {
+		gap += wal.alignment
+	}
+
+	record := LogRecord{
+		Operation: opPad,
+		Data:      strings.Repeat("\x00", int(gap-minPadding)),
+	}
+	record.CRC32 = recordChecksum(record)
+	return encodeRecord(record, wal.logVersion)
+}
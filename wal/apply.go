@@ -0,0 +1,94 @@
+package wal
+
+import "context"
+
+// applyQueueSize is how many committed transactions may wait for the
+// background applier before Commit blocks
+const applyQueueSize = 1024
+
+// applyBatch is a committed transaction waiting to be applied
+type applyBatch struct {
+	records []LogRecord
+	lsn     uint64
+}
+
+// WithAsyncApply makes Commit return as soon as the transaction is durable,
+// leaving a background goroutine to apply it to the database. Reads may then
+// lag behind commits; use WaitForLSN or ReadAtLeast with the LSN returned by
+// Commit to read your own writes.
+func WithAsyncApply() Option {
+	return func(wal *WAL) {
+		wal.asyncApply = true
+	}
+}
+
+// applyTransaction applies a committed transaction to the database and
+// saves the resulting state
+func (wal *WAL) applyTransaction(records []LogRecord, lsn uint64) error {
+	wal.applying.Lock()
+	defer wal.applying.Unlock()
+
+	// Apply all changes to the in-memory database
+	for _, record := range records {
+		if err := wal.applyChanges(record); err != nil {
+			return err
+		}
+	}
+
+	// Flush the in-memory database state to disk
+	return wal.flushDB(lsn)
+}
+
+// startApplier starts the background applier
+func (wal *WAL) startApplier() {
+	queue, done := make(chan applyBatch, applyQueueSize), make(chan struct{})
+	wal.applyQueue, wal.applierDone = queue, done
+	wal.queuedLSN = wal.committedLSN
+
+	go withLabels(context.Background(), "applier", func(context.Context) {
+		defer close(done)
+		for batch := range queue {
+			if err := wal.applyTransaction(batch.records, batch.lsn); err != nil {
+				wal.dbMutex.Lock()
+				if wal.applyErr == nil {
+					wal.applyErr = err
+				}
+				wal.dbMutex.Unlock()
+			}
+		}
+	})
+}
+
+// stopApplier applies any queued transactions, stops the applier and
+// returns the first background apply failure
+func (wal *WAL) stopApplier() error {
+	wal.logMutex.Lock()
+	queue, done := wal.applyQueue, wal.applierDone
+	wal.applyQueue, wal.applierDone = nil, nil
+	wal.logMutex.Unlock()
+
+	if queue == nil {
+		return nil
+	}
+	close(queue)
+	<-done
+
+	return wal.asyncApplyError()
+}
+
+// drainApplier waits until every queued transaction has been applied. The
+// caller must hold logMutex so nothing new is queued meanwhile.
+func (wal *WAL) drainApplier() {
+	if wal.applyQueue == nil {
+		return
+	}
+	wal.WaitForLSN(context.Background(), wal.queuedLSN)
+}
+
+// asyncApplyError returns the first failure of the background applier
+func (wal *WAL) asyncApplyError() error {
+	wal.dbMutex.Lock()
+	defer wal.dbMutex.Unlock()
+
+	return wal.applyErr
+}
@@ -0,0 +1,176 @@
+package wal
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// backupSuffix names the file a backup is written to before it is renamed
+// into place
+const backupSuffix = ".backup"
+
+// restoreSuffix names the file RestoreLog writes before replacing the log
+const restoreSuffix = ".restore"
+
+// maxBackupAttempts bounds how often Backup starts over because the log was
+// rewritten while it was being copied
+const maxBackupAttempts = 3
+
+// ErrLogRewritten is returned by Backup when the log keeps being rewritten
+// while it is copied
+var ErrLogRewritten = errors.New("wal: log rewritten during backup")
+
+// Backup copies the log, up to the last complete transaction, to a new file
+// at dst, and returns the LSN the copy ends at. Writes carry on while the
+// log is copied; what they add after Backup starts is not included. The copy
+// is a log in its own right: it can be opened with NewWAL, or put in place
+// of a lost log with RestoreLog.
+func (wal *WAL) Backup(dst string) (uint64, error) {
+	for attempt := 0; attempt < maxBackupAttempts; attempt++ {
+		wal.logMutex.Lock()
+		name, end, rewrites := wal.file.Name(), wal.logSize, wal.rewrites
+		wal.logMutex.Unlock()
+
+		lsn, err := backupPrefix(name, end, dst, wal.fileMode)
+		if err != nil {
+			return 0, err
+		}
+
+		wal.logMutex.Lock()
+		rewritten := wal.rewrites != rewrites
+		if !rewritten && lsn > wal.archivedLSN {
+			wal.archivedLSN = lsn
+		}
+		wal.logMutex.Unlock()
+		if !rewritten {
+			return lsn, nil
+		}
+	}
+	return 0, ErrLogRewritten
+}
+
+// BackupLog is Backup for a log that is not open in this process. The log
+// may be open in another process, as long as that process does not rewrite
+// it while it is copied. The copy gets the log's permissions.
+func BackupLog(filename, dst string) (uint64, error) {
+	info, err := os.Stat(filename)
+	if err != nil {
+		return 0, err
+	}
+	return backupPrefix(filename, info.Size(), dst, info.Mode().Perm())
+}
+
+// backupPrefix copies the log at filename to dst, with the given mode,
+// reading no more than its first size bytes
+func backupPrefix(filename string, size int64, dst string, mode os.FileMode) (uint64, error) {
+	src, err := os.Open(filename)
+	if err != nil {
+		return 0, err
+	}
+	defer src.Close()
+
+	r := bufio.NewReader(io.NewSectionReader(src, 0, size))
+	header, err := readHeader(r)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", filename, err)
+	}
+
+	// Find the end of the last complete transaction
+	offset, end := int64(headerSize), int64(headerSize)
+	lsn := header.BaseLSN
+	open := false
+	for {
+		record, n, err := readRecord(r, header.Version)
+		if err == io.EOF || errors.Is(err, ErrCorruptRecord) {
+			break
+		}
+		if err != nil {
+			return 0, err
+		}
+		offset += int64(n)
+
+		switch record.Operation {
+		case opPad:
+			continue
+		case opCommit, opAbort:
+			open = false
+		case opNoop, opChain, opConfig:
+		default:
+			open = true
+		}
+		if !open {
+			end, lsn = offset, record.LSN
+		}
+	}
+
+	if err := copyVerified(io.NewSectionReader(src, 0, end), dst, dst+backupSuffix, mode); err != nil {
+		return 0, err
+	}
+	return lsn, nil
+}
+
+// RestoreLog replaces the log at filename with a copy of backup, which must
+// verify intact. The log must not be open while it is restored, and the
+// database is rebuilt from the restored log when it is next opened. The
+// restored log keeps the permissions of the log it replaces, or gets those
+// of the backup if there was none.
+func RestoreLog(backup, filename string) error {
+	if err := VerifyLog(backup); err != nil {
+		return err
+	}
+
+	src, err := os.Open(backup)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	info, err := os.Stat(filename)
+	if errors.Is(err, os.ErrNotExist) {
+		info, err = src.Stat()
+	}
+	if err != nil {
+		return err
+	}
+
+	return copyVerified(src, filename, filename+restoreSuffix, info.Mode().Perm())
+}
+
+// copyVerified writes what r holds to tmpName with the given mode, syncs and
+// verifies it as a log, and renames it to name
+func copyVerified(r io.Reader, name, tmpName string, mode os.FileMode) error {
+	err := func() error {
+		file, err := os.OpenFile(tmpName, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, mode)
+		if err != nil {
+			return err
+		}
+		// Neither the umask nor a stale temporary file decides the mode
+		err = file.Chmod(mode)
+		if err == nil {
+			_, err = io.Copy(file, r)
+		}
+		if err == nil {
+			err = file.Sync()
+		}
+		if closeErr := file.Close(); err == nil {
+			err = closeErr
+		}
+		if err == nil {
+			err = VerifyLog(tmpName)
+		}
+		if err == nil {
+			err = os.Rename(tmpName, name)
+		}
+		return err
+	}()
+	if err != nil {
+		os.Remove(tmpName)
+		return err
+	}
+
+	return syncDir(filepath.Dir(name))
+}
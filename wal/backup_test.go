@@ -0,0 +1,56 @@
+package wal
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestBackupFileMode checks that backups and restores are written with the
+// WAL's permissions, or those of the log they copy
+func TestBackupFileMode(t *testing.T) {
+	dir := inTempDir(t)
+	name := filepath.Join(dir, "wal.log")
+	log, err := NewWAL(name, WithFileMode(0640, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer log.Close()
+	commitKeys(t, log, "key")
+
+	modeOf := func(name string) os.FileMode {
+		t.Helper()
+		info, err := os.Stat(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return info.Mode().Perm()
+	}
+
+	backup := filepath.Join(dir, "backup.log")
+	if _, err := log.Backup(backup); err != nil {
+		t.Fatal(err)
+	}
+	if mode := modeOf(backup); mode != 0640 {
+		t.Errorf("Backup wrote mode %o, want 640", mode)
+	}
+
+	if err := os.Chmod(name, 0604); err != nil {
+		t.Fatal(err)
+	}
+	copied := filepath.Join(dir, "copy.log")
+	if _, err := BackupLog(name, copied); err != nil {
+		t.Fatal(err)
+	}
+	if mode := modeOf(copied); mode != 0604 {
+		t.Errorf("BackupLog wrote mode %o, want the log's 604", mode)
+	}
+
+	restored := filepath.Join(dir, "restored.log")
+	if err := RestoreLog(backup, restored); err != nil {
+		t.Fatal(err)
+	}
+	if mode := modeOf(restored); mode != 0640 {
+		t.Errorf("RestoreLog wrote mode %o, want the backup's 640", mode)
+	}
+}
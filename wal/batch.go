@@ -0,0 +1,239 @@
+package wal
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+)
+
+// Batch is a run of consecutive records in their on-disk encoding, as read
+// by ReadBatch for shipping to a replica
+type Batch struct {
+	Version  uint32 // format version the records are encoded in
+	FirstLSN uint64
+	LastLSN  uint64
+	Count    int
+	Data     []byte // encoded records, back to back, without padding
+}
+
+// batchPosition remembers where the last batch ended, so that a replica
+// reading the log in order does not make ReadBatch rescan it
+type batchPosition struct {
+	lsn    uint64 // LSN following the last batch
+	offset int64  // offset following the last batch
+}
+
+// RecordFilter selects the records ReadBatchFiltered returns. The zero
+// value selects every record.
+type RecordFilter struct {
+	Operations []string // operations to select; empty selects all
+	KeyPrefix  string   // select only key-value operations on keys with this prefix
+}
+
+// match reports whether the filter selects the record. The operation is
+// checked before the key is looked at, and the key is read in place.
+func (f RecordFilter) match(record LogRecord) bool {
+	if len(f.Operations) > 0 {
+		found := false
+		for _, op := range f.Operations {
+			if op == record.Operation {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if f.KeyPrefix == "" {
+		return true
+	}
+
+	key, ok := recordKey(record)
+	return ok && strings.HasPrefix(key, f.KeyPrefix)
+}
+
+// ReadBatch returns up to maxCount records, and up to maxBytes of encoded
+// data, starting at fromLSN. A first record larger than maxBytes is still
+// returned. Zero or negative limits mean no limit. Only records of finished
+// transactions are returned; the batch is empty when there are none at or
+// after fromLSN.
+func (wal *WAL) ReadBatch(fromLSN uint64, maxBytes, maxCount int) (*Batch, error) {
+	return wal.ReadBatchFiltered(fromLSN, maxBytes, maxCount, RecordFilter{})
+}
+
+// ReadBatchFiltered is ReadBatch returning only the records filter selects;
+// the limits count selected records only. Records skipped by the filter are
+// never re-encoded into the batch. LastLSN is the last record read, selected
+// or not, so the next batch should start after it even when Count is zero.
+func (wal *WAL) ReadBatchFiltered(fromLSN uint64, maxBytes, maxCount int, filter RecordFilter) (*Batch, error) {
+	return wal.readBatch(fromLSN, maxBytes, maxCount, filter, false)
+}
+
+// ReadTransactions is ReadBatch cut only at transaction boundaries, so a
+// consumer never sees part of a transaction: each batch holds whole
+// transactions, with their commit or abort records, and standalone
+// heartbeats. A first transaction larger than the limits is still returned
+// whole. fromLSN should follow the LastLSN of the previous batch.
+func (wal *WAL) ReadTransactions(fromLSN uint64, maxBytes, maxCount int) (*Batch, error) {
+	return wal.readBatch(fromLSN, maxBytes, maxCount, RecordFilter{}, true)
+}
+
+// batchReaders reuses the buffered readers batches are decoded through, so
+// that many consumers reading at once do not each allocate one per batch
+var batchReaders = sync.Pool{
+	New: func() interface{} {
+		return bufio.NewReaderSize(nil, 64<<10)
+	},
+}
+
+// batchView is what a batch read needs of the log, taken under logMutex so
+// that the log can be read without it
+type batchView struct {
+	src      io.ReaderAt
+	size     int64
+	version  uint32
+	lastLSN  uint64 // last record of a finished transaction, or earlier
+	offset   int64  // where to start reading
+	rewrites uint64
+}
+
+// readBatch implements ReadBatchFiltered and ReadTransactions. The log is
+// read without holding logMutex, with positioned reads, so batch reads
+// neither wait for one another nor hold up appends. A read that overlaps a
+// rewrite of the log is thrown away and done again.
+func (wal *WAL) readBatch(fromLSN uint64, maxBytes, maxCount int, filter RecordFilter, whole bool) (*Batch, error) {
+	for {
+		wal.logMutex.Lock()
+		if fromLSN <= wal.baseLSN {
+			err := fmt.Errorf("%w: %d precedes the first record (%d)", ErrLSNOutOfRange, fromLSN, wal.baseLSN+1)
+			wal.logMutex.Unlock()
+			return nil, err
+		}
+		view := batchView{
+			src:      wal.logReaderAt(),
+			size:     wal.logSize,
+			version:  wal.logVersion,
+			lastLSN:  wal.currentLSN - uint64(len(wal.records)),
+			offset:   headerSize,
+			rewrites: wal.rewrites,
+		}
+		if wal.batchHint.lsn == fromLSN && wal.batchHint.offset != 0 {
+			view.offset = wal.batchHint.offset
+		}
+		wal.logMutex.Unlock()
+
+		batch, end, err := view.read(fromLSN, maxBytes, maxCount, filter, whole)
+
+		wal.logMutex.Lock()
+		if wal.rewrites != view.rewrites {
+			wal.logMutex.Unlock()
+			continue
+		}
+		if err == nil && batch.LastLSN != 0 {
+			wal.batchHint = batchPosition{lsn: batch.LastLSN + 1, offset: end}
+		}
+		wal.logMutex.Unlock()
+		return batch, err
+	}
+}
+
+// read reads a batch from the view and returns it with the offset
+// following it
+func (view batchView) read(fromLSN uint64, maxBytes, maxCount int, filter RecordFilter, whole bool) (*Batch, int64, error) {
+	batch := &Batch{Version: view.version}
+	lastLSN := view.lastLSN
+	if fromLSN > lastLSN {
+		return batch, 0, nil
+	}
+
+	offset := view.offset
+	r := batchReaders.Get().(*bufio.Reader)
+	r.Reset(io.NewSectionReader(view.src, offset, view.size-offset))
+	defer func() {
+		r.Reset(nil)
+		batchReaders.Put(r)
+	}()
+
+	// The batch as of the last transaction boundary, and where it ended
+	var boundary Batch
+	var boundaryOffset int64
+	open := false
+
+	for {
+		record, n, err := readRecord(r, view.version)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, 0, err
+		}
+		// Skip padding and records written twice by a retried append
+		if record.Operation == opPad || record.LSN < fromLSN || (batch.LastLSN != 0 && record.LSN <= batch.LastLSN) {
+			offset += int64(n)
+			continue
+		}
+		if record.LSN > lastLSN {
+			break
+		}
+		full := (maxCount > 0 && batch.Count >= maxCount) ||
+			(maxBytes > 0 && batch.Count > 0 && filter.match(record) && len(batch.Data)+n > maxBytes)
+		if full && !whole {
+			break
+		}
+		if full && boundary.LastLSN != 0 {
+			*batch, offset = boundary, boundaryOffset
+			break
+		}
+
+		if filter.match(record) {
+			if batch.Count == 0 {
+				batch.FirstLSN = record.LSN
+			}
+			batch.Count++
+			batch.Data = append(batch.Data, encodeRecord(record, view.version)...)
+		}
+		batch.LastLSN = record.LSN
+		offset += int64(n)
+
+		switch record.Operation {
+		case opCommit, opAbort:
+			open = false
+		case opNoop, opChain, opConfig:
+		default:
+			open = true
+		}
+		if whole && !open {
+			boundary, boundaryOffset = *batch, offset
+		}
+	}
+	if whole && open {
+		*batch, offset = boundary, boundaryOffset
+	}
+
+	return batch, offset, nil
+}
+
+// Records decodes the records in the batch
+func (b *Batch) Records() ([]LogRecord, error) {
+	records := make([]LogRecord, 0, b.Count)
+	r := batchReaders.Get().(*bufio.Reader)
+	r.Reset(bytes.NewReader(b.Data))
+	defer func() {
+		r.Reset(nil)
+		batchReaders.Put(r)
+	}()
+	for {
+		record, _, err := readRecord(r, b.Version)
+		if err == io.EOF {
+			return records, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, record)
+	}
+}
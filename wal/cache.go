@@ -0,0 +1,160 @@
+package wal
+
+import (
+	"container/list"
+	"io"
+	"os"
+	"sync"
+)
+
+// cacheBlockSize is the unit the block cache reads and keeps the log in
+const cacheBlockSize = 64 << 10
+
+// WithBlockCache keeps up to budget bytes of recently read log blocks in
+// memory, shared by all batch reads: ReadBatch, ReadBatchFiltered and
+// ReadTransactions. Followers and replicas catching up over the same part
+// of the log then read it from disk once. Only blocks that have been
+// written in full are cached, and none is used once the log has been
+// rewritten or repaired.
+func WithBlockCache(budget int64) Option {
+	return func(wal *WAL) {
+		if budget > 0 {
+			wal.blockCache = newBlockCache(budget)
+		}
+	}
+}
+
+// blockKey identifies a block of the log as of a number of rewrites and
+// cache resets
+type blockKey struct {
+	resets   uint64
+	rewrites uint64
+	index    int64
+}
+
+// cachedBlock is a block in the cache
+type cachedBlock struct {
+	key  blockKey
+	data []byte
+}
+
+// blockCache is an LRU cache of log blocks
+type blockCache struct {
+	mu     sync.Mutex
+	budget int64
+	size   int64
+	resets uint64     // blocks read before the last reset are never used again
+	lru    *list.List // of *cachedBlock, most recently used first
+	blocks map[blockKey]*list.Element
+}
+
+// newBlockCache returns an empty cache holding up to budget bytes
+func newBlockCache(budget int64) *blockCache {
+	return &blockCache{budget: budget, lru: list.New(), blocks: make(map[blockKey]*list.Element)}
+}
+
+// get returns the cached block for key, if any
+func (c *blockCache) get(key blockKey) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.blocks[key]
+	if !ok {
+		return nil, false
+	}
+	c.lru.MoveToFront(elem)
+	return elem.Value.(*cachedBlock).data, true
+}
+
+// put caches a block, evicting the least recently used ones to stay
+// within the budget
+func (c *blockCache) put(key blockKey, data []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.blocks[key]; ok || int64(len(data)) > c.budget {
+		return
+	}
+	c.blocks[key] = c.lru.PushFront(&cachedBlock{key: key, data: data})
+	c.size += int64(len(data))
+
+	for c.size > c.budget {
+		oldest := c.lru.Back()
+		block := c.lru.Remove(oldest).(*cachedBlock)
+		delete(c.blocks, block.key)
+		c.size -= int64(len(block.data))
+	}
+}
+
+// reset empties the cache
+func (c *blockCache) reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.lru.Init()
+	c.blocks = make(map[blockKey]*list.Element)
+	c.size = 0
+	c.resets++
+}
+
+// generation returns the number of resets so far
+func (c *blockCache) generation() uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.resets
+}
+
+// cachedLog reads the log through the block cache. Blocks are only cached
+// when they lie wholly within size, which the log never changes below
+// without a rewrite.
+type cachedLog struct {
+	cache    *blockCache
+	file     *os.File
+	size     int64
+	resets   uint64
+	rewrites uint64
+}
+
+// ReadAt implements io.ReaderAt
+func (cl cachedLog) ReadAt(p []byte, off int64) (int, error) {
+	n := 0
+	for n < len(p) {
+		pos := off + int64(n)
+		index := pos / cacheBlockSize
+		start := index * cacheBlockSize
+		if start+cacheBlockSize > cl.size {
+			m, err := cl.file.ReadAt(p[n:], pos)
+			return n + m, err
+		}
+
+		key := blockKey{resets: cl.resets, rewrites: cl.rewrites, index: index}
+		data, ok := cl.cache.get(key)
+		if !ok {
+			data = make([]byte, cacheBlockSize)
+			if _, err := cl.file.ReadAt(data, start); err != nil {
+				if err == io.EOF {
+					err = io.ErrUnexpectedEOF
+				}
+				return n, err
+			}
+			cl.cache.put(key, data)
+		}
+		n += copy(p[n:], data[pos-start:])
+	}
+	return n, nil
+}
+
+// logReaderAt returns what to read the log through. The caller must hold
+// logMutex.
+func (wal *WAL) logReaderAt() io.ReaderAt {
+	if wal.blockCache == nil {
+		return wal.file
+	}
+	return cachedLog{
+		cache:    wal.blockCache,
+		file:     wal.file,
+		size:     wal.logSize,
+		resets:   wal.blockCache.generation(),
+		rewrites: wal.rewrites,
+	}
+}
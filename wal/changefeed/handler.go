@@ -0,0 +1,157 @@
+// Package changefeed serves the transactions committed to a WAL over HTTP
+// as Server-Sent Events, so browsers and lightweight consumers can follow
+// the log.
+package changefeed
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/rachitsh92/write-ahead-log/wal"
+)
+
+// defaultHeartbeat is how often Handler sends a heartbeat, unless Heartbeat
+// is set
+const defaultHeartbeat = 15 * time.Second
+
+// Txn is the data of an event: one committed transaction
+type Txn struct {
+	LSN     uint64   `json:"lsn"` // LSN of the commit record
+	Records []Record `json:"records"`
+}
+
+// Record is one record of a Txn
+type Record struct {
+	LSN       uint64   `json:"lsn"`
+	Operation string   `json:"op"`
+	Key       string   `json:"key,omitempty"`
+	Fields    []string `json:"fields,omitempty"` // the decoded data of key-value operations
+	Data      string   `json:"data,omitempty"`   // the data of other operations
+}
+
+// Handler streams committed transactions as events of type "txn", whose
+// ID is the commit LSN and whose data is a JSON Txn. The stream starts
+// after the LSN in the Last-Event-ID header, so a reconnecting EventSource
+// resumes where it left off, or else at the LSN in the "from" query
+// parameter, or else at the start of the log. A comment is sent every
+// Heartbeat, by the WAL's clock, while there is nothing to send, to keep
+// proxies from closing the connection.
+type Handler struct {
+	WAL       *wal.WAL
+	Heartbeat time.Duration // zero means 15 seconds
+}
+
+// ServeHTTP implements http.Handler
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	from, err := startLSN(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+
+	txns := make(chan wal.CommittedTxn)
+	failed := make(chan error, 1)
+	go func() {
+		failed <- h.WAL.Follow(ctx, from, func(txn wal.CommittedTxn) error {
+			select {
+			case txns <- txn:
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		})
+	}()
+
+	interval := h.Heartbeat
+	if interval <= 0 {
+		interval = defaultHeartbeat
+	}
+	// Heartbeats follow the WAL's clock
+	clock := h.WAL.Clock()
+	heartbeat := clock.NewTicker(interval)
+	defer func() { heartbeat.Stop() }()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case err := <-failed:
+			if ctx.Err() == nil {
+				fmt.Fprintf(w, "event: error\ndata: %s\n\n", strconv.Quote(err.Error()))
+				flusher.Flush()
+			}
+			return
+		case <-heartbeat.C():
+			if _, err := fmt.Fprint(w, ": heartbeat\n\n"); err != nil {
+				return
+			}
+		case txn := <-txns:
+			if len(txn.Records) == 0 {
+				continue
+			}
+			data, err := json.Marshal(encodeTxn(txn))
+			if err != nil {
+				return
+			}
+			if _, err := fmt.Fprintf(w, "id: %d\nevent: txn\ndata: %s\n\n", txn.LSN, data); err != nil {
+				return
+			}
+			heartbeat.Stop()
+			heartbeat = clock.NewTicker(interval)
+		}
+		flusher.Flush()
+	}
+}
+
+// startLSN returns the LSN the stream requested by r starts at
+func startLSN(r *http.Request) (uint64, error) {
+	if id := r.Header.Get("Last-Event-ID"); id != "" {
+		lsn, err := strconv.ParseUint(id, 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("bad Last-Event-ID %q", id)
+		}
+		return lsn + 1, nil
+	}
+	if from := r.URL.Query().Get("from"); from != "" {
+		lsn, err := strconv.ParseUint(from, 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("bad from %q", from)
+		}
+		return lsn, nil
+	}
+	return 1, nil
+}
+
+// encodeTxn converts a transaction to the data of its event
+func encodeTxn(txn wal.CommittedTxn) Txn {
+	t := Txn{LSN: txn.LSN, Records: make([]Record, 0, len(txn.Records))}
+	for _, r := range txn.Records {
+		record := Record{LSN: r.LSN, Operation: r.Operation}
+		if key, ok := r.Key(); ok {
+			record.Key = key
+			record.Fields, _ = r.Fields()
+		} else {
+			record.Data = r.Data
+		}
+		t.Records = append(t.Records, record)
+	}
+	return t
+}
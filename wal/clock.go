@@ -0,0 +1,65 @@
+package wal
+
+import "time"
+
+// Clock is the source of time for the WAL: TTL expiry, the expiry worker's
+// interval, commit timings, recovery progress and injected latency all read
+// it, as do the changefeed heartbeat and NATS sink retries, so tests can
+// substitute a fake clock and run deterministically
+type Clock interface {
+	Now() time.Time
+	NewTicker(d time.Duration) Ticker
+}
+
+// Ticker delivers ticks from a Clock
+type Ticker interface {
+	C() <-chan time.Time
+	Stop()
+}
+
+// WithClock replaces the system clock
+func WithClock(clock Clock) Option {
+	return func(wal *WAL) {
+		wal.clock = clock
+	}
+}
+
+// Clock returns the clock the WAL reads time from, for packages built on
+// the WAL to wait on
+func (wal *WAL) Clock() Clock {
+	return wal.clock
+}
+
+// sleep waits for d to pass on the WAL's clock
+func (wal *WAL) sleep(d time.Duration) {
+	if d <= 0 {
+		return
+	}
+	ticker := wal.clock.NewTicker(d)
+	<-ticker.C()
+	ticker.Stop()
+}
+
+// systemClock is the Clock backed by package time
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+func (systemClock) NewTicker(d time.Duration) Ticker {
+	return systemTicker{time.NewTicker(d)}
+}
+
+// systemTicker adapts a time.Ticker to Ticker
+type systemTicker struct {
+	ticker *time.Ticker
+}
+
+func (t systemTicker) C() <-chan time.Time {
+	return t.ticker.C
+}
+
+func (t systemTicker) Stop() {
+	t.ticker.Stop()
+}
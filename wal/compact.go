@@ -0,0 +1,154 @@
+package wal
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// compactSuffix names the file Compact writes before replacing the log
+const compactSuffix = ".compact"
+
+// CompactionFilter decides what Compact does with a record: it returns the
+// record to keep, possibly changed, and true, or false to drop it
+type CompactionFilter func(record LogRecord) (LogRecord, bool)
+
+// Compact rewrites the log, passing every record that was written by a
+// caller through filter, e.g. to drop expired or superseded data. Dropped
+// records leave a redaction marker so LSNs and any hash chain stay valid;
+// a record covered by a hash chain can be dropped but not changed.
+// Transaction markers and other records the WAL writes for itself are kept
+// as they are. The database is rebuilt from the compacted log, and the
+// mirrors are rewritten from it. It returns the number of records dropped
+// or changed.
+func (wal *WAL) Compact(filter CompactionFilter) (int, error) {
+	wal.logMutex.Lock()
+	defer wal.logMutex.Unlock()
+
+	if len(wal.records) > 0 {
+		return 0, ErrTransactionInProgress
+	}
+	if err := wal.checkEpoch(); err != nil {
+		return 0, err
+	}
+
+	// Nothing queued may be applied on top of the rebuilt database
+	wal.drainApplier()
+
+	r := bufio.NewReader(io.NewSectionReader(wal.file, 0, wal.logSize))
+	header, err := readHeader(r)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", wal.file.Name(), err)
+	}
+
+	records := []byte{}
+	changed := 0
+	chained := false
+	for {
+		record, _, err := readRecord(r, header.Version)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return 0, err
+		}
+		if record.Operation == opPad {
+			continue
+		}
+		if record.Operation == opChain {
+			chained = true
+		}
+
+		if !walRecord(record.Operation) {
+			kept, keep := filter(record)
+			switch {
+			case !keep:
+				marker := LogRecord{LSN: record.LSN, Term: record.Term, Operation: opRedacted}
+				if chained {
+					sum := sha256.Sum256(encodeRecord(record, header.Version))
+					marker.Data = string(sum[:])
+				}
+				record = marker
+				changed++
+			case kept.Operation != record.Operation || kept.Data != record.Data:
+				if chained {
+					return 0, fmt.Errorf("%w: compaction changed the record at LSN %d", ErrChainBroken, record.LSN)
+				}
+				record.Operation, record.Data = kept.Operation, kept.Data
+				changed++
+			}
+			record.CRC32 = recordChecksum(record)
+		}
+
+		frame := encodeRecord(record, header.Version)
+		if pad := wal.paddingAt(headerSize+int64(len(records)), len(frame)); pad != nil {
+			records = append(records, pad...)
+		}
+		records = append(records, frame...)
+	}
+	if changed == 0 {
+		return 0, nil
+	}
+
+	name := wal.file.Name()
+	tmpName := name + compactSuffix
+	if err := wal.writeRetained(tmpName, encodeHeader(header), bytes.NewReader(records)); err != nil {
+		os.Remove(tmpName)
+		return 0, err
+	}
+	if err := os.Rename(tmpName, name); err != nil {
+		os.Remove(tmpName)
+		return 0, err
+	}
+	if err := syncDir(filepath.Dir(name)); err != nil {
+		return 0, err
+	}
+
+	file, err := os.OpenFile(name, os.O_APPEND|os.O_RDWR, 0)
+	if err != nil {
+		return 0, err
+	}
+	wal.file.Close()
+	wal.file = file
+	wal.rewrites++
+	wal.batchHint = batchPosition{}
+
+	wal.applying.Lock()
+	defer wal.applying.Unlock()
+	wal.resetDB()
+	if err := wal.restoreLog(context.Background(), nil); err != nil {
+		return 0, err
+	}
+
+	// Mirrors are rewritten from the new log
+	for _, m := range wal.mirrors {
+		if m.failed != nil {
+			continue
+		}
+		if err := m.file.Truncate(0); err != nil {
+			m.failed = err
+			continue
+		}
+		if err := alignMirror(wal.file, m.file); err != nil {
+			m.failed = err
+		}
+	}
+
+	lsn := wal.CommittedLSN()
+	wal.queuedLSN = lsn
+	return changed, wal.flushDB(lsn)
+}
+
+// walRecord reports whether operation is one the WAL writes for itself
+func walRecord(operation string) bool {
+	switch operation {
+	case opBegin, opCommit, opAbort, opCheck, opNoop, opChain, opRedacted, opConfig:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,91 @@
+package wal
+
+import (
+	"errors"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// TestCompact drops and changes records with a filter and checks that the
+// database is rebuilt from the result and replaying the log agrees
+func TestCompact(t *testing.T) {
+	filename := filepath.Join(inTempDir(t), "wal.log")
+	log, err := NewWAL(filename, WithMirrors(1, filepath.Join(filepath.Dir(filename), "mirror.log")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer log.Close()
+	commitKeys(t, log, "keep", "drop", "change")
+
+	n, err := log.Compact(func(record LogRecord) (LogRecord, bool) {
+		switch key, _ := recordKey(record); key {
+		case "drop":
+			return record, false
+		case "change":
+			record.Data = encodeFields(key, "changed")
+		}
+		return record, true
+	})
+	if err != nil {
+		t.Fatalf("Compact: %v", err)
+	}
+	if n != 2 {
+		t.Errorf("Compact changed %d records, want 2", n)
+	}
+	want := map[string]string{"keep": "v", "change": "changed"}
+	if got := readAll(log); !reflect.DeepEqual(got, want) {
+		t.Errorf("compacted database %v, want %v", got, want)
+	}
+
+	// The log carries on after compaction
+	commitKeys(t, log, "after")
+	want["after"] = "v"
+	lsn := log.CommittedLSN()
+	log.Close()
+
+	for _, name := range []string{filename, filepath.Join(filepath.Dir(filename), "mirror.log")} {
+		if err := VerifyLog(name); err != nil {
+			t.Fatalf("VerifyLog: %v", err)
+		}
+		got, gotLSN := replayLog(t, name)
+		if !reflect.DeepEqual(got, want) || gotLSN != lsn {
+			t.Errorf("%s replays to %v at LSN %d, want %v at LSN %d", filepath.Base(name), got, gotLSN, want, lsn)
+		}
+	}
+}
+
+// TestCompactHashChain checks that records under a hash chain can be
+// dropped, but not changed
+func TestCompactHashChain(t *testing.T) {
+	filename := filepath.Join(inTempDir(t), "wal.log")
+	log, err := NewWAL(filename, WithHashChain())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer log.Close()
+	commitKeys(t, log, "keep", "drop")
+
+	_, err = log.Compact(func(record LogRecord) (LogRecord, bool) {
+		record.Data = encodeFields("keep", "changed")
+		return record, true
+	})
+	if !errors.Is(err, ErrChainBroken) {
+		t.Errorf("changing a chained record: got %v, want ErrChainBroken", err)
+	}
+
+	if _, err := log.Compact(func(record LogRecord) (LogRecord, bool) {
+		key, _ := recordKey(record)
+		return record, key != "drop"
+	}); err != nil {
+		t.Fatalf("Compact: %v", err)
+	}
+	log.Close()
+
+	if err := VerifyLog(filename); err != nil {
+		t.Fatalf("VerifyLog: %v", err)
+	}
+	if got, _ := replayLog(t, filename); !reflect.DeepEqual(got, map[string]string{"keep": "v"}) {
+		t.Errorf("compacted log replays to %v", got)
+	}
+}
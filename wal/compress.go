@@ -0,0 +1,239 @@
+package wal
+
+import (
+	"bytes"
+	"compress/flate"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"strings"
+	"sync"
+)
+
+// compressedFlag is set in the data length of a version 4 or later frame
+// whose data is compressed. Lengths never come near it, as they are bounded by
+// maxFieldSize, so earlier versions reject such a frame as corrupt.
+const compressedFlag uint32 = 1 << 31
+
+// compressedVersion is the first format version that can hold compressed data
+const compressedVersion uint32 = 4
+
+// dictionaryFlag is set, with compressedFlag, in the data length of a
+// version 5 frame whose data was compressed with a preset dictionary. The
+// data then starts with the ID of the dictionary, the CRC32 of its bytes.
+const dictionaryFlag uint32 = 1 << 30
+
+// dictionaryVersion is the first format version that can hold data
+// compressed with a preset dictionary
+const dictionaryVersion uint32 = 5
+
+// maxDictionarySize is the most of a dictionary DEFLATE can use, the size of
+// its window
+const maxDictionarySize = 32 << 10
+
+// ErrUnknownDictionary is returned when reading a record compressed with a
+// dictionary that has not been registered in this process
+var ErrUnknownDictionary = errors.New("wal: unknown compression dictionary")
+
+// dictionaries holds the registered dictionaries by ID
+var dictionaries sync.Map
+
+// dictionary is a registered preset dictionary
+type dictionary struct {
+	id      uint32
+	data    []byte
+	writers sync.Pool // compressors primed with data
+}
+
+// flateWriters reuses compressors, which are expensive to allocate
+var flateWriters = sync.Pool{
+	New: func() interface{} {
+		w, _ := flate.NewWriter(nil, flate.BestSpeed)
+		return w
+	},
+}
+
+// WithCompression compresses the data of records of at least threshold
+// bytes, with DEFLATE, and stores it compressed when that makes it smaller.
+// Smaller records are not worth the CPU, and would often grow. Whether a
+// record is compressed is marked in its frame; readers decompress it
+// transparently, and its checksum covers the uncompressed data. Logs
+// created before format version 4 are never compressed.
+func WithCompression(threshold int) Option {
+	return func(wal *WAL) {
+		wal.compressAbove = threshold
+	}
+}
+
+// WithCompressionDictionary primes the compression of WithCompression with
+// dict, which holds data typical of the records, e.g. from
+// TrainDictionary. Small structured records, which barely compress on
+// their own, then compress well. Only the last 32 KiB of dict are used.
+//
+// Records compressed with a dictionary can only be read where it is known:
+// by a WAL opened with this option, or in a process that has called
+// RegisterCompressionDictionary with it, which tools such as VerifyLog and
+// BackupLog, and followers fed by ReadBatch, need. Reading them elsewhere
+// fails with ErrUnknownDictionary. Keep every dictionary a log has been
+// written with for as long as the log and its copies are kept. Logs created
+// before format version 5 are compressed without the dictionary.
+func WithCompressionDictionary(dict []byte) Option {
+	return func(wal *WAL) {
+		wal.dictData = dict
+	}
+}
+
+// RegisterCompressionDictionary makes dict known to this process, so that
+// records compressed with it can be read. It fails if dict is empty or
+// larger than 32 KiB, or if its ID is taken by a different dictionary.
+func RegisterCompressionDictionary(dict []byte) error {
+	_, err := registerDictionary(dict)
+	return err
+}
+
+// registerDictionary registers dict, if it is not already, and returns it
+func registerDictionary(dict []byte) (*dictionary, error) {
+	if len(dict) == 0 || len(dict) > maxDictionarySize {
+		return nil, fmt.Errorf("wal: a compression dictionary must hold 1 to %d bytes, not %d", maxDictionarySize, len(dict))
+	}
+
+	d := &dictionary{id: crc32.ChecksumIEEE(dict), data: append([]byte(nil), dict...)}
+	d.writers.New = func() interface{} {
+		// Faster levels store short inputs as they are, without using the
+		// dictionary, and short records are what dictionaries are for
+		w, _ := flate.NewWriterDict(nil, flate.BestCompression, d.data)
+		return w
+	}
+	actual, loaded := dictionaries.LoadOrStore(d.id, d)
+	if loaded && !bytes.Equal(actual.(*dictionary).data, d.data) {
+		return nil, fmt.Errorf("wal: compression dictionary %08x is taken by a different dictionary", d.id)
+	}
+	return actual.(*dictionary), nil
+}
+
+// TrainDictionary builds a dictionary for WithCompressionDictionary from the
+// most recent records callers wrote to the log at filename, which may be in
+// use. Each distinct record data is sampled once, the newest last, where
+// DEFLATE refers to it most cheaply, up to size bytes; zero or more than
+// 32 KiB means 32 KiB. A damaged or partly written tail ends the sample.
+func TrainDictionary(filename string, size int) ([]byte, error) {
+	if size <= 0 || size > maxDictionarySize {
+		size = maxDictionarySize
+	}
+	lr, err := OpenLogReader(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer lr.Close()
+
+	var samples []string
+	sampled := make(map[string]bool)
+	total := 0
+	for {
+		record, err := lr.Next()
+		if err == io.EOF || errors.Is(err, ErrCorruptRecord) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if walRecord(record.Operation) || record.Data == "" || sampled[record.Data] {
+			continue
+		}
+
+		samples = append(samples, record.Data)
+		sampled[record.Data] = true
+		total += len(record.Data)
+		for total-len(samples[0]) >= size {
+			total -= len(samples[0])
+			delete(sampled, samples[0])
+			samples = samples[1:]
+		}
+	}
+	if total == 0 {
+		return nil, fmt.Errorf("wal: %s: no records to train a dictionary on", filename)
+	}
+
+	dict := []byte(strings.Join(samples, ""))
+	if len(dict) > size {
+		dict = dict[len(dict)-size:]
+	}
+	return dict, nil
+}
+
+// compressRecord compresses record's data if the WAL compresses records of
+// its size and compression makes it smaller. A record that is already
+// compressed, e.g. one replicated from a primary, is left alone.
+func (wal *WAL) compressRecord(record *LogRecord) {
+	if wal.compressAbove <= 0 || wal.logVersion < compressedVersion {
+		return
+	}
+	if len(record.Data) < wal.compressAbove || record.compressed() {
+		return
+	}
+
+	var buf bytes.Buffer
+	writers := &flateWriters
+	dict := wal.dict
+	if dict != nil && wal.logVersion >= dictionaryVersion {
+		writers = &dict.writers
+		buf.Write(uint32ToBytes(dict.id))
+	} else {
+		dict = nil
+	}
+	w := writers.Get().(*flate.Writer)
+	w.Reset(&buf)
+	io.WriteString(w, record.Data)
+	err := w.Close()
+	writers.Put(w)
+	if err != nil || buf.Len() >= len(record.Data) {
+		return
+	}
+
+	record.packed = buf.String()
+	record.unpacked = record.Data
+	record.packedDict = dict != nil
+}
+
+// compressed reports whether record will be stored compressed. A record
+// whose data has been replaced since it was compressed is stored as is.
+func (record LogRecord) compressed() bool {
+	return record.packed != "" && record.unpacked == record.Data
+}
+
+// decompress returns the data a compressed frame holds. With packedDict,
+// packed starts with the ID of the dictionary it was compressed with.
+func decompress(packed string, packedDict bool, lsn uint64) (string, error) {
+	var r io.ReadCloser
+	if packedDict {
+		if len(packed) < 4 {
+			return "", fmt.Errorf("%w: truncated dictionary ID at LSN %d", ErrCorruptRecord, lsn)
+		}
+		id := bytesToUint32([]byte(packed[:4]))
+		d, ok := dictionaries.Load(id)
+		if !ok {
+			return "", fmt.Errorf("%w: %08x, used at LSN %d", ErrUnknownDictionary, id, lsn)
+		}
+		r = flate.NewReaderDict(strings.NewReader(packed[4:]), d.(*dictionary).data)
+	} else {
+		r = flate.NewReader(strings.NewReader(packed))
+	}
+	defer r.Close()
+
+	var buf strings.Builder
+	n, err := io.Copy(&buf, io.LimitReader(r, maxFieldSize+1))
+	if err != nil {
+		return "", fmt.Errorf("%w: undecodable compressed data at LSN %d: %v", ErrCorruptRecord, lsn, err)
+	}
+	if n > maxFieldSize {
+		return "", fmt.Errorf("%w: implausible compressed data at LSN %d", ErrCorruptRecord, lsn)
+	}
+	return buf.String(), nil
+}
+
+// sameRecord reports whether two records hold the same contents, however
+// they are stored
+func sameRecord(a, b LogRecord) bool {
+	return a.LSN == b.LSN && a.Term == b.Term && a.Operation == b.Operation && a.Data == b.Data && a.CRC32 == b.CRC32
+}
@@ -0,0 +1,146 @@
+package wal
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// commitOrders commits n small structured records, alike but for their
+// numbers
+func commitOrders(t *testing.T, log *WAL, first, n int) {
+	t.Helper()
+	for i := first; i < first+n; i++ {
+		value := fmt.Sprintf(`{"order_id":%d,"customer":"customer-%d","status":"shipped","currency":"EUR","warehouse":"central"}`, i, i%7)
+		if err := log.Put(fmt.Sprintf("order/%d", i), value); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := log.Commit(); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// TestCompressionDictionary trains a dictionary on one log, and checks that
+// a log compressed with it is smaller than without, and replays the same
+func TestCompressionDictionary(t *testing.T) {
+	dir := inTempDir(t)
+	sample := filepath.Join(dir, "sample.log")
+	log, err := NewWAL(sample)
+	if err != nil {
+		t.Fatal(err)
+	}
+	commitOrders(t, log, 0, 100)
+	log.Close()
+	dict, err := TrainDictionary(sample, 4096)
+	if err != nil {
+		t.Fatalf("TrainDictionary: %v", err)
+	}
+	if len(dict) == 0 || len(dict) > 4096 {
+		t.Fatalf("trained a dictionary of %d bytes", len(dict))
+	}
+
+	sizes := make(map[string]int)
+	for name, opts := range map[string][]Option{
+		"plain.log": {WithCompression(1)},
+		"dict.log":  {WithCompression(1), WithCompressionDictionary(dict)},
+	} {
+		filename := filepath.Join(dir, name)
+		log, err := NewWAL(filename, opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		commitOrders(t, log, 1000, 100)
+		want := readAll(log)
+		log.Close()
+		sizes[name] = len(mustRead(t, filename))
+
+		if err := VerifyLog(filename); err != nil {
+			t.Fatalf("VerifyLog: %v", err)
+		}
+		if got, _ := replayLog(t, filename); !reflect.DeepEqual(got, want) {
+			t.Errorf("%s replays to a different database", name)
+		}
+	}
+	if sizes["dict.log"] >= sizes["plain.log"] {
+		t.Errorf("with a dictionary the log takes %d bytes, without %d", sizes["dict.log"], sizes["plain.log"])
+	}
+}
+
+// TestUnknownDictionary checks that a log whose dictionary is unknown fails
+// to open, rather than being cut short as if damaged
+func TestUnknownDictionary(t *testing.T) {
+	filename := filepath.Join(inTempDir(t), "wal.log")
+	dict := []byte(`{"order_id":0,"customer":"unknown-dictionary-test","status":"shipped"}`)
+	log, err := NewWAL(filename, WithCompression(1), WithCompressionDictionary(dict))
+	if err != nil {
+		t.Fatal(err)
+	}
+	commitOrders(t, log, 0, 3)
+	log.Close()
+
+	// Point the records at a dictionary nobody registered
+	buf := mustRead(t, filename)
+	id := uint32ToBytes(crc32.ChecksumIEEE(dict))
+	if !bytes.Contains(buf, id) {
+		t.Fatal("no record was compressed with the dictionary")
+	}
+	buf = bytes.ReplaceAll(buf, id, uint32ToBytes(crc32.ChecksumIEEE(dict)+1))
+	if err := os.WriteFile(filename, buf, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := NewWAL(filename); !errors.Is(err, ErrUnknownDictionary) {
+		t.Fatalf("NewWAL: got %v, want ErrUnknownDictionary", err)
+	}
+	if after := mustRead(t, filename); !bytes.Equal(after, buf) {
+		t.Error("opening the log changed it")
+	}
+}
+
+// TestDictionaryOlderFormat checks that a version 4 log is compressed
+// without the dictionary, which it has no way to mark
+func TestDictionaryOlderFormat(t *testing.T) {
+	filename := filepath.Join(inTempDir(t), "wal.log")
+	if err := writeLog(filename, logHeader{Version: 4}, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	dict := []byte(`{"order_id":0,"customer":"older-format-test","status":"shipped"}`)
+	log, err := NewWAL(filename, WithCompression(1), WithCompressionDictionary(dict))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := log.Put("long", strings.Repeat("compressible ", 100)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := log.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	log.Close()
+
+	header, records, err := parseFramedLog(mustRead(t, filename))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if header.Version != 4 {
+		t.Fatalf("log is at version %d", header.Version)
+	}
+	compressed := 0
+	for _, record := range records {
+		if record.packedDict {
+			t.Errorf("record %d of a version 4 log uses the dictionary", record.LSN)
+		}
+		if record.compressed() {
+			compressed++
+		}
+	}
+	if compressed == 0 {
+		t.Error("nothing was compressed")
+	}
+}
@@ -0,0 +1,223 @@
+package wal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// inTempDir runs the rest of the test in a new temporary directory, as the
+// WAL saves its database snapshot in the working directory
+func inTempDir(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+	return dir
+}
+
+// readAll returns every key and value a read-only transaction sees
+func readAll(wal *WAL) map[string]string {
+	db := make(map[string]string)
+	wal.BeginReadOnly().Scan("", func(key, value string) bool {
+		db[key] = value
+		return true
+	})
+	return db
+}
+
+// TestConcurrentUse commits through CommitTxn and the open transaction
+// while batch readers, a follower and read-only transactions run, then
+// checks that the log verifies and replays to the same state. Run it with
+// -race.
+func TestConcurrentUse(t *testing.T) {
+	const (
+		committers = 4
+		perWriter  = 100
+	)
+	name := filepath.Join(inTempDir(t), "wal.log")
+
+	log, err := NewWAL(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var writers, readers sync.WaitGroup
+	errs := make(chan error, 16)
+	done := make(chan struct{})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// CommitTxn from several goroutines, each transaction writing a key of
+	// its own and bumping a shared counter
+	for w := 0; w < committers; w++ {
+		w := w
+		writers.Add(1)
+		go func() {
+			defer writers.Done()
+			for i := 0; i < perWriter; i++ {
+				txn := &Txn{}
+				txn.Put(fmt.Sprintf("txn/%d/%d", w, i), strconv.Itoa(i))
+				txn.Increment("counter", 1)
+				for {
+					_, err := log.CommitTxn(txn)
+					if errors.Is(err, ErrTransactionInProgress) {
+						continue
+					}
+					if err != nil {
+						errs <- fmt.Errorf("CommitTxn: %w", err)
+						return
+					}
+					break
+				}
+			}
+		}()
+	}
+
+	// The open transaction, through Put and Commit
+	writers.Add(1)
+	go func() {
+		defer writers.Done()
+		for i := 0; i < perWriter; i++ {
+			if err := log.Put(fmt.Sprintf("put/%d", i), strings.Repeat("p", i)); err != nil {
+				errs <- fmt.Errorf("Put: %w", err)
+				return
+			}
+			if _, err := log.Commit(); err != nil {
+				errs <- fmt.Errorf("Commit: %w", err)
+				return
+			}
+		}
+	}()
+
+	// Batch reads always decode, in LSN order
+	readers.Add(1)
+	go func() {
+		defer readers.Done()
+		from := uint64(1)
+		for {
+			select {
+			case <-done:
+				return
+			default:
+			}
+			batch, err := log.ReadBatch(from, 4<<10, 0)
+			if err != nil {
+				errs <- fmt.Errorf("ReadBatch: %w", err)
+				return
+			}
+			records, err := batch.Records()
+			if err != nil {
+				errs <- fmt.Errorf("Batch.Records: %w", err)
+				return
+			}
+			for _, record := range records {
+				if record.LSN < from {
+					errs <- fmt.Errorf("ReadBatch from %d returned LSN %d", from, record.LSN)
+					return
+				}
+				from = record.LSN + 1
+			}
+		}
+	}()
+
+	// Read-only transactions see each transaction whole or not at all
+	readers.Add(1)
+	go func() {
+		defer readers.Done()
+		for {
+			select {
+			case <-done:
+				return
+			default:
+			}
+			txn := log.BeginReadOnly()
+			keys := 0
+			txn.Scan("txn/", func(string, string) bool {
+				keys++
+				return true
+			})
+			counter, _ := txn.Get("counter")
+			if want := strconv.Itoa(keys); keys > 0 && counter != want {
+				errs <- fmt.Errorf("read-only transaction at LSN %d sees %d keys but counter %q", txn.LSN(), keys, counter)
+				return
+			}
+		}
+	}()
+
+	// The follower sees every commit once, in order
+	followed := make(chan int, 1)
+	go func() {
+		count, last := 0, uint64(0)
+		err := log.Follow(ctx, 1, func(txn CommittedTxn) error {
+			if txn.LSN <= last {
+				return fmt.Errorf("Follow went from LSN %d back to %d", last, txn.LSN)
+			}
+			count, last = count+1, txn.LSN
+			if count == committers*perWriter+perWriter {
+				return errFollowDone
+			}
+			return nil
+		})
+		if !errors.Is(err, errFollowDone) {
+			errs <- fmt.Errorf("Follow: %w", err)
+		}
+		followed <- count
+	}()
+
+	writers.Wait()
+	if count := <-followed; count != committers*perWriter+perWriter {
+		t.Errorf("Follow saw %d transactions, want %d", count, committers*perWriter+perWriter)
+	}
+	close(done)
+	readers.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+	if t.Failed() {
+		log.Close()
+		return
+	}
+
+	want := readAll(log)
+	if got := want["counter"]; got != strconv.Itoa(committers*perWriter) {
+		t.Errorf("counter is %q, want %d", got, committers*perWriter)
+	}
+	if err := log.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := VerifyLog(name); err != nil {
+		t.Fatalf("VerifyLog: %v", err)
+	}
+
+	// Replay, not the snapshot, must rebuild the same state
+	if err := os.Remove(snapshotFile); err != nil {
+		t.Fatal(err)
+	}
+	log, err = NewWAL(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer log.Close()
+	if got := readAll(log); !reflect.DeepEqual(got, want) {
+		t.Errorf("reopened with %d keys, want %d, or values differ", len(got), len(want))
+	}
+}
+
+// errFollowDone stops a follower that has seen every transaction
+var errFollowDone = errors.New("all transactions followed")
@@ -0,0 +1,68 @@
+package wal
+
+import (
+	"errors"
+	"fmt"
+)
+
+// opCheck records a condition that must hold when the transaction commits
+const opCheck = "CHECK"
+
+// ErrConditionFailed is returned by CommitTransaction when a CompareAndSet
+// condition no longer holds; the transaction has been aborted
+var ErrConditionFailed = errors.New("wal: transaction condition failed")
+
+// CompareAndSet sets key to value provided that, at commit time, key still
+// holds expected (a missing key holds ""). Unlike CompareAndSwap, a failed
+// comparison makes CommitTransaction abort the whole transaction.
+func (wal *WAL) CompareAndSet(key, expected, value string) error {
+	wal.logMutex.Lock()
+	defer wal.logMutex.Unlock()
+
+	if err := wal.appendRecord(opCheck, encodeFields(key, expected)); err != nil {
+		return err
+	}
+
+	return wal.appendRecord(OpPut, encodeFields(key, value))
+}
+
+// hasConditions reports whether the current transaction has conditions.
+// The caller must hold logMutex.
+func (wal *WAL) hasConditions() bool {
+	for _, record := range wal.records {
+		if record.Operation == opCheck {
+			return true
+		}
+	}
+	return false
+}
+
+// checkConditions verifies the CompareAndSet conditions of the current
+// transaction against the committed database. The caller must hold logMutex.
+func (wal *WAL) checkConditions() error {
+	if !wal.hasConditions() {
+		return nil
+	}
+
+	// Conditions are checked against every committed transaction
+	wal.drainApplier()
+
+	wal.dbMutex.Lock()
+	defer wal.dbMutex.Unlock()
+
+	for _, record := range wal.records {
+		if record.Operation != opCheck {
+			continue
+		}
+
+		fields, err := decodeFields(record.Data)
+		if err != nil || len(fields) != 2 {
+			return fmt.Errorf("%w: malformed condition at LSN %d", ErrConditionFailed, record.LSN)
+		}
+		if current := wal.inMemoryDB[fields[0]]; current != fields[1] {
+			return fmt.Errorf("%w: %q is %q, expected %q", ErrConditionFailed, fields[0], current, fields[1])
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,291 @@
+package wal
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// configEnvPrefix starts the names of the environment variables that
+// override a Config
+const configEnvPrefix = "WAL_"
+
+// Duration is a time.Duration written in configuration as a string such as
+// "250ms" or "1m30s"
+type Duration time.Duration
+
+// UnmarshalJSON parses a duration string
+func (d *Duration) UnmarshalJSON(buf []byte) error {
+	var s string
+	if err := json.Unmarshal(buf, &s); err != nil {
+		return err
+	}
+	return d.parse(s)
+}
+
+// MarshalJSON writes the duration as a string
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d *Duration) parse(s string) error {
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
+
+// Config holds the options that can be set without code, so a deployment can
+// tune the WAL without recompiling. Zero values leave the defaults alone.
+type Config struct {
+	Mirrors                  []string          `json:"mirrors"`
+	Quorum                   int               `json:"quorum"`
+	AsyncApply               bool              `json:"async_apply"`
+	RecordAlignment          int               `json:"record_alignment"`
+	HashChain                bool              `json:"hash_chain"`
+	CompressAbove            int               `json:"compress_above"`
+	CompressionDictionary    string            `json:"compression_dictionary"` // file holding the dictionary
+	BlockCache               int64             `json:"block_cache"`            // bytes
+	EpochFencing             bool              `json:"epoch_fencing"`
+	Heartbeat                Duration          `json:"heartbeat"`
+	HybridClock              bool              `json:"hybrid_clock"`
+	MaxClockOffset           Duration          `json:"max_clock_offset"`
+	SessionInfo              bool              `json:"session_info"`
+	SessionLabels            map[string]string `json:"session_labels"`
+	DiskQuota                int64             `json:"disk_quota"`
+	PendingLimit             int64             `json:"pending_limit"` // bytes
+	TxnLimit                 int               `json:"txn_limit"`
+	ExpiryInterval           Duration          `json:"expiry_interval"`
+	FileMode                 string            `json:"file_mode"` // octal, e.g. "0640"
+	DirMode                  string            `json:"dir_mode"`
+	FileUID                  *int              `json:"file_uid"`
+	FileGID                  *int              `json:"file_gid"`
+	SnapshotCodec            string            `json:"snapshot_codec"` // binary, text or gob
+	RecoveryProfileThreshold Duration          `json:"recovery_profile_threshold"`
+	RecoveryProfileDir       string            `json:"recovery_profile_dir"`
+}
+
+// LoadConfig reads a Config from the file at path, if path is not empty,
+// then applies overrides from the environment. A file whose name ends in
+// .toml is read as TOML, with the same names as the JSON fields, and any
+// other as JSON. Each field is overridden by the variable named WAL_
+// followed by its JSON name in upper case, e.g. WAL_ASYNC_APPLY=true or
+// WAL_HEARTBEAT=5s. Lists are separated by commas, and labels are written
+// key=value,key=value. Unknown fields in the file are an error, so a
+// misspelt option is not silently ignored.
+//
+// YAML is not read: its implicit typing, e.g. of no or 0640, is easy to get
+// wrong without a full parser, and the module has no dependencies. Convert
+// a YAML file to JSON first.
+func LoadConfig(path string) (*Config, error) {
+	config := &Config{}
+	if path != "" {
+		buf, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		if strings.HasSuffix(path, ".toml") {
+			err = config.decodeTOML(string(buf))
+		} else {
+			dec := json.NewDecoder(bytes.NewReader(buf))
+			dec.DisallowUnknownFields()
+			err = dec.Decode(config)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("wal: %s: %w", path, err)
+		}
+	}
+
+	if err := config.applyEnv(os.LookupEnv); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// Options returns the options the configuration sets, to be passed to
+// NewWAL along with any set in code
+func (c *Config) Options() ([]Option, error) {
+	var opts []Option
+	if len(c.Mirrors) > 0 {
+		quorum := c.Quorum
+		if quorum == 0 {
+			quorum = 1
+		}
+		opts = append(opts, WithMirrors(quorum, c.Mirrors...))
+	}
+	if c.AsyncApply {
+		opts = append(opts, WithAsyncApply())
+	}
+	if c.RecordAlignment > 0 {
+		opts = append(opts, WithRecordAlignment(c.RecordAlignment))
+	}
+	if c.HashChain {
+		opts = append(opts, WithHashChain())
+	}
+	if c.CompressAbove > 0 {
+		opts = append(opts, WithCompression(c.CompressAbove))
+	}
+	if c.CompressionDictionary != "" {
+		dict, err := os.ReadFile(c.CompressionDictionary)
+		if err != nil {
+			return nil, fmt.Errorf("wal: compression_dictionary: %w", err)
+		}
+		opts = append(opts, WithCompressionDictionary(dict))
+	}
+	if c.BlockCache > 0 {
+		opts = append(opts, WithBlockCache(c.BlockCache))
+	}
+	if c.EpochFencing {
+		opts = append(opts, WithEpochFencing())
+	}
+	if c.Heartbeat > 0 {
+		opts = append(opts, WithHeartbeat(time.Duration(c.Heartbeat)))
+	}
+	if c.HybridClock {
+		opts = append(opts, WithHybridClock(time.Duration(c.MaxClockOffset)))
+	}
+	if c.SessionInfo || len(c.SessionLabels) > 0 {
+		opts = append(opts, WithSessionInfo(c.SessionLabels))
+	}
+	if c.DiskQuota > 0 {
+		opts = append(opts, WithDiskQuota(c.DiskQuota))
+	}
+	if c.PendingLimit > 0 {
+		opts = append(opts, WithPendingLimit(c.PendingLimit))
+	}
+	if c.TxnLimit > 0 {
+		opts = append(opts, WithTxnLimit(c.TxnLimit))
+	}
+	if c.ExpiryInterval > 0 {
+		opts = append(opts, WithExpiryInterval(time.Duration(c.ExpiryInterval)))
+	}
+
+	if c.FileMode != "" || c.DirMode != "" {
+		file, err := parseMode("file_mode", c.FileMode)
+		if err != nil {
+			return nil, err
+		}
+		dir, err := parseMode("dir_mode", c.DirMode)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, WithFileMode(file, dir))
+	}
+	if c.FileUID != nil || c.FileGID != nil {
+		uid, gid := -1, -1
+		if c.FileUID != nil {
+			uid = *c.FileUID
+		}
+		if c.FileGID != nil {
+			gid = *c.FileGID
+		}
+		opts = append(opts, WithFileOwner(uid, gid))
+	}
+
+	switch c.SnapshotCodec {
+	case "":
+	case "binary":
+		opts = append(opts, WithSnapshotCodec(BinaryCodec{}))
+	case "text":
+		opts = append(opts, WithSnapshotCodec(TextCodec{}))
+	case "gob":
+		opts = append(opts, WithSnapshotCodec(GobCodec{}))
+	default:
+		return nil, fmt.Errorf("wal: unknown snapshot codec %q", c.SnapshotCodec)
+	}
+
+	if c.RecoveryProfileThreshold > 0 {
+		opts = append(opts, WithRecoveryProfile(time.Duration(c.RecoveryProfileThreshold), c.RecoveryProfileDir))
+	}
+
+	return opts, nil
+}
+
+// parseMode parses an octal file mode; empty is zero
+func parseMode(name, s string) (os.FileMode, error) {
+	if s == "" {
+		return 0, nil
+	}
+	mode, err := strconv.ParseUint(s, 8, 32)
+	if err != nil {
+		return 0, fmt.Errorf("wal: %s: %q is not an octal mode", name, s)
+	}
+	return os.FileMode(mode), nil
+}
+
+// applyEnv overrides the fields of c for which lookup finds a variable
+func (c *Config) applyEnv(lookup func(string) (string, bool)) error {
+	v := reflect.ValueOf(c).Elem()
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		tag := strings.Split(t.Field(i).Tag.Get("json"), ",")[0]
+		name := configEnvPrefix + strings.ToUpper(tag)
+		value, ok := lookup(name)
+		if !ok {
+			continue
+		}
+		if err := setField(v.Field(i), value); err != nil {
+			return fmt.Errorf("wal: %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// setField sets a Config field from the text of an environment variable
+func setField(field reflect.Value, value string) error {
+	if d, ok := field.Addr().Interface().(*Duration); ok {
+		return d.parse(value)
+	}
+
+	switch field.Kind() {
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		field.SetBool(b)
+	case reflect.Int, reflect.Int64:
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return err
+		}
+		field.SetInt(n)
+	case reflect.String:
+		field.SetString(value)
+	case reflect.Ptr:
+		elem := reflect.New(field.Type().Elem())
+		if err := setField(elem.Elem(), value); err != nil {
+			return err
+		}
+		field.Set(elem)
+	case reflect.Slice:
+		var list []string
+		if value != "" {
+			list = strings.Split(value, ",")
+		}
+		field.Set(reflect.ValueOf(list))
+	case reflect.Map:
+		labels := make(map[string]string)
+		for _, pair := range strings.Split(value, ",") {
+			if pair == "" {
+				continue
+			}
+			k, v, ok := strings.Cut(pair, "=")
+			if !ok {
+				return fmt.Errorf("%q is not key=value", pair)
+			}
+			labels[k] = v
+		}
+		field.Set(reflect.ValueOf(labels))
+	default:
+		return fmt.Errorf("unsupported field type %s", field.Type())
+	}
+	return nil
+}
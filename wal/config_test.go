@@ -0,0 +1,76 @@
+package wal
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// TestLoadConfigTOML checks that a TOML file loads to the same Config as
+// the JSON file it mirrors, and that mistakes in it are reported
+func TestLoadConfigTOML(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		t.Helper()
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	jsonPath := write("wal.json", `{
+		"mirrors": ["/a/wal.log", "/b/wal.log"],
+		"quorum": 2,
+		"async_apply": true,
+		"block_cache": 1048576,
+		"heartbeat": "5s",
+		"session_labels": {"region": "eu-west", "app.name": "orders"},
+		"file_mode": "0640",
+		"file_uid": 0
+	}`)
+	tomlPath := write("wal.toml", `# Deployment settings
+mirrors = [
+	"/a/wal.log", # first copy
+	'/b/wal.log',
+]
+quorum = 2
+async_apply = true
+block_cache = 1_048_576
+heartbeat = "5s"
+file_mode = "0640"
+file_uid = 0
+
+[session_labels]
+region = "eu-west"
+"app.name" = "orders"
+`)
+
+	want, err := LoadConfig(jsonPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := LoadConfig(tomlPath)
+	if err != nil {
+		t.Fatalf("LoadConfig: %v", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("TOML config %+v, want %+v", got, want)
+	}
+
+	for _, tc := range []struct{ doc, want string }{
+		{"quorun = 2", "unknown field"},
+		{"quorum = 02", "leading zero"},
+		{"quorum = 2\nquorum = 3", "set twice"},
+		{"async_apply = yes", "not a boolean"},
+		{`mirrors = "/a/wal.log"`, "not an array"},
+		{"[mirrors]", "unknown table"},
+	} {
+		_, err := LoadConfig(write("bad.toml", tc.doc))
+		if err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("%q: got %v, want an error about %q", tc.doc, err, tc.want)
+		}
+	}
+}
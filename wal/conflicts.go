@@ -0,0 +1,69 @@
+package wal
+
+import (
+	"errors"
+	"fmt"
+)
+
+// maxTrackedWrites bounds how many keys the WAL remembers the last write
+// of. When it is exceeded the record starts over, and transactions begun
+// before then fail to commit with ErrWriteConflict.
+const maxTrackedWrites = 1 << 16
+
+// ErrWriteConflict is returned by CommitTxn when a transaction started with
+// BeginTxn writes a key that another transaction committed since it began
+var ErrWriteConflict = errors.New("wal: write conflict")
+
+// BeginTxn starts a transaction that detects write conflicts: the first of
+// two overlapping transactions to commit a change to a key wins, and the
+// other fails to commit with ErrWriteConflict and should be retried from
+// the start. Overlapping means the winner committed after the loser began.
+// Nothing is locked, so transactions never wait for each other and cannot
+// deadlock. A transaction also conflicts with any rewrite of the log since
+// it began, e.g. by Truncate or Compact. A zero Txn is not checked.
+func (wal *WAL) BeginTxn() *Txn {
+	wal.logMutex.Lock()
+	defer wal.logMutex.Unlock()
+
+	// The transaction reads what has been applied, which may lag behind
+	// what has been written
+	return &Txn{checked: true, start: wal.CommittedLSN(), rewrites: wal.rewrites}
+}
+
+// checkConflicts fails if a key txn writes was committed since it began.
+// The caller must hold logMutex.
+func (wal *WAL) checkConflicts(txn *Txn) error {
+	if !txn.checked {
+		return nil
+	}
+	if txn.rewrites != wal.rewrites || txn.start < wal.writeFloor {
+		return fmt.Errorf("%w: the log changed under the transaction", ErrWriteConflict)
+	}
+
+	for _, record := range txn.records {
+		key, ok := recordKey(record)
+		if ok && wal.lastWrites[key] > txn.start {
+			return fmt.Errorf("%w: %q was committed at LSN %d", ErrWriteConflict, key, wal.lastWrites[key])
+		}
+	}
+	return nil
+}
+
+// noteWrites records that the keys records write were committed at lsn.
+// The caller must hold logMutex.
+func (wal *WAL) noteWrites(records []LogRecord, lsn uint64) {
+	if wal.lastWrites == nil {
+		wal.lastWrites = make(map[string]uint64)
+	}
+
+	for _, record := range records {
+		if key, ok := recordKey(record); ok {
+			wal.lastWrites[key] = lsn
+		}
+	}
+
+	if len(wal.lastWrites) > maxTrackedWrites {
+		wal.lastWrites = make(map[string]uint64)
+		wal.writeFloor = lsn
+	}
+}
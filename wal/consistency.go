@@ -0,0 +1,48 @@
+package wal
+
+import "context"
+
+// CommittedLSN returns the LSN of the last transaction applied to the database
+func (wal *WAL) CommittedLSN() uint64 {
+	wal.dbMutex.Lock()
+	defer wal.dbMutex.Unlock()
+
+	return wal.committedLSN
+}
+
+// WaitForLSN blocks until the transaction committed at lsn (or a later one)
+// has been applied to the database, or ctx is done
+func (wal *WAL) WaitForLSN(ctx context.Context, lsn uint64) error {
+	for {
+		wal.dbMutex.Lock()
+		if wal.committedLSN >= lsn {
+			wal.dbMutex.Unlock()
+			return nil
+		}
+		committed := wal.committed
+		wal.dbMutex.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-committed:
+		}
+	}
+}
+
+// ReadAtLeast is like ReadDB but first waits for lsn to be applied
+func (wal *WAL) ReadAtLeast(ctx context.Context, lsn uint64) (map[string]string, error) {
+	if err := wal.WaitForLSN(ctx, lsn); err != nil {
+		return nil, err
+	}
+	return wal.ReadDB(), nil
+}
+
+// GetAtLeast is like Get but first waits for lsn to be applied
+func (wal *WAL) GetAtLeast(ctx context.Context, lsn uint64, key string) (string, bool, error) {
+	if err := wal.WaitForLSN(ctx, lsn); err != nil {
+		return "", false, err
+	}
+	value, ok := wal.Get(key)
+	return value, ok, nil
+}
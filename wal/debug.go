@@ -0,0 +1,58 @@
+package wal
+
+import (
+	"fmt"
+	"sync"
+)
+
+// The invariant checks below are expensive, so they run only in builds with
+// the waldebug tag, e.g. go test -tags waldebug. Every call is guarded by
+// debugChecks, a constant, so other builds compile them away. A violated
+// invariant panics at once, with a description of what went wrong, rather
+// than leaving a damaged log to be found later.
+
+// invariant panics if cond is false
+func invariant(cond bool, format string, args ...interface{}) {
+	if !cond {
+		panic(fmt.Sprintf("wal: invariant violated: "+format, args...))
+	}
+}
+
+// assertHeld panics if mu is not locked. A mutex has no owner, so this only
+// catches callers that forgot to lock it, not those relying on a lock taken
+// by another goroutine.
+func assertHeld(mu *sync.Mutex, name string) {
+	if mu.TryLock() {
+		mu.Unlock()
+		panic(fmt.Sprintf("wal: invariant violated: %s not held", name))
+	}
+}
+
+// checkFrame checks a record about to be appended to the log. Writers
+// either take the next LSN, or have already advanced currentLSN to it.
+func (wal *WAL) checkFrame(frame []byte) {
+	assertHeld(&wal.logMutex, "logMutex")
+
+	lsn := bytesToUint64(frame[0:8])
+	invariant(lsn > wal.baseLSN, "record %d precedes the first record of the log (%d)", lsn, wal.baseLSN+1)
+	invariant(lsn == wal.currentLSN || lsn == wal.currentLSN+1, "record %d written after record %d", lsn, wal.currentLSN)
+}
+
+// checkLogSize checks that the size the WAL keeps track of is the size of
+// the log file
+func (wal *WAL) checkLogSize() {
+	info, err := wal.file.Stat()
+	if err != nil {
+		return
+	}
+	invariant(info.Size() == wal.logSize, "log file is %d bytes, expected %d", info.Size(), wal.logSize)
+}
+
+// checkRecords checks that the records of the transaction in progress have
+// consecutive LSNs ending at currentLSN
+func (wal *WAL) checkRecords() {
+	for i, record := range wal.records {
+		want := wal.currentLSN - uint64(len(wal.records)-1-i)
+		invariant(record.LSN == want, "transaction record %d has LSN %d, expected %d", i, record.LSN, want)
+	}
+}
@@ -0,0 +1,7 @@
+//go:build !waldebug
+
+package wal
+
+// debugChecks enables the invariant checks, which the waldebug build tag
+// turns on
+const debugChecks = false
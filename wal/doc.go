@@ -0,0 +1,42 @@
+// Package wal is a write-ahead log with an in-memory key-value database
+// rebuilt from it.
+//
+// # Durability
+//
+// The log file is the only source of truth: on open, the database is
+// rebuilt by replaying the committed transactions in the log, and
+// everything after the last commit or abort record is discarded. The
+// database snapshot written after commits is never read back.
+//
+// When Commit, CommitTransaction or CommitTxn returns without error, the
+// transaction's records and commit record have been written to the log and
+// the log has been synced, so the transaction survives a crash of the
+// process or the machine, provided the disk honours fsync. With mirrors,
+// the log and enough mirrors to make up the quorum have also been synced.
+// With a synchronous remote appender, the replica has also acknowledged
+// the records.
+//
+// A commit that fails may still have reached the disk: the commit record
+// can be durable locally even though the sync of a mirror or the remote
+// append failed, or the sync of the log itself reported an error after
+// writing. Replay after a crash is then the arbiter. So that nothing is
+// written after such a commit record, and the transaction cannot be
+// aborted, the WAL turns read-only until Reopen replays the log.
+//
+// Records written with WriteRecord, Put and the like are not synced until
+// their transaction commits, and are discarded by replay if it never does.
+// WriteRecordDurable syncs a record at once, but replay still discards it
+// unless its transaction commits.
+//
+// Some options weaken what a successful commit promises:
+//
+//   - WithAsyncApply: the transaction is durable, but not yet visible to
+//     Get; WaitForLSN waits until it is.
+//   - WithRemoteAppender without synchronous: the replica may lag, and
+//     batches still failing to append at Close are dropped.
+//   - WithMirrors: a mirror that fails stops being synced, and commits carry
+//     on as long as the quorum is met.
+//
+// Heartbeats, session records and option changes are synced when written.
+// A new log file is synced with its directory before the WAL is returned.
+package wal
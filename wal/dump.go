@@ -0,0 +1,87 @@
+package wal
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// StateFormat is a format DumpState writes the database in
+type StateFormat string
+
+const (
+	// StateJSON is a JSON object mapping each key to its value, one key per
+	// line
+	StateJSON StateFormat = "json"
+	// StateCSV is CSV rows of key and value, the input walctl import takes
+	StateCSV StateFormat = "csv"
+)
+
+// DumpState writes the committed contents of the database to w in key
+// order, as of the last transaction applied, and returns that
+// transaction's commit LSN. Unlike a snapshot the output is meant to be
+// read, or compared with that of another database.
+func (wal *WAL) DumpState(w io.Writer, format StateFormat) (uint64, error) {
+	txn := wal.BeginReadOnly()
+	bw := bufio.NewWriter(w)
+
+	switch format {
+	case StateJSON:
+		if err := dumpJSON(bw, txn); err != nil {
+			return 0, err
+		}
+	case StateCSV:
+		cw := csv.NewWriter(bw)
+		var err error
+		txn.Scan("", func(key, value string) bool {
+			err = cw.Write([]string{key, value})
+			return err == nil
+		})
+		if err != nil {
+			return 0, err
+		}
+		cw.Flush()
+		if err := cw.Error(); err != nil {
+			return 0, err
+		}
+	default:
+		return 0, fmt.Errorf("wal: unknown state format %q", format)
+	}
+
+	return txn.LSN(), bw.Flush()
+}
+
+// dumpJSON writes the database seen by txn as a JSON object
+func dumpJSON(w *bufio.Writer, txn *ReadTxn) error {
+	var err error
+	first := true
+	w.WriteString("{")
+	txn.Scan("", func(key, value string) bool {
+		var k, v []byte
+		if k, err = json.Marshal(key); err != nil {
+			return false
+		}
+		if v, err = json.Marshal(value); err != nil {
+			return false
+		}
+		if !first {
+			w.WriteString(",")
+		}
+		first = false
+		w.WriteString("\n  ")
+		w.Write(k)
+		w.WriteString(": ")
+		_, err = w.Write(v)
+		return err == nil
+	})
+	if err != nil {
+		return err
+	}
+	if !first {
+		w.WriteString("\n")
+	}
+	_, err = w.WriteString("}\n")
+	return err
+}
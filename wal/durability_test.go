@@ -0,0 +1,175 @@
+package wal
+
+import (
+	"errors"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// durabilityOptions are the options that change how a commit reaches the
+// disk, each of which must keep the contract in the package documentation
+func durabilityOptions(dir string) map[string][]Option {
+	return map[string][]Option{
+		"default":          nil,
+		"async apply":      {WithAsyncApply()},
+		"hash chain":       {WithHashChain()},
+		"mirrors":          {WithMirrors(2, filepath.Join(dir, "mirror.log"))},
+		"compression":      {WithCompression(1)},
+		"record alignment": {WithRecordAlignment(512)},
+		"epoch fencing":    {WithEpochFencing()},
+	}
+}
+
+// commitPaths are the ways a transaction can be committed
+var commitPaths = map[string]func(log *WAL, key, value string) error{
+	"Commit": func(log *WAL, key, value string) error {
+		if err := log.Put(key, value); err != nil {
+			return err
+		}
+		_, err := log.Commit()
+		return err
+	},
+	"CommitTxn": func(log *WAL, key, value string) error {
+		txn := &Txn{}
+		txn.Put(key, value)
+		_, err := log.CommitTxn(txn)
+		return err
+	},
+}
+
+// TestCommitDurability checks, under each option and commit path, that a
+// commit is only acknowledged once the log has been synced, that a commit
+// whose write fails leaves nothing to replay, that an acknowledged commit
+// survives reopening, and that after every failure the database the caller
+// sees is the one replaying the log gives.
+func TestCommitDurability(t *testing.T) {
+	for optName := range durabilityOptions("") {
+		for pathName, commit := range commitPaths {
+			optName, commit := optName, commit
+			t.Run(optName+"/"+pathName, func(t *testing.T) {
+				dir := inTempDir(t)
+				name := filepath.Join(dir, "wal.log")
+				opts := durabilityOptions(dir)[optName]
+				open := func(extra ...Option) *WAL {
+					t.Helper()
+					log, err := NewWAL(name, append(append([]Option(nil), opts...), extra...)...)
+					if err != nil {
+						t.Fatalf("NewWAL: %v", err)
+					}
+					return log
+				}
+				// closeAndReplay closes log and checks that replaying it
+				// gives the database log had
+				closeAndReplay := func(log *WAL) {
+					t.Helper()
+					// Close applies what is still queued
+					log.Close()
+					live := readAll(log)
+					replayed := open()
+					defer replayed.Close()
+					if got := readAll(replayed); !reflect.DeepEqual(got, live) {
+						t.Errorf("live database %v, replay %v", live, got)
+					}
+				}
+
+				log := open()
+				if err := commit(log, "acked", "1"); err != nil {
+					t.Fatalf("commit: %v", err)
+				}
+				closeAndReplay(log)
+
+				// A commit whose sync fails is not acknowledged, nor applied,
+				// and nothing more is written until Reopen has replayed
+				// the log
+				log = open(WithFaultInjector(FaultInjector{SyncErrorRate: 1}))
+				if err := commit(log, "unsynced", "1"); !errors.Is(err, ErrInjectedFault) {
+					t.Errorf("commit with failing syncs: got %v, want ErrInjectedFault", err)
+				}
+				if _, ok := log.Get("unsynced"); ok {
+					t.Error("a commit whose sync failed was applied")
+				}
+				if !log.ReadOnly() {
+					t.Error("the WAL takes writes after a commit whose sync failed")
+				}
+				if err := log.Reopen(); err != nil {
+					t.Fatalf("Reopen: %v", err)
+				}
+				closeAndReplay(log)
+
+				// A commit whose write fails leaves nothing behind
+				log = open(WithFaultInjector(FaultInjector{WriteErrorRate: 1, PartialWrites: true}))
+				if err := commit(log, "unwritten", "1"); !errors.Is(err, ErrInjectedFault) {
+					t.Errorf("commit with failing writes: got %v, want ErrInjectedFault", err)
+				}
+				closeAndReplay(log)
+
+				if err := VerifyLog(name); err != nil {
+					t.Fatalf("VerifyLog: %v", err)
+				}
+				log = open()
+				defer log.Close()
+				if _, ok := log.Get("acked"); !ok {
+					t.Error("an acknowledged commit was lost")
+				}
+				if _, ok := log.Get("unwritten"); ok {
+					t.Error("a commit whose write failed was replayed")
+				}
+			})
+		}
+	}
+}
+
+// TestDurableRecordSync checks that WriteRecordDurable and
+// AbortTransaction fail when the log cannot be synced
+func TestDurableRecordSync(t *testing.T) {
+	name := filepath.Join(inTempDir(t), "wal.log")
+	log, err := NewWAL(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	log.Close()
+
+	log, err = NewWAL(name, WithFaultInjector(FaultInjector{SyncErrorRate: 1}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer log.Close()
+
+	if err := log.WriteRecordDurable(OpPut, encodeFields("key", "value")); !errors.Is(err, ErrInjectedFault) {
+		t.Errorf("WriteRecordDurable: got %v, want ErrInjectedFault", err)
+	}
+	if err := log.AbortTransaction(); !errors.Is(err, ErrInjectedFault) {
+		t.Errorf("AbortTransaction: got %v, want ErrInjectedFault", err)
+	}
+}
+
+// TestAbortAfterFailedCommitSync checks that a transaction whose commit
+// record is in the log, but could not be synced, cannot then be aborted:
+// replay would still commit it
+func TestAbortAfterFailedCommitSync(t *testing.T) {
+	name := filepath.Join(inTempDir(t), "wal.log")
+	log, err := NewWAL(name, WithFaultInjector(FaultInjector{SyncErrorRate: 1}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer log.Close()
+
+	if err := log.Put("key", "value"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := log.Commit(); !errors.Is(err, ErrInjectedFault) {
+		t.Fatalf("Commit: got %v, want ErrInjectedFault", err)
+	}
+	if err := log.AbortTransaction(); !errors.Is(err, ErrReadOnly) {
+		t.Fatalf("AbortTransaction: got %v, want ErrReadOnly", err)
+	}
+
+	// Reopen replays the commit record that reached the log
+	if err := log.Reopen(); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := log.Get("key"); !ok {
+		t.Error("the transaction in the log is not in the database after Reopen")
+	}
+}
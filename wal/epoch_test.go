@@ -0,0 +1,43 @@
+package wal
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+// TestEpochFencing checks that a writer cannot commit once the log has been
+// opened again, even mid-transaction
+func TestEpochFencing(t *testing.T) {
+	name := filepath.Join(inTempDir(t), "wal.log")
+	old, err := NewWAL(name, WithEpochFencing())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer old.Close()
+	if err := old.Put("before", "v"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := old.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if err := old.Put("open", "v"); err != nil {
+		t.Fatal(err)
+	}
+
+	newer, err := NewWAL(name, WithEpochFencing())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer newer.Close()
+	if newer.Epoch() != old.Epoch()+1 {
+		t.Errorf("reopened at epoch %d, want %d", newer.Epoch(), old.Epoch()+1)
+	}
+
+	if _, err := old.Commit(); !errors.Is(err, ErrFenced) {
+		t.Errorf("Commit after fencing: got %v, want ErrFenced", err)
+	}
+	if err := old.Put("after", "v"); !errors.Is(err, ErrFenced) {
+		t.Errorf("Put after fencing: got %v, want ErrFenced", err)
+	}
+}
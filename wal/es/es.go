@@ -0,0 +1,208 @@
+// Package es stores event-sourced aggregates in a WAL.
+//
+// Each aggregate is an ordered stream of events, numbered from 1 by version.
+// Appends are optimistic: the caller says which version it based its events
+// on, and the append fails with ErrVersionConflict if another append got
+// there first. An aggregate is loaded by replaying its events, starting from
+// its latest snapshot if it has one.
+package es
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/rachitsh92/write-ahead-log/wal"
+)
+
+// ErrVersionConflict is returned by Append when the aggregate is not at the
+// expected version
+var ErrVersionConflict = errors.New("es: version conflict")
+
+// Event is one event of an aggregate
+type Event struct {
+	Version uint64
+	Data    string
+}
+
+// Aggregate is the state built up from an aggregate's events
+type Aggregate interface {
+	// Restore replaces the state with one saved by SaveSnapshot
+	Restore(state string) error
+	// Apply applies the next event to the state
+	Apply(event Event) error
+}
+
+// Store keeps aggregates in a WAL under keys starting with a prefix
+type Store struct {
+	wal    *wal.WAL
+	prefix string
+}
+
+// NewStore returns a store keeping its aggregates under keys starting with
+// prefix
+func NewStore(w *wal.WAL, prefix string) *Store {
+	return &Store{wal: w, prefix: prefix}
+}
+
+// Append durably appends events to aggregate id, which must be at version
+// expected (0 for a new aggregate), and returns its new version. It fails
+// with ErrVersionConflict if the aggregate is at another version, including
+// when a concurrent Append to it commits first. When Append returns the
+// events are visible to Load.
+func (s *Store) Append(id string, expected uint64, events ...string) (uint64, error) {
+	txn := s.wal.BeginTxn()
+
+	version, err := s.Version(id)
+	if err != nil {
+		return 0, err
+	}
+	if version != expected {
+		return 0, fmt.Errorf("%w: %s is at version %d, not %d", ErrVersionConflict, id, version, expected)
+	}
+	if len(events) == 0 {
+		return version, nil
+	}
+
+	for _, event := range events {
+		version++
+		txn.Put(s.eventKey(id, version), event)
+	}
+	txn.Put(s.versionKey(id), strconv.FormatUint(version, 10))
+
+	lsn, err := s.wal.CommitTxn(txn)
+	if errors.Is(err, wal.ErrWriteConflict) {
+		return 0, fmt.Errorf("%w: %s was appended to concurrently", ErrVersionConflict, id)
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	// Commits may be applied in the background
+	return version, s.wal.WaitForLSN(context.Background(), lsn)
+}
+
+// Version returns the version of aggregate id, which is 0 if it has no events
+func (s *Store) Version(id string) (uint64, error) {
+	value, ok := s.wal.Get(s.versionKey(id))
+	if !ok {
+		return 0, nil
+	}
+	version, err := strconv.ParseUint(value, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("es: bad version %q for %s", value, id)
+	}
+	return version, nil
+}
+
+// Events returns the events of aggregate id after version after, in order
+func (s *Store) Events(id string, after uint64) ([]Event, error) {
+	version, err := s.Version(id)
+	if err != nil {
+		return nil, err
+	}
+
+	var events []Event
+	for v := after + 1; v <= version; v++ {
+		data, ok := s.wal.Get(s.eventKey(id, v))
+		if !ok {
+			return nil, fmt.Errorf("es: %s is missing event %d", id, v)
+		}
+		events = append(events, Event{Version: v, Data: data})
+	}
+	return events, nil
+}
+
+// Load rebuilds aggregate id into agg from its latest snapshot and the
+// events after it, and returns the version it was loaded at
+func (s *Store) Load(id string, agg Aggregate) (uint64, error) {
+	from := uint64(0)
+	if value, ok := s.wal.Get(s.snapshotKey(id)); ok {
+		version, state, err := decodeSnapshot(value)
+		if err != nil {
+			return 0, fmt.Errorf("es: bad snapshot for %s: %w", id, err)
+		}
+		if err := agg.Restore(state); err != nil {
+			return 0, err
+		}
+		from = version
+	}
+
+	events, err := s.Events(id, from)
+	if err != nil {
+		return 0, err
+	}
+	for _, event := range events {
+		if err := agg.Apply(event); err != nil {
+			return 0, err
+		}
+		from = event.Version
+	}
+	return from, nil
+}
+
+// SaveSnapshot durably saves state as the state of aggregate id at version,
+// so that Load can start from it. Snapshots older than the saved one are
+// ignored.
+func (s *Store) SaveSnapshot(id string, version uint64, state string) error {
+	current, err := s.Version(id)
+	if err != nil {
+		return err
+	}
+	if version > current {
+		return fmt.Errorf("es: %s has no version %d", id, version)
+	}
+
+	txn := s.wal.BeginTxn()
+	if value, ok := s.wal.Get(s.snapshotKey(id)); ok {
+		if saved, _, err := decodeSnapshot(value); err == nil && saved >= version {
+			return nil
+		}
+	}
+	txn.Put(s.snapshotKey(id), strconv.FormatUint(version, 10)+":"+state)
+
+	// A conflict means another snapshot was saved meanwhile, which will do
+	lsn, err := s.wal.CommitTxn(txn)
+	if errors.Is(err, wal.ErrWriteConflict) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return s.wal.WaitForLSN(context.Background(), lsn)
+}
+
+// decodeSnapshot splits a saved snapshot into its version and state
+func decodeSnapshot(value string) (uint64, string, error) {
+	version, state, ok := strings.Cut(value, ":")
+	if !ok {
+		return 0, "", errors.New("missing version")
+	}
+	v, err := strconv.ParseUint(version, 10, 64)
+	return v, state, err
+}
+
+// aggregatePrefix is the prefix of the keys of aggregate id. The ID is
+// escaped so that no ID's keys overlap another's.
+func (s *Store) aggregatePrefix(id string) string {
+	return s.prefix + "/" + url.PathEscape(id) + "/"
+}
+
+// eventKey returns the key holding an event. Versions are zero padded so
+// that key order is version order.
+func (s *Store) eventKey(id string, version uint64) string {
+	return fmt.Sprintf("%se/%020d", s.aggregatePrefix(id), version)
+}
+
+// versionKey returns the key holding the version of aggregate id
+func (s *Store) versionKey(id string) string {
+	return s.aggregatePrefix(id) + "version"
+}
+
+// snapshotKey returns the key holding the latest snapshot of aggregate id
+func (s *Store) snapshotKey(id string) string {
+	return s.aggregatePrefix(id) + "snapshot"
+}
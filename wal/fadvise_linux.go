@@ -0,0 +1,17 @@
+//go:build amd64 || arm64
+
+package wal
+
+import (
+	"os"
+	"syscall"
+)
+
+// posixFadvSequential is POSIX_FADV_SEQUENTIAL
+const posixFadvSequential = 2
+
+// adviseSequential tells the kernel that file is about to be read from start
+// to end, so it reads ahead more aggressively. It is only a hint.
+func adviseSequential(file *os.File) {
+	syscall.Syscall6(syscall.SYS_FADVISE64, file.Fd(), 0, 0, posixFadvSequential, 0, 0)
+}
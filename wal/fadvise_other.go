@@ -0,0 +1,8 @@
+//go:build !linux || !(amd64 || arm64)
+
+package wal
+
+import "os"
+
+// adviseSequential is a no-op where posix_fadvise is not available
+func adviseSequential(file *os.File) {}
@@ -0,0 +1,115 @@
+package wal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+)
+
+// ErrReadOnly is returned by writes to a WAL that has fallen back to
+// read-only, after repeated write or sync failures, a failed write that
+// could not be rolled back, or commit records that could not be synced
+var ErrReadOnly = errors.New("wal: log is read-only")
+
+// WithReadOnlyFallback makes the WAL read-only once the given number of
+// writes or syncs of the log in a row have failed, rather than letting every
+// later write fail against a disk that is likely gone. Each failed write is
+// rolled back as it happens, so the log holds only whole records and no
+// commit acknowledged before the switch is lost. Writes then fail at once
+// with an error wrapping ErrReadOnly and the last failure, while Get,
+// read-only transactions, ReadBatch and followers of the log keep being
+// served what was committed. Reopen brings the WAL back into service.
+// onChange, if not nil, is called with the error when the WAL becomes
+// read-only and with nil when Reopen restores it. It runs under the log
+// lock, so it must not call the WAL.
+func WithReadOnlyFallback(failures int, onChange func(err error)) Option {
+	return func(wal *WAL) {
+		wal.failureLimit = failures
+		wal.onReadOnly = onChange
+	}
+}
+
+// ReadOnly reports whether the WAL has fallen back to read-only
+func (wal *WAL) ReadOnly() bool {
+	wal.logMutex.Lock()
+	defer wal.logMutex.Unlock()
+
+	return wal.readOnlyErr != nil
+}
+
+// noteWriteResult counts a write or sync of the log towards the
+// WithReadOnlyFallback limit. The caller must hold logMutex.
+func (wal *WAL) noteWriteResult(err error) {
+	if wal.failureLimit <= 0 || wal.readOnlyErr != nil {
+		return
+	}
+	if err == nil {
+		wal.writeFailures = 0
+		return
+	}
+
+	wal.writeFailures++
+	if wal.writeFailures < wal.failureLimit {
+		return
+	}
+	wal.setReadOnly(fmt.Errorf("%w after %d failed writes: %v", ErrReadOnly, wal.writeFailures, err))
+}
+
+// Reopen tries to bring a read-only WAL back into service. It reopens the
+// log file and checks that it can be synced, then recovers it as NewWAL
+// does: whatever the failed writes left after the last committed or
+// aborted transaction is dropped, along with the transaction in progress,
+// and the database is rebuilt from the log, so a commit that failed but
+// reached the disk is applied. Mirrors are reopened and brought up to date
+// with the log. Reopen does nothing if the WAL is not read-only.
+func (wal *WAL) Reopen() error {
+	wal.logMutex.Lock()
+	defer wal.logMutex.Unlock()
+
+	if wal.readOnlyErr == nil {
+		return nil
+	}
+
+	file, err := wal.openFile(wal.file.Name(), os.O_APPEND|os.O_RDWR)
+	if err != nil {
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+
+	// Nothing may be applied from the old tail once it is gone
+	wal.drainApplier()
+
+	wal.closeMirrors()
+	wal.file.Close()
+	wal.file = file
+	wal.rewrites++
+	wal.batchHint = batchPosition{}
+	wal.records = []LogRecord{}
+	wal.setPending(0)
+	wal.replicated = nil
+
+	wal.applying.Lock()
+	defer wal.applying.Unlock()
+	wal.resetDB()
+	if err := wal.restoreLog(context.Background(), nil); err != nil {
+		return err
+	}
+	if err := wal.openMirrors(); err != nil {
+		return err
+	}
+	if wal.remote != nil {
+		if err := wal.remote.truncate(wal.currentLSN); err != nil {
+			return err
+		}
+	}
+
+	wal.writeFailures, wal.readOnlyErr = 0, nil
+	if wal.onReadOnly != nil {
+		wal.onReadOnly(nil)
+	}
+	return nil
+}
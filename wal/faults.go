@@ -0,0 +1,68 @@
+package wal
+
+import (
+	"bytes"
+	"errors"
+	"math/rand"
+	"time"
+)
+
+// ErrInjectedFault is returned by writes and syncs that a FaultInjector
+// made fail
+var ErrInjectedFault = errors.New("wal: injected fault")
+
+// FaultInjector describes a slow or flaky disk to simulate under the log
+// file, for testing how an application copes. Mirrors are not affected.
+type FaultInjector struct {
+	WriteLatency   time.Duration // added to every write
+	SyncLatency    time.Duration // added to every sync
+	WriteErrorRate float64       // fraction of writes that fail
+	SyncErrorRate  float64       // fraction of syncs that fail
+	PartialWrites  bool          // a failing write first writes part of its data
+	Seed           int64         // seeds the choice of faults, for repeatable runs
+}
+
+// WithFaultInjector injects latency and errors into the writes and syncs of
+// the log file. Latency is waited out on the WAL's clock. It is meant for
+// tests, not production.
+func WithFaultInjector(faults FaultInjector) Option {
+	return func(wal *WAL) {
+		wal.faults = &faults
+		wal.faultRand = rand.New(rand.NewSource(faults.Seed))
+	}
+}
+
+// writeLog writes bufs to the log file in one write, subject to any
+// injected faults. The caller must hold logMutex.
+func (wal *WAL) writeLog(bufs [][]byte) (int, error) {
+	if wal.faults == nil {
+		return writeVectored(wal.file, bufs)
+	}
+
+	wal.sleep(wal.faults.WriteLatency)
+	if wal.faultRand.Float64() >= wal.faults.WriteErrorRate {
+		return writeVectored(wal.file, bufs)
+	}
+
+	buf := bytes.Join(bufs, nil)
+
+	n := 0
+	if wal.faults.PartialWrites && len(buf) > 1 {
+		n, _ = wal.file.Write(buf[:1+wal.faultRand.Intn(len(buf)-1)])
+	}
+	return n, ErrInjectedFault
+}
+
+// syncLogFile syncs the log file, subject to any injected faults. The
+// caller must hold logMutex.
+func (wal *WAL) syncLogFile() error {
+	if wal.faults == nil {
+		return wal.file.Sync()
+	}
+
+	wal.sleep(wal.faults.SyncLatency)
+	if wal.faultRand.Float64() < wal.faults.SyncErrorRate {
+		return ErrInjectedFault
+	}
+	return wal.file.Sync()
+}
@@ -0,0 +1,74 @@
+package wal
+
+import (
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// instantClock is a Clock whose tickers fire at once, recording the
+// intervals asked for
+type instantClock struct {
+	mu        sync.Mutex
+	intervals []time.Duration
+}
+
+func (c *instantClock) Now() time.Time {
+	return time.Now()
+}
+
+func (c *instantClock) NewTicker(d time.Duration) Ticker {
+	c.mu.Lock()
+	c.intervals = append(c.intervals, d)
+	c.mu.Unlock()
+	ch := make(chan time.Time, 1)
+	ch <- time.Now()
+	return instantTicker(ch)
+}
+
+type instantTicker chan time.Time
+
+func (t instantTicker) C() <-chan time.Time { return t }
+
+func (t instantTicker) Stop() {}
+
+// TestFaultLatencyUsesClock checks that injected latency is waited out on
+// the WAL's clock, not the wall clock
+func TestFaultLatencyUsesClock(t *testing.T) {
+	clock := &instantClock{}
+	name := filepath.Join(inTempDir(t), "wal.log")
+	log, err := NewWAL(name, WithClock(clock), WithFaultInjector(FaultInjector{WriteLatency: time.Hour, SyncLatency: 2 * time.Hour}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer log.Close()
+
+	done := make(chan error, 1)
+	go func() {
+		if err := log.Put("key", "value"); err != nil {
+			done <- err
+			return
+		}
+		_, err := log.Commit()
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("injected latency was slept on the wall clock")
+	}
+
+	clock.mu.Lock()
+	defer clock.mu.Unlock()
+	waited := map[time.Duration]bool{}
+	for _, d := range clock.intervals {
+		waited[d] = true
+	}
+	if !waited[time.Hour] || !waited[2*time.Hour] {
+		t.Errorf("clock was asked for %v, want the write and sync latencies", clock.intervals)
+	}
+}
@@ -0,0 +1,91 @@
+package wal
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+)
+
+const (
+	// defaultFileMode is the mode of files the WAL creates; logs and
+	// snapshots often hold sensitive data
+	defaultFileMode os.FileMode = 0600
+	// defaultDirMode is the mode of directories the WAL creates
+	defaultDirMode os.FileMode = 0700
+)
+
+// WithFileMode sets the permissions of the files and directories the WAL
+// creates: the log, its mirrors, the database snapshot and their temporary
+// files. The modes are applied after creation, so the umask does not narrow
+// them. A zero mode keeps the default of 0600 for files and 0700 for
+// directories. Existing files keep their permissions.
+func WithFileMode(file, dir os.FileMode) Option {
+	return func(wal *WAL) {
+		if file != 0 {
+			wal.fileMode = file
+		}
+		if dir != 0 {
+			wal.dirMode = dir
+		}
+	}
+}
+
+// WithFileOwner sets the owner and group of the files and directories the
+// WAL creates. An id of -1 leaves it unchanged. Changing the owner normally
+// requires privileges.
+func WithFileOwner(uid, gid int) Option {
+	return func(wal *WAL) {
+		wal.fileUID = uid
+		wal.fileGID = gid
+	}
+}
+
+// openFile opens name with flag, creating it and its directory with the
+// configured mode and owner if it does not exist
+func (wal *WAL) openFile(name string, flag int) (*os.File, error) {
+	_, err := os.Lstat(name)
+	created := errors.Is(err, os.ErrNotExist)
+	if created {
+		if err := wal.makeDir(filepath.Dir(name)); err != nil {
+			return nil, err
+		}
+	}
+
+	file, err := os.OpenFile(name, flag|os.O_CREATE, wal.fileMode)
+	if err != nil {
+		return nil, err
+	}
+	if !created {
+		return file, nil
+	}
+
+	err = file.Chmod(wal.fileMode)
+	if err == nil && (wal.fileUID >= 0 || wal.fileGID >= 0) {
+		err = file.Chown(wal.fileUID, wal.fileGID)
+	}
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	return file, nil
+}
+
+// makeDir creates dir with the configured mode and owner if it does not exist
+func (wal *WAL) makeDir(dir string) error {
+	if _, err := os.Stat(dir); err == nil {
+		return nil
+	}
+
+	if err := os.MkdirAll(dir, wal.dirMode); err != nil {
+		return err
+	}
+	if err := os.Chmod(dir, wal.dirMode); err != nil {
+		return err
+	}
+	if wal.fileUID >= 0 || wal.fileGID >= 0 {
+		return os.Chown(dir, wal.fileUID, wal.fileGID)
+	}
+
+	return nil
+}
@@ -0,0 +1,72 @@
+package wal
+
+import (
+	"context"
+	"errors"
+)
+
+// followBatchBytes is how much of the log Follow reads at a time
+const followBatchBytes = 1 << 20
+
+// CommittedTxn is a transaction read back from the log by Follow
+type CommittedTxn struct {
+	LSN     uint64      // LSN of the commit record, which identifies the transaction
+	Records []LogRecord // the records written by the application, in order
+}
+
+// Follow calls fn with each transaction committed at or after fromLSN, in
+// commit order, waiting for new commits once it has caught up, until ctx is
+// done or fn fails. Aborted transactions and the records the WAL writes for
+// itself are left out. To resume, pass the LSN following the last
+// transaction handled. Transactions dropped with DropBefore are skipped.
+func (wal *WAL) Follow(ctx context.Context, fromLSN uint64, fn func(CommittedTxn) error) error {
+	from := fromLSN
+	if from == 0 {
+		from = 1
+	}
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if first := wal.FirstLSN(); from < first {
+			from = first
+		}
+
+		batch, err := wal.ReadTransactions(from, followBatchBytes, 0)
+		if errors.Is(err, ErrLSNOutOfRange) {
+			// Dropped since FirstLSN was read
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if batch.Count == 0 {
+			// Wait for the next commit
+			if err := wal.WaitForLSN(ctx, from); err != nil {
+				return err
+			}
+			continue
+		}
+
+		records, err := batch.Records()
+		if err != nil {
+			return err
+		}
+		var pending []LogRecord
+		for _, record := range records {
+			switch {
+			case record.Operation == opCommit:
+				if err := fn(CommittedTxn{LSN: record.LSN, Records: pending}); err != nil {
+					return err
+				}
+				pending = nil
+			case record.Operation == opAbort:
+				pending = nil
+			case !walRecord(record.Operation):
+				pending = append(pending, record)
+			}
+		}
+		from = batch.LastLSN + 1
+	}
+}
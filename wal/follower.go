@@ -0,0 +1,163 @@
+package wal
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrFollower is returned when a follower is asked to write records of its
+// own. A follower only appends records replicated from its primary.
+var ErrFollower = errors.New("wal: follower is read-only")
+
+// ErrNotFollower is returned by AppendBatch and Promote on a WAL that is
+// not a follower
+var ErrNotFollower = errors.New("wal: not a follower")
+
+// WithFollower opens the WAL as a follower of another WAL, its primary. A
+// follower's log receives only the batches its primary's records are shipped
+// in, through AppendBatch, keeping their LSNs, terms and checksums; every
+// other write fails with ErrFollower. Promote turns a follower into a
+// primary.
+func WithFollower() Option {
+	return func(wal *WAL) {
+		wal.follower = true
+	}
+}
+
+// AppendBatch appends a batch read from the primary with ReadBatch, or
+// forwarded by its RemoteAppender, syncs it, and applies the transactions
+// it completes. Records the follower already has are skipped, so a batch
+// may be resent; a batch that would leave a gap in the LSNs fails with
+// ErrLSNOutOfRange.
+func (wal *WAL) AppendBatch(batch *Batch) error {
+	wal.logMutex.Lock()
+	defer wal.logMutex.Unlock()
+
+	if !wal.follower {
+		return ErrNotFollower
+	}
+	records, err := batch.Records()
+	if err != nil {
+		return err
+	}
+
+	// Replicated transactions are applied directly, after anything queued
+	wal.drainApplier()
+	wal.applying.Lock()
+	defer wal.applying.Unlock()
+
+	// The epoch is checked once for the whole batch
+	if err := wal.checkEpoch(); err != nil {
+		return err
+	}
+
+	written, committed := false, uint64(0)
+	for _, record := range records {
+		if record.LSN <= wal.currentLSN {
+			continue
+		}
+		if record.LSN != wal.currentLSN+1 {
+			return fmt.Errorf("%w: record %d follows %d", ErrLSNOutOfRange, record.LSN, wal.currentLSN)
+		}
+		if record.Term != 0 && wal.logVersion < 3 {
+			return ErrTermUnsupported
+		}
+
+		buf := encodeRecord(record, wal.logVersion)
+		if err := wal.checkQuota(len(buf)); err != nil {
+			return err
+		}
+		if err := wal.appendFrame(buf); err != nil {
+			return err
+		}
+		wal.currentLSN = record.LSN
+		written = true
+
+		switch record.Operation {
+		case opCommit:
+			if err := wal.applyReplicated(append(wal.replicated, record)); err != nil {
+				return err
+			}
+			wal.replicated = nil
+			committed = record.LSN
+		case opAbort:
+			wal.replicated = nil
+		case opNoop, opChain, opConfig:
+			if t, ok := HeartbeatTime(record); ok {
+				wal.hlc.observe(t)
+			}
+			// Stand on their own outside a transaction
+			if len(wal.replicated) > 0 {
+				wal.replicated = append(wal.replicated, record)
+			}
+		default:
+			wal.replicated = append(wal.replicated, record)
+		}
+	}
+
+	if !written {
+		return nil
+	}
+	if err := wal.syncLog(); err != nil {
+		return err
+	}
+	if committed == 0 {
+		return nil
+	}
+
+	// Persist the resulting database state, as CommitTransaction does
+	return wal.flushDB(committed)
+}
+
+// applyReplicated applies a replicated transaction, ending with its commit
+// record. The caller must hold logMutex and applying.
+func (wal *WAL) applyReplicated(records []LogRecord) error {
+	wal.noteWrites(records, records[len(records)-1].LSN)
+	for _, record := range records {
+		record, err := wal.upgradeRecord(record)
+		if err != nil {
+			return err
+		}
+		if err := wal.applyChanges(record); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Promote turns a follower into a primary that accepts writes. The
+// replicated log is sealed at atLSN: records after it, and any transaction
+// left incomplete by the primary, are truncated away, so a follower that
+// received records its peers did not can be brought in line with them.
+// With WithEpochFencing the epoch is bumped, fencing off anything still
+// writing under the old one. Once Promote returns, AppendBatch fails and
+// local writes succeed.
+func (wal *WAL) Promote(atLSN uint64) error {
+	wal.logMutex.Lock()
+	defer wal.logMutex.Unlock()
+
+	if !wal.follower {
+		return ErrNotFollower
+	}
+	if len(wal.replicated) > 0 && wal.replicated[0].LSN <= atLSN {
+		atLSN = wal.replicated[0].LSN - 1
+	}
+	if err := wal.truncate(atLSN); err != nil {
+		return err
+	}
+
+	if wal.epochFile != "" {
+		epoch, err := readEpoch(wal.epochFile)
+		if err != nil {
+			return err
+		}
+		epoch++
+		if err := wal.writeEpoch(wal.epochFile, epoch); err != nil {
+			return err
+		}
+		wal.epoch = epoch
+	}
+
+	wal.follower = false
+	return nil
+}
@@ -0,0 +1,241 @@
+package wal
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"strconv"
+)
+
+const (
+	// logMagic identifies a WAL file ("LWAL" in little-endian order)
+	logMagic uint32 = 0x4c41574c
+	// formatVersion is the on-disk format written by this package
+	formatVersion uint32 = 5
+	// minFormatVersion is the oldest framed format this package reads and
+	// appends to. Version 2 records have no term, only version 4 records
+	// and later can be compressed, and only version 5 records with a
+	// preset dictionary.
+	minFormatVersion uint32 = 2
+	// headerSize is the size of the file header in bytes
+	headerSize = 16
+	// recordOverhead is the framing overhead of a version 2 record: LSN,
+	// lengths and CRC32. Version 3 adds the term.
+	recordOverhead = 8 + 4 + 4 + 4
+	// maxFieldSize bounds the operation and data lengths accepted by the decoder
+	maxFieldSize = 64 << 20
+)
+
+var (
+	// ErrCorruptRecord is returned when a record fails framing or checksum validation
+	ErrCorruptRecord = errors.New("wal: corrupt record")
+	// ErrInvalidHeader is returned when a log does not start with a valid header
+	ErrInvalidHeader = errors.New("wal: invalid log header")
+)
+
+// VersionError is returned when a log was written in a format version this
+// package cannot read. Replaying it would produce garbage, so it is refused.
+type VersionError struct {
+	Path    string // empty when reading from a stream
+	Version uint32
+}
+
+func (e *VersionError) Error() string {
+	if e.Path == "" {
+		return fmt.Sprintf("wal: unsupported format version %d (want %d)", e.Version, formatVersion)
+	}
+	return fmt.Sprintf("wal: %s: unsupported format version %d (want %d)", e.Path, e.Version, formatVersion)
+}
+
+func (e *VersionError) Unwrap() error {
+	return ErrInvalidHeader
+}
+
+// logHeader is the fixed-size header at the start of every log file
+type logHeader struct {
+	Version uint32
+	BaseLSN uint64 // LSN preceding the first record in the file
+}
+
+// encodeHeader encodes a log header
+func encodeHeader(header logHeader) []byte {
+	buf := make([]byte, 0, headerSize)
+	buf = append(buf, uint32ToBytes(logMagic)...)
+	buf = append(buf, uint32ToBytes(header.Version)...)
+	buf = append(buf, uint64ToBytes(header.BaseLSN)...)
+	return buf
+}
+
+// readHeader reads and validates a log header
+func readHeader(r io.Reader) (logHeader, error) {
+	buf := make([]byte, headerSize)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return logHeader{}, ErrInvalidHeader
+		}
+		return logHeader{}, err
+	}
+
+	if bytesToUint32(buf[0:4]) != logMagic {
+		return logHeader{}, ErrInvalidHeader
+	}
+
+	header := logHeader{
+		Version: bytesToUint32(buf[4:8]),
+		BaseLSN: bytesToUint64(buf[8:16]),
+	}
+	if header.Version < minFormatVersion || header.Version > formatVersion {
+		return logHeader{}, &VersionError{Version: header.Version}
+	}
+
+	return header, nil
+}
+
+// recordChecksum calculates the CRC32 of a log record. A term is covered
+// only when set, so records without one have the same checksum in every
+// format version.
+func recordChecksum(record LogRecord) uint32 {
+	// The checksum of the decimal LSN, operation and data, run together, but
+	// without copying them into one buffer
+	var buf [20]byte
+	crc := crc32.Update(0, crc32.IEEETable, strconv.AppendUint(buf[:0], record.LSN, 10))
+	crc = crc32.Update(crc, crc32.IEEETable, stringBytes(record.Operation))
+	crc = crc32.Update(crc, crc32.IEEETable, stringBytes(record.Data))
+	if record.Term != 0 {
+		binary.LittleEndian.PutUint64(buf[:8], record.Term)
+		crc = crc32.Update(crc, crc32.IEEETable, buf[:8])
+	}
+	return crc
+}
+
+// frameOverhead is the framing overhead of a record in the given format version
+func frameOverhead(version uint32) int {
+	if version < 3 {
+		return recordOverhead
+	}
+	return recordOverhead + 8
+}
+
+// encodeRecord encodes a log record into its on-disk frame. Version 2 frames
+// have no room for a term; callers must not give them records that have one.
+// A compressed record is stored compressed in frames of version 4 and later,
+// or 5 and later if it was compressed with a dictionary, and as is in
+// earlier ones.
+func encodeRecord(record LogRecord, version uint32) []byte {
+	stored, _ := storedData(record, version)
+	buf := make([]byte, 0, frameOverhead(version)+len(record.Operation)+len(stored))
+	head, data := frameHead(buf, record, version)
+	return appendTail(append(head, data...), record)
+}
+
+// storedData returns a record's data as stored in the given format
+// version, and the data length field that goes with it
+func storedData(record LogRecord, version uint32) (string, uint32) {
+	if version >= compressedVersion && record.compressed() && (!record.packedDict || version >= dictionaryVersion) {
+		dataLen := uint32(len(record.packed)) | compressedFlag
+		if record.packedDict {
+			dataLen |= dictionaryFlag
+		}
+		return record.packed, dataLen
+	}
+	return record.Data, uint32(len(record.Data))
+}
+
+// frameHead appends to buf the frame of a record up to its data, and
+// returns it with the data as stored
+func frameHead(buf []byte, record LogRecord, version uint32) ([]byte, string) {
+	data, dataLen := storedData(record, version)
+	buf = binary.LittleEndian.AppendUint64(buf, record.LSN)
+	if version >= 3 {
+		buf = binary.LittleEndian.AppendUint64(buf, record.Term)
+	}
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(len(record.Operation)))
+	buf = binary.LittleEndian.AppendUint32(buf, dataLen)
+	buf = append(buf, record.Operation...)
+	return buf, data
+}
+
+// appendTail appends the end of a record's frame, its checksum, to buf
+func appendTail(buf []byte, record LogRecord) []byte {
+	return binary.LittleEndian.AppendUint32(buf, record.CRC32)
+}
+
+// readRecord reads a single log record in the given format version and
+// returns it with its encoded size. io.EOF is returned only at a clean record
+// boundary; a torn or invalid record yields ErrCorruptRecord.
+func readRecord(r *bufio.Reader, version uint32) (LogRecord, int, error) {
+	prefix := make([]byte, frameOverhead(version)-4)
+	n, err := io.ReadFull(r, prefix)
+	if err != nil {
+		if err == io.EOF {
+			return LogRecord{}, 0, io.EOF
+		}
+		if err == io.ErrUnexpectedEOF {
+			return LogRecord{}, n, fmt.Errorf("%w: truncated record header", ErrCorruptRecord)
+		}
+		return LogRecord{}, n, err
+	}
+
+	lsn := bytesToUint64(prefix[0:8])
+	var term uint64
+	if version >= 3 {
+		term = bytesToUint64(prefix[8:16])
+	}
+	lengths := prefix[len(prefix)-8:]
+	opLen := bytesToUint32(lengths[0:4])
+	dataLen := bytesToUint32(lengths[4:8])
+	packed := version >= compressedVersion && dataLen&compressedFlag != 0
+	if packed {
+		dataLen &^= compressedFlag
+	}
+	packedDict := packed && version >= dictionaryVersion && dataLen&dictionaryFlag != 0
+	if packedDict {
+		dataLen &^= dictionaryFlag
+	}
+	if opLen > maxFieldSize || dataLen > maxFieldSize {
+		return LogRecord{}, n, fmt.Errorf("%w: implausible field length at LSN %d", ErrCorruptRecord, lsn)
+	}
+
+	body := make([]byte, int(opLen)+int(dataLen)+4)
+	m, err := io.ReadFull(r, body)
+	n += m
+	if err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return LogRecord{}, n, fmt.Errorf("%w: truncated record at LSN %d", ErrCorruptRecord, lsn)
+		}
+		return LogRecord{}, n, err
+	}
+
+	record := LogRecord{
+		LSN:       lsn,
+		Term:      term,
+		Operation: string(body[:opLen]),
+		Data:      string(body[opLen : opLen+dataLen]),
+		CRC32:     bytesToUint32(body[opLen+dataLen:]),
+	}
+	if packed {
+		record.packed, record.packedDict = record.Data, packedDict
+		if record.Data, err = decompress(record.packed, packedDict, lsn); err != nil {
+			return LogRecord{}, n, err
+		}
+		record.unpacked = record.Data
+	}
+	if record.CRC32 != recordChecksum(record) {
+		return LogRecord{}, n, fmt.Errorf("%w: checksum mismatch at LSN %d", ErrCorruptRecord, lsn)
+	}
+
+	return record, n, nil
+}
+
+// bytesToUint64 converts a little-endian byte slice to a uint64
+func bytesToUint64(buf []byte) uint64 {
+	return binary.LittleEndian.Uint64(buf)
+}
+
+// bytesToUint32 converts a little-endian byte slice to a uint32
+func bytesToUint32(buf []byte) uint32 {
+	return binary.LittleEndian.Uint32(buf)
+}
@@ -0,0 +1,301 @@
+package wal
+
+import (
+	"strconv"
+	"sync"
+	"time"
+)
+
+// maxGroupSize caps how many transactions one group commit writes, so the
+// goroutine leading it returns in bounded time
+const maxGroupSize = 128
+
+// Txn is a transaction built up privately by one goroutine and committed
+// with CommitTxn. The zero value is an empty transaction.
+type Txn struct {
+	records  []LogRecord
+	parent   *Txn   // nil unless the transaction is nested
+	done     bool   // a nested transaction has been committed or rolled back
+	checked  bool   // started with BeginTxn
+	start    uint64 // committed LSN when the transaction began
+	rewrites uint64 // log rewrites when the transaction began
+}
+
+// Write adds a record to the transaction. Writes to a nested transaction
+// that has been committed or rolled back are ignored.
+func (txn *Txn) Write(operation, data string) {
+	if txn.done {
+		return
+	}
+	txn.records = append(txn.records, LogRecord{Operation: operation, Data: data})
+}
+
+// Put sets key to value
+func (txn *Txn) Put(key, value string) {
+	txn.Write(OpPut, encodeFields(key, value))
+}
+
+// Delete removes key
+func (txn *Txn) Delete(key string) {
+	txn.Write(OpDelete, encodeFields(key))
+}
+
+// Increment adds delta to the integer stored under key
+func (txn *Txn) Increment(key string, delta int64) {
+	txn.Write(OpIncrement, encodeFields(key, strconv.FormatInt(delta, 10)))
+}
+
+// Append appends suffix to the value stored under key
+func (txn *Txn) Append(key, suffix string) {
+	txn.Write(OpAppend, encodeFields(key, suffix))
+}
+
+// CompareAndSwap sets key to value if it holds expected when the
+// transaction is applied
+func (txn *Txn) CompareAndSwap(key, expected, value string) {
+	txn.Write(OpCompareAndSwap, encodeFields(key, expected, value))
+}
+
+// groupCommit is a transaction waiting in the group commit queue
+type groupCommit struct {
+	txn    *Txn
+	queued time.Time
+	done   chan groupResult
+}
+
+// groupResult tells a waiting transaction how its commit went, or that it
+// is to lead the next group
+type groupResult struct {
+	lsn  uint64
+	err  error
+	lead bool
+}
+
+// groupQueue holds the transactions waiting to be committed together
+type groupQueue struct {
+	mu      sync.Mutex
+	waiting []*groupCommit
+	leading bool
+	active  int  // transactions waiting or being committed
+	warned  bool // active is near the WithTxnLimit limit
+}
+
+// CommitTxn commits txn and returns the LSN of its commit record. Commits
+// made at the same time from several goroutines are written together and
+// made durable with a single sync. They are served in the order they
+// arrived: each group takes the oldest waiting transactions, and the first
+// transaction left waiting leads the next group. CommitTxn fails with
+// ErrTransactionInProgress while records written with WriteRecord or the
+// WAL's own Put and friends are waiting for Commit.
+func (wal *WAL) CommitTxn(txn *Txn) (uint64, error) {
+	gc := &groupCommit{txn: txn, queued: wal.clock.Now(), done: make(chan groupResult, 1)}
+
+	q := &wal.group
+	q.mu.Lock()
+	if err := wal.addActive(1); err != nil {
+		q.mu.Unlock()
+		return 0, err
+	}
+	q.waiting = append(q.waiting, gc)
+	lead := !q.leading
+	q.leading = true
+	q.mu.Unlock()
+
+	if !lead {
+		result := <-gc.done
+		if !result.lead {
+			return result.lsn, result.err
+		}
+	}
+
+	wal.leadGroup()
+	result := <-gc.done
+	return result.lsn, result.err
+}
+
+// leadGroup commits the oldest waiting transactions as one group, then
+// hands leadership to the next waiting transaction, if any
+func (wal *WAL) leadGroup() {
+	q := &wal.group
+	q.mu.Lock()
+	n := len(q.waiting)
+	if n > maxGroupSize {
+		n = maxGroupSize
+	}
+	group := q.waiting[:n:n]
+	q.waiting = q.waiting[n:]
+	q.mu.Unlock()
+
+	start := wal.clock.Now()
+	wal.logMutex.Lock()
+	results, committed := wal.commitGroup(group)
+	hooks := wal.postCommitHooks
+	wal.logMutex.Unlock()
+
+	// The group is done, whether or not its callers have heard yet
+	q.mu.Lock()
+	wal.addActive(-len(group))
+	q.mu.Unlock()
+
+	for i, gc := range group {
+		results[i].Queue = start.Sub(gc.queued)
+		wal.observeCommit(results[i], results[i].Err)
+		if results[i].Err == nil {
+			runPostCommitHooks(hooks, results[i].LSN, committed[i])
+		}
+		gc.done <- groupResult{lsn: results[i].LSN, err: results[i].Err}
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if len(q.waiting) == 0 {
+		q.leading = false
+		return
+	}
+	q.waiting[0].done <- groupResult{lead: true}
+}
+
+// commitGroup writes the transactions of a group that pass the pre-commit
+// hooks, syncs them once and applies them. It returns the outcome of each
+// and the records written for it. The caller must hold logMutex.
+func (wal *WAL) commitGroup(group []*groupCommit) ([]CommitResult, [][]LogRecord) {
+	if debugChecks {
+		assertHeld(&wal.logMutex, "logMutex")
+	}
+	results := make([]CommitResult, len(group))
+	committed := make([][]LogRecord, len(group))
+	fail := func(err error) ([]CommitResult, [][]LogRecord) {
+		for i := range results {
+			if results[i].Err == nil {
+				results[i].LSN, results[i].Err = 0, err
+			}
+		}
+		return results, committed
+	}
+
+	if err := wal.asyncApplyError(); err != nil {
+		return fail(err)
+	}
+	if len(wal.records) > 0 {
+		return fail(ErrTransactionInProgress)
+	}
+
+	phase := wal.clock.Now()
+	lsn := uint64(0)
+	for i, gc := range group {
+		if err := wal.runPreCommitHooks(gc.txn.records); err != nil {
+			results[i].Err = err
+			continue
+		}
+		if err := wal.checkConflicts(gc.txn); err != nil {
+			results[i].Err = err
+			continue
+		}
+
+		records := make([]LogRecord, 0, len(gc.txn.records)+1)
+		var err error
+		for _, r := range gc.txn.records {
+			var record LogRecord
+			if record, err = wal.writeGroupRecord(r.Operation, r.Data); err != nil {
+				break
+			}
+			records = append(records, record)
+		}
+		if err == nil && wal.chain != nil {
+			err = wal.writeChain()
+		}
+
+		var commitRecord LogRecord
+		if err == nil {
+			commitRecord, err = wal.writeGroupRecord(opCommit, "")
+		}
+		if err != nil {
+			// Keep a later commit from adopting the records written so far
+			if len(records) > 0 {
+				if _, abortErr := wal.writeGroupRecord(opAbort, ""); abortErr != nil {
+					wal.strandRecords(abortErr)
+				}
+			}
+			// This member and the ones after it fail; those before it
+			// are in the log and are still synced and applied below
+			for j := i; j < len(group); j++ {
+				if results[j].Err == nil {
+					results[j].Err = err
+				}
+			}
+			break
+		}
+
+		wal.noteWrites(records, commitRecord.LSN)
+		committed[i] = append(records, commitRecord)
+		results[i].LSN = commitRecord.LSN
+		results[i].Records = len(committed[i])
+		lsn = commitRecord.LSN
+	}
+	if lsn == 0 {
+		return results, committed
+	}
+	write := wal.clock.Now().Sub(phase)
+
+	// One sync makes the whole group durable. The commit records written
+	// are past taking back, so if it fails the log decides their fate
+	phase = wal.clock.Now()
+	if err := wal.syncLog(); err != nil {
+		wal.strandCommits(err)
+		return fail(err)
+	}
+	sync := wal.clock.Now().Sub(phase)
+
+	phase = wal.clock.Now()
+	if wal.applyQueue != nil {
+		for i, records := range committed {
+			if records != nil {
+				wal.applyQueue <- applyBatch{records: records, lsn: results[i].LSN}
+			}
+		}
+		wal.queuedLSN = lsn
+	} else {
+		wal.applying.Lock()
+		defer wal.applying.Unlock()
+		for _, records := range committed {
+			for _, record := range records {
+				if err := wal.applyChanges(record); err != nil {
+					return fail(err)
+				}
+			}
+		}
+		if err := wal.flushDB(lsn); err != nil {
+			return fail(err)
+		}
+	}
+	apply := wal.clock.Now().Sub(phase)
+
+	for i := range results {
+		results[i].Write, results[i].Sync, results[i].Apply = write, sync, apply
+	}
+	return results, committed
+}
+
+// writeGroupRecord writes one record of a group commit. The caller must
+// hold logMutex.
+func (wal *WAL) writeGroupRecord(operation, data string) (LogRecord, error) {
+	record := LogRecord{
+		LSN:       wal.currentLSN + 1,
+		Term:      wal.term,
+		Operation: operation,
+		Data:      data,
+	}
+	record.CRC32 = recordChecksum(record)
+	wal.compressRecord(&record)
+
+	frame := wal.encodeParts(record)
+	if err := wal.checkQuota(frameSize(frame)); err != nil {
+		return LogRecord{}, err
+	}
+	if err := wal.writeEncoded(frame...); err != nil {
+		return LogRecord{}, err
+	}
+
+	wal.currentLSN = record.LSN
+	return record, nil
+}
@@ -0,0 +1,83 @@
+package wal
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+// TestGroupSyncFailure commits groups while syncs fail now and then, and
+// checks that a failed sync stops further writes, and that once Reopen has
+// recovered, the live database is what replaying the log gives
+func TestGroupSyncFailure(t *testing.T) {
+	name := filepath.Join(inTempDir(t), "wal.log")
+	log, err := NewWAL(name, WithFaultInjector(FaultInjector{SyncErrorRate: 0.5, Seed: 1}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	acked := make(map[string]bool)
+	failures := 0
+	for round := 0; round < 20; round++ {
+		var mu sync.Mutex
+		var wg sync.WaitGroup
+		failed := false
+		for i := 0; i < 8; i++ {
+			key := fmt.Sprintf("k%d/%d", round, i)
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				txn := &Txn{}
+				txn.Put(key, "v")
+				_, err := log.CommitTxn(txn)
+				mu.Lock()
+				defer mu.Unlock()
+				if err == nil {
+					acked[key] = true
+				} else {
+					failed = true
+				}
+			}()
+		}
+		wg.Wait()
+
+		if !failed {
+			continue
+		}
+		if !log.ReadOnly() {
+			t.Fatal("a group sync failed and the WAL still takes writes")
+		}
+		failures++
+		txn := &Txn{}
+		txn.Put("after", "v")
+		if _, err := log.CommitTxn(txn); !errors.Is(err, ErrReadOnly) {
+			t.Fatalf("commit after a failed group sync: got %v, want ErrReadOnly", err)
+		}
+		if err := log.Reopen(); err != nil {
+			t.Fatalf("Reopen: %v", err)
+		}
+	}
+	if failures == 0 {
+		t.Fatal("no group sync failed")
+	}
+
+	live := readAll(log)
+	for key := range acked {
+		if _, ok := live[key]; !ok {
+			t.Errorf("acknowledged %s is missing", key)
+		}
+	}
+	log.Close()
+
+	log, err = NewWAL(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer log.Close()
+	if replayed := readAll(log); !reflect.DeepEqual(replayed, live) {
+		t.Errorf("live database has %d keys, replay %d, or values differ", len(live), len(replayed))
+	}
+}
@@ -0,0 +1,86 @@
+package wal
+
+import (
+	"context"
+	"strconv"
+	"time"
+)
+
+// WithHeartbeat writes and syncs a heartbeat record every interval, so
+// consumers of the log can tell an idle writer from stalled replication,
+// and point-in-time recovery has timestamps to go by even when nothing else
+// is written. HeartbeatTime reads the timestamp back from a record.
+func WithHeartbeat(interval time.Duration) Option {
+	return func(wal *WAL) {
+		wal.heartbeatPeriod = interval
+	}
+}
+
+// HeartbeatTime returns the time a heartbeat record was written, and false
+// if record is not a heartbeat. Records announcing a session count as
+// heartbeats.
+func HeartbeatTime(record LogRecord) (time.Time, bool) {
+	if record.Operation != opNoop {
+		return time.Time{}, false
+	}
+
+	fields, err := decodeFields(record.Data)
+	if err != nil || len(fields) == 0 {
+		return time.Time{}, false
+	}
+	nanos, err := strconv.ParseInt(fields[0], 10, 64)
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	return time.Unix(0, nanos), true
+}
+
+// startHeartbeat starts the heartbeat worker
+func (wal *WAL) startHeartbeat() {
+	stop, done := make(chan struct{}), make(chan struct{})
+	wal.logMutex.Lock()
+	wal.heartbeatStop, wal.heartbeatDone = stop, done
+	period := wal.heartbeatPeriod
+	wal.logMutex.Unlock()
+
+	go withLabels(context.Background(), "heartbeat", func(context.Context) {
+		wal.runHeartbeat(period, stop, done)
+	})
+}
+
+// stopHeartbeat stops the heartbeat worker and waits for it to exit
+func (wal *WAL) stopHeartbeat() {
+	wal.logMutex.Lock()
+	stop, done := wal.heartbeatStop, wal.heartbeatDone
+	wal.heartbeatStop, wal.heartbeatDone = nil, nil
+	wal.logMutex.Unlock()
+
+	if stop == nil {
+		return
+	}
+	close(stop)
+	<-done
+}
+
+// runHeartbeat writes a heartbeat every period until stop is closed
+func (wal *WAL) runHeartbeat(period time.Duration, stop, done chan struct{}) {
+	defer close(done)
+
+	ticker := wal.clock.NewTicker(period)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case now := <-ticker.C():
+			// A failed heartbeat is simply missing; the next one retries
+			wal.logMutex.Lock()
+			if _, _, err := wal.writeHeartbeat(now); err == nil {
+				wal.syncLog()
+			}
+			wal.logMutex.Unlock()
+		}
+	}
+}
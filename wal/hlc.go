@@ -0,0 +1,87 @@
+package wal
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ErrClockOffset is returned by ObserveTime for a time too far ahead of the
+// local clock
+var ErrClockOffset = errors.New("wal: clock offset too large")
+
+// WithHybridClock stamps heartbeat and session records with a hybrid logical
+// clock instead of the plain clock. Each timestamp is the clock's time, or
+// one nanosecond past the latest timestamp the WAL has issued or seen if
+// that is later, so record times never go backwards: not when the system
+// clock is stepped back, not across restarts, since the latest time in the
+// log is seen on replay, and not on a follower, which sees the times its
+// primary writes. Times from other replicas can be merged in with
+// ObserveTime; those more than maxOffset ahead of the local clock are
+// refused, unless maxOffset is zero.
+func WithHybridClock(maxOffset time.Duration) Option {
+	return func(wal *WAL) {
+		wal.hlc = &hybridClock{maxOffset: maxOffset}
+	}
+}
+
+// ObserveTime merges a timestamp from another replica into the hybrid
+// clock, so that every timestamp the WAL issues afterwards is later. It
+// does nothing without WithHybridClock.
+func (wal *WAL) ObserveTime(t time.Time) error {
+	if wal.hlc == nil {
+		return nil
+	}
+	wal.hlc.mu.Lock()
+	max := wal.hlc.maxOffset
+	wal.hlc.mu.Unlock()
+	if max > 0 {
+		if ahead := t.Sub(wal.clock.Now()); ahead > max {
+			return fmt.Errorf("%w: %v ahead of the local clock", ErrClockOffset, ahead)
+		}
+	}
+
+	wal.hlc.observe(t)
+	return nil
+}
+
+// hybridClock is a hybrid logical clock. Its logical counter is folded into
+// the nanoseconds of the physical time, so its timestamps are plain times.
+type hybridClock struct {
+	mu        sync.Mutex
+	last      int64         // latest timestamp issued or seen, in Unix nanoseconds
+	maxOffset time.Duration // zero for no limit
+}
+
+// stamp returns the timestamp for an event happening at now. A nil clock
+// returns now.
+func (hlc *hybridClock) stamp(now time.Time) time.Time {
+	if hlc == nil {
+		return now
+	}
+
+	hlc.mu.Lock()
+	defer hlc.mu.Unlock()
+
+	nanos := now.UnixNano()
+	if nanos <= hlc.last {
+		nanos = hlc.last + 1
+	}
+	hlc.last = nanos
+	return time.Unix(0, nanos)
+}
+
+// observe advances the clock to t if t is later
+func (hlc *hybridClock) observe(t time.Time) {
+	if hlc == nil || t.IsZero() {
+		return
+	}
+
+	hlc.mu.Lock()
+	defer hlc.mu.Unlock()
+
+	if nanos := t.UnixNano(); nanos > hlc.last {
+		hlc.last = nanos
+	}
+}
@@ -0,0 +1,52 @@
+package wal
+
+// PreCommitHook inspects the records of a transaction about to commit, in
+// order, and vetoes the commit by returning an error. Records of a Txn have
+// no LSN yet.
+type PreCommitHook func(records []LogRecord) error
+
+// PostCommitHook is told about a transaction once it is durable, with its
+// records as logged, ending with the commit record at lsn
+type PostCommitHook func(lsn uint64, records []LogRecord)
+
+// RegisterPreCommitHook adds a hook run before every commit made through
+// Commit, CommitTransaction or CommitTxn, e.g. to enforce an invariant.
+// Hooks run in the order they were registered, under the log lock, so they
+// must not call the WAL. If one returns an error the transaction is
+// aborted and the commit fails with that error.
+func (wal *WAL) RegisterPreCommitHook(fn PreCommitHook) {
+	wal.logMutex.Lock()
+	defer wal.logMutex.Unlock()
+
+	wal.preCommitHooks = append(wal.preCommitHooks, fn)
+}
+
+// RegisterPostCommitHook adds a hook run after every successful commit made
+// through Commit, CommitTransaction or CommitTxn, e.g. to notify downstream
+// systems. Hooks run in the order they were registered, after the log lock
+// is released.
+func (wal *WAL) RegisterPostCommitHook(fn PostCommitHook) {
+	wal.logMutex.Lock()
+	defer wal.logMutex.Unlock()
+
+	wal.postCommitHooks = append(wal.postCommitHooks, fn)
+}
+
+// runPreCommitHooks runs the pre-commit hooks on records. The caller must
+// hold logMutex.
+func (wal *WAL) runPreCommitHooks(records []LogRecord) error {
+	for _, fn := range wal.preCommitHooks {
+		if err := fn(append([]LogRecord(nil), records...)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// runPostCommitHooks runs the post-commit hooks registered when hooks was
+// read under logMutex
+func runPostCommitHooks(hooks []PostCommitHook, lsn uint64, records []LogRecord) {
+	for _, fn := range hooks {
+		fn(lsn, records)
+	}
+}
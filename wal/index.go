@@ -0,0 +1,112 @@
+package wal
+
+import (
+	"errors"
+	"sort"
+)
+
+// ErrUnknownIndex is returned when querying an index that was never registered
+var ErrUnknownIndex = errors.New("wal: unknown index")
+
+// IndexFunc extracts the terms a key-value pair is indexed under
+type IndexFunc func(key, value string) []string
+
+// index maps terms to the keys whose values produce them
+type index struct {
+	extract  IndexFunc
+	keys     map[string]map[string]struct{} // term -> keys
+	keyTerms map[string][]string            // key -> terms
+}
+
+// WithIndex registers a secondary index before the log is replayed, so it is
+// built as the log is applied
+func WithIndex(name string, extract IndexFunc) Option {
+	return func(wal *WAL) {
+		wal.indexes[name] = newIndex(extract)
+	}
+}
+
+// RegisterIndex adds a secondary index, building it from the current
+// database. It is kept up to date as transactions are applied; since indexes
+// are derived from the database, replay rebuilds them.
+func (wal *WAL) RegisterIndex(name string, extract IndexFunc) {
+	wal.dbMutex.Lock()
+	defer wal.dbMutex.Unlock()
+
+	idx := newIndex(extract)
+	for key, value := range wal.inMemoryDB {
+		idx.update(key, value)
+	}
+	wal.indexes[name] = idx
+}
+
+// QueryIndex returns, in order, the keys indexed under term
+func (wal *WAL) QueryIndex(name, term string) ([]string, error) {
+	wal.dbMutex.Lock()
+	defer wal.dbMutex.Unlock()
+
+	idx, ok := wal.indexes[name]
+	if !ok {
+		return nil, ErrUnknownIndex
+	}
+
+	keys := make([]string, 0, len(idx.keys[term]))
+	for key := range idx.keys[term] {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	return keys, nil
+}
+
+// newIndex creates an empty index
+func newIndex(extract IndexFunc) *index {
+	return &index{
+		extract:  extract,
+		keys:     make(map[string]map[string]struct{}),
+		keyTerms: make(map[string][]string),
+	}
+}
+
+// update re-indexes key under its new value
+func (idx *index) update(key, value string) {
+	idx.remove(key)
+
+	terms := idx.extract(key, value)
+	for _, term := range terms {
+		if idx.keys[term] == nil {
+			idx.keys[term] = make(map[string]struct{})
+		}
+		idx.keys[term][key] = struct{}{}
+	}
+	if len(terms) > 0 {
+		idx.keyTerms[key] = terms
+	}
+}
+
+// remove drops key from the index
+func (idx *index) remove(key string) {
+	for _, term := range idx.keyTerms[key] {
+		delete(idx.keys[term], key)
+		if len(idx.keys[term]) == 0 {
+			delete(idx.keys, term)
+		}
+	}
+	delete(idx.keyTerms, key)
+}
+
+// setKey stores a value and updates the indexes. The caller must hold dbMutex.
+func (wal *WAL) setKey(key, value string) {
+	wal.mutableDB()[key] = value
+	for _, idx := range wal.indexes {
+		idx.update(key, value)
+	}
+}
+
+// deleteKey removes a key and updates the indexes. The caller must hold dbMutex.
+func (wal *WAL) deleteKey(key string) {
+	delete(wal.mutableDB(), key)
+	for _, idx := range wal.indexes {
+		idx.remove(key)
+	}
+}
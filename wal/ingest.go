@@ -0,0 +1,153 @@
+package wal
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// ErrTransactionInProgress is returned when an operation requires that no
+// uncommitted records are pending
+var ErrTransactionInProgress = errors.New("wal: transaction in progress")
+
+// Ingest reads a log from another WAL (or an exported copy of one) and
+// appends its committed transactions to this WAL. Every record is checksum
+// validated and renumbered to continue from the local LSN; records after the
+// source's last commit are ignored. It returns the number of records appended.
+// Records are held to the disk quota and pending limit like those written
+// with Put, and a transaction that fails part way is aborted; those before
+// it stay ingested.
+func (wal *WAL) Ingest(r io.Reader) (int, error) {
+	wal.logMutex.Lock()
+	defer wal.logMutex.Unlock()
+
+	if len(wal.records) > 0 {
+		return 0, ErrTransactionInProgress
+	}
+
+	// Ingested transactions are applied directly, after anything queued
+	wal.drainApplier()
+	wal.applying.Lock()
+	defer wal.applying.Unlock()
+
+	br := bufio.NewReader(r)
+	header, err := readHeader(br)
+	if err != nil {
+		return 0, err
+	}
+
+	ingested := 0
+	// Transactions ingested so far must not be left unsynced, nor
+	// unaccounted for in the committed LSN, when a later one fails
+	fail := func(err error) (int, error) {
+		if ingested == 0 {
+			return 0, err
+		}
+		if syncErr := wal.syncLog(); syncErr != nil {
+			wal.strandCommits(syncErr)
+			return ingested, err
+		}
+		wal.flushDB(wal.currentLSN)
+		return ingested, err
+	}
+
+	pending := []LogRecord{}
+	var previous LogRecord
+	for {
+		record, _, err := readRecord(br, header.Version)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fail(err)
+		}
+
+		// Padding, hash chains that renumbering would break, redaction
+		// markers, which change nothing, and the source's option changes
+		if record.Operation == opPad || record.Operation == opChain || record.Operation == opRedacted || record.Operation == opConfig {
+			continue
+		}
+
+		// Skip a record written twice by a retried append
+		if previous.LSN != 0 && record.LSN == previous.LSN {
+			if record != previous {
+				return fail(fmt.Errorf("%w: conflicting records at LSN %d", ErrCorruptRecord, record.LSN))
+			}
+			continue
+		}
+		previous = record
+
+		// Heartbeats outside a transaction are not worth copying
+		if record.Operation == opNoop && len(pending) == 0 {
+			continue
+		}
+
+		if record.Operation == opAbort {
+			pending = pending[:0]
+			continue
+		}
+
+		pending = append(pending, record)
+		if record.Operation != opCommit {
+			continue
+		}
+
+		if err := wal.ingestTransaction(pending); err != nil {
+			return fail(err)
+		}
+		ingested += len(pending)
+		pending = pending[:0]
+	}
+
+	if ingested == 0 {
+		return 0, nil
+	}
+
+	// The commit records are written and applied; if they cannot be made
+	// durable, the log decides their fate
+	if err := wal.syncLog(); err != nil {
+		wal.strandCommits(err)
+		return ingested, err
+	}
+
+	// Persist the resulting database state, as CommitTransaction does
+	return ingested, wal.flushDB(wal.currentLSN)
+}
+
+// ingestTransaction renumbers, writes and applies one committed
+// transaction. Its records go through the same checks as those written
+// with Put, and a transaction that cannot be written whole is aborted.
+func (wal *WAL) ingestTransaction(records []LogRecord) error {
+	for _, record := range records {
+		if record.Term != 0 && wal.logVersion < 3 {
+			return ErrTermUnsupported
+		}
+	}
+
+	for _, record := range records {
+		if err := wal.appendTermRecord(record.Term, record.Operation, record.Data); err != nil {
+			// Keep the next commit from adopting the records written so far
+			if abortErr := wal.abortTransaction(); abortErr != nil && len(wal.records) > 0 {
+				wal.strandRecords(abortErr)
+			}
+			return err
+		}
+	}
+	written := wal.records
+	wal.records = []LogRecord{}
+	wal.setPending(0)
+	wal.noteWrites(written, wal.currentLSN)
+
+	for _, record := range written {
+		record, err := wal.upgradeRecord(record)
+		if err != nil {
+			return err
+		}
+		if err := wal.applyChanges(record); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,108 @@
+package wal
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// TestIngestWriteFailure ingests a log while writes fail now and then,
+// commits once more, and checks that replay agrees with the live database
+func TestIngestWriteFailure(t *testing.T) {
+	dir := inTempDir(t)
+	source := filepath.Join(dir, "source.log")
+	log, err := NewWAL(source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 5; i++ {
+		txn := &Txn{}
+		txn.Put(fmt.Sprintf("a%d", i), "1")
+		txn.Put(fmt.Sprintf("b%d", i), "2")
+		if _, err := log.CommitTxn(txn); err != nil {
+			t.Fatal(err)
+		}
+	}
+	log.Close()
+	data, err := os.ReadFile(source)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for seed := int64(0); seed < 20; seed++ {
+		t.Run(fmt.Sprint(seed), func(t *testing.T) {
+			name := filepath.Join(dir, fmt.Sprintf("ingest-%d.log", seed))
+			log, err := NewWAL(name, WithFaultInjector(FaultInjector{WriteErrorRate: 0.3, PartialWrites: true, Seed: seed}))
+			if err != nil {
+				t.Fatal(err)
+			}
+			log.Ingest(bytes.NewReader(data))
+
+			// Commit once more, as a caller carrying on would
+			for {
+				if log.ReadOnly() {
+					if err := log.Reopen(); err != nil {
+						t.Fatalf("Reopen: %v", err)
+					}
+				}
+				err := log.Put("after", "1")
+				if err == nil {
+					_, err = log.Commit()
+				}
+				if err == nil {
+					break
+				}
+				if !errors.Is(err, ErrInjectedFault) && !errors.Is(err, ErrReadOnly) {
+					t.Fatalf("commit: %v", err)
+				}
+				for err = log.AbortTransaction(); errors.Is(err, ErrInjectedFault); err = log.AbortTransaction() {
+				}
+			}
+			live := readAll(log)
+			log.Close()
+
+			log, err = NewWAL(name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer log.Close()
+			if replayed := readAll(log); !reflect.DeepEqual(replayed, live) {
+				t.Errorf("live database %v, replay %v", live, replayed)
+			}
+		})
+	}
+}
+
+// TestIngestPendingLimit checks that ingested transactions are held to the
+// pending limit like those written with Put
+func TestIngestPendingLimit(t *testing.T) {
+	dir := inTempDir(t)
+	source := filepath.Join(dir, "source.log")
+	log, err := NewWAL(source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	txn := &Txn{}
+	txn.Put("big", string(make([]byte, 4096)))
+	if _, err := log.CommitTxn(txn); err != nil {
+		t.Fatal(err)
+	}
+	log.Close()
+	data, err := os.ReadFile(source)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	log, err = NewWAL(filepath.Join(dir, "dest.log"), WithPendingLimit(1024))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer log.Close()
+	if _, err := log.Ingest(bytes.NewReader(data)); !errors.Is(err, ErrPendingLimit) {
+		t.Errorf("Ingest: got %v, want ErrPendingLimit", err)
+	}
+}
@@ -0,0 +1,16 @@
+package wal
+
+// WriteAheadLog is the core API of a WAL: appending records, committing or
+// aborting the current transaction, reading the resulting state and closing.
+// *WAL implements it; applications can depend on the interface to mock the
+// WAL in tests or to swap in another implementation.
+type WriteAheadLog interface {
+	WriteRecord(operation, data string) error
+	Commit() (uint64, error)
+	AbortTransaction() error
+	Get(key string) (string, bool)
+	ReadDB() map[string]string
+	Close() error
+}
+
+var _ WriteAheadLog = (*WAL)(nil)
@@ -0,0 +1,151 @@
+// Package kafka ships the transactions committed to a WAL to a Kafka topic.
+//
+// The package does not depend on a Kafka client. Sink writes through the
+// Writer interface, which a few lines of adapter code implement over the
+// producer of any client library.
+package kafka
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"strings"
+
+	"github.com/rachitsh92/write-ahead-log/wal"
+)
+
+// offsetPrefix starts the keys under which sinks record their progress. It
+// is one of wal.ReservedPrefixes.
+const offsetPrefix = "kafka/"
+
+// Header is a Kafka record header
+type Header struct {
+	Key   string
+	Value []byte
+}
+
+// Message is a Kafka record produced for one WAL record. Its key is the WAL
+// record's key, if it has one, and its value is the record encoded as a
+// JSON Record. Its headers are "lsn" (the record's LSN), "txn" (the LSN of
+// its transaction's commit record) and "op" (its operation).
+type Message struct {
+	Topic   string
+	Key     []byte
+	Value   []byte
+	Headers []Header
+}
+
+// Record is the JSON value of a Message
+type Record struct {
+	LSN       uint64   `json:"lsn"`
+	Txn       uint64   `json:"txn"`
+	Operation string   `json:"op"`
+	Key       string   `json:"key,omitempty"`
+	Fields    []string `json:"fields,omitempty"` // the decoded data of key-value operations
+	Data      string   `json:"data,omitempty"`   // the data of other operations
+}
+
+// Writer produces messages to Kafka. WriteMessages must return only once
+// every message has been acknowledged by the brokers.
+type Writer interface {
+	WriteMessages(ctx context.Context, msgs ...Message) error
+}
+
+// Sink produces every committed transaction of a WAL to a topic
+type Sink struct {
+	WAL       *wal.WAL
+	Name      string // identifies the sink's progress in the WAL
+	Topic     string
+	KeyPrefix string // produce only records on keys with this prefix; empty produces all
+	Writer    Writer
+}
+
+// Run produces the records of each committed transaction, one transaction
+// per WriteMessages call, until ctx is done or a write fails. After a
+// transaction is written its commit LSN is committed under the key
+// "kafka/" + Name, and Run resumes after it. Records on keys under
+// wal.ReservedPrefixes, where sinks and relays record their progress, are
+// never produced. Delivery is at least once: a transaction written before a
+// failure or crash and not yet recorded is written again, and consumers can
+// drop duplicates by the "lsn" header.
+func (s *Sink) Run(ctx context.Context) error {
+	offsetKey := offsetPrefix + s.Name
+
+	from := uint64(1)
+	if value, ok := s.WAL.Get(offsetKey); ok {
+		offset, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			return err
+		}
+		from = offset + 1
+	}
+
+	return s.WAL.Follow(ctx, from, func(txn wal.CommittedTxn) error {
+		var msgs []Message
+		for _, record := range txn.Records {
+			key, hasKey := record.Key()
+			if hasKey && wal.IsReservedKey(key) {
+				continue
+			}
+			if s.KeyPrefix != "" && (!hasKey || !strings.HasPrefix(key, s.KeyPrefix)) {
+				continue
+			}
+
+			msg, err := s.message(txn.LSN, record, key, hasKey)
+			if err != nil {
+				return err
+			}
+			msgs = append(msgs, msg)
+		}
+		if len(msgs) == 0 {
+			return nil
+		}
+
+		if err := s.Writer.WriteMessages(ctx, msgs...); err != nil {
+			return err
+		}
+
+		progress := &wal.Txn{}
+		progress.Put(offsetKey, strconv.FormatUint(txn.LSN, 10))
+		lsn, err := s.WAL.CommitTxn(progress)
+		if err != nil {
+			return err
+		}
+
+		// A restart must find the progress recorded
+		return s.WAL.WaitForLSN(ctx, lsn)
+	})
+}
+
+// message builds the message for a record of the transaction committed at txn
+func (s *Sink) message(txn uint64, record wal.LogRecord, key string, hasKey bool) (Message, error) {
+	value := Record{LSN: record.LSN, Txn: txn, Operation: record.Operation}
+	if hasKey {
+		fields, err := record.Fields()
+		if err != nil {
+			return Message{}, err
+		}
+		value.Key, value.Fields = key, fields
+	} else {
+		value.Data = record.Data
+	}
+
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return Message{}, err
+	}
+
+	msg := Message{
+		Topic: s.Topic,
+		Value: encoded,
+		Headers: []Header{
+			{Key: "lsn", Value: []byte(strconv.FormatUint(record.LSN, 10))},
+			{Key: "txn", Value: []byte(strconv.FormatUint(txn, 10))},
+			{Key: "op", Value: []byte(record.Operation)},
+		},
+	}
+	if hasKey {
+		msg.Key = []byte(key)
+	}
+	return msg, nil
+}
@@ -0,0 +1,117 @@
+package wal
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrPendingLimit is returned when writing a record would take the open
+// transaction past the WithPendingLimit limit
+var ErrPendingLimit = errors.New("wal: pending transaction bytes limit exceeded")
+
+// ErrTxnLimit is returned by CommitTxn when the WithTxnLimit limit of
+// transactions are already being committed
+var ErrTxnLimit = errors.New("wal: active transaction limit exceeded")
+
+// Limits whose usage WithLimitWarning reports
+const (
+	LimitPendingBytes = "pending_bytes"
+	LimitActiveTxns   = "active_txns"
+)
+
+// WithPendingLimit rejects new records with ErrPendingLimit once the
+// records of the open transaction, written to the log but not committed,
+// would exceed limit bytes. Commit and abort records are always written, so
+// the transaction can still be finished.
+func WithPendingLimit(limit int64) Option {
+	return func(wal *WAL) {
+		wal.pendingLimit = limit
+	}
+}
+
+// WithTxnLimit fails CommitTxn with ErrTxnLimit while limit transactions
+// are already waiting to be committed or being committed, so a burst of
+// commits queues up no further behind a slow disk.
+func WithTxnLimit(limit int) Option {
+	return func(wal *WAL) {
+		wal.txnLimit = limit
+	}
+}
+
+// WithLimitWarning calls fn once usage of the WithPendingLimit or
+// WithTxnLimit limit, named by LimitPendingBytes or LimitActiveTxns,
+// reaches 80% of it, with warning set, and again with it unset once usage
+// is back below, so operators can act before writes start failing. fn runs
+// under a lock of the WAL, so it must not call the WAL.
+func WithLimitWarning(fn func(name string, usage, limit int64, warning bool)) Option {
+	return func(wal *WAL) {
+		wal.limitWarn = fn
+	}
+}
+
+// PendingBytes returns the bytes of the open transaction's records
+func (wal *WAL) PendingBytes() int64 {
+	wal.logMutex.Lock()
+	defer wal.logMutex.Unlock()
+
+	return wal.pendingBytes
+}
+
+// ActiveTxns returns the number of transactions passed to CommitTxn that
+// have not been committed yet
+func (wal *WAL) ActiveTxns() int {
+	q := &wal.group
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return q.active
+}
+
+// checkPending fails if writing a record of n bytes would take the open
+// transaction past the pending limit. The caller must hold logMutex.
+func (wal *WAL) checkPending(n int) error {
+	if wal.pendingLimit <= 0 {
+		return nil
+	}
+
+	if wal.pendingBytes+int64(n) > wal.pendingLimit {
+		return fmt.Errorf("%w: %d of %d bytes pending", ErrPendingLimit, wal.pendingBytes, wal.pendingLimit)
+	}
+	return nil
+}
+
+// setPending records the bytes of the open transaction's records. The
+// caller must hold logMutex.
+func (wal *WAL) setPending(n int64) {
+	wal.pendingBytes = n
+	if wal.limitWarn == nil || wal.pendingLimit <= 0 {
+		return
+	}
+
+	warning := nearLimit(n, wal.pendingLimit)
+	if warning != wal.pendingWarned {
+		wal.pendingWarned = warning
+		wal.limitWarn(LimitPendingBytes, n, wal.pendingLimit, warning)
+	}
+}
+
+// addActive counts n more transactions being committed, failing if that
+// would exceed the transaction limit. The caller must hold the group
+// queue's lock.
+func (wal *WAL) addActive(n int) error {
+	q := &wal.group
+	if n > 0 && wal.txnLimit > 0 && q.active+n > wal.txnLimit {
+		return fmt.Errorf("%w: %d of %d transactions active", ErrTxnLimit, q.active, wal.txnLimit)
+	}
+	q.active += n
+	if wal.limitWarn == nil || wal.txnLimit <= 0 {
+		return nil
+	}
+
+	warning := nearLimit(int64(q.active), int64(wal.txnLimit))
+	if warning != q.warned {
+		q.warned = warning
+		wal.limitWarn(LimitActiveTxns, int64(q.active), int64(wal.txnLimit), warning)
+	}
+	return nil
+}
@@ -0,0 +1,203 @@
+// Package load bulk loads key-value rows from CSV or JSON Lines into a WAL.
+//
+// Rows are committed in transactions of a fixed number of rows. A named
+// load commits the number of rows loaded so far with every transaction, so
+// a load interrupted by a failure or crash can be run again on the same
+// input and picks up after the last transaction it committed, loading
+// every row exactly once.
+package load
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+
+	"github.com/rachitsh92/write-ahead-log/wal"
+)
+
+// progressPrefix starts the keys under which named loads record their
+// progress. It is one of wal.ReservedPrefixes.
+const progressPrefix = "load/"
+
+// defaultTxnSize is the number of rows committed together by default
+const defaultTxnSize = 1000
+
+// Format is the format of the input of a load
+type Format string
+
+const (
+	// CSV rows have two columns, the key and the value
+	CSV Format = "csv"
+	// JSONL rows are JSON objects with a "key" and a "value" member, one per
+	// line. A value that is not a string is stored as its JSON encoding.
+	JSONL Format = "jsonl"
+)
+
+// Progress describes how far a load has got
+type Progress struct {
+	Rows    int    // rows committed, including those of earlier runs
+	Skipped int    // rows skipped as committed by an earlier run
+	Txns    int    // transactions committed by this run
+	LSN     uint64 // commit LSN of the last transaction, zero if none
+}
+
+// Loader loads rows into a WAL
+type Loader struct {
+	WAL    *wal.WAL
+	Format Format
+	// Name identifies the load. Progress is committed under the key
+	// "load/" + Name, and a load of the same name resumes from it. An
+	// empty name loads every row and records nothing.
+	Name string
+	// TxnSize is the number of rows committed together; zero means 1000
+	TxnSize int
+	// Header skips the first row of CSV input
+	Header bool
+	// OnProgress, if set, is called after every transaction commits
+	OnProgress func(Progress)
+}
+
+// Run loads the rows read from r until the input ends, ctx is done or a
+// commit fails, and returns how far it got
+func (l *Loader) Run(ctx context.Context, r io.Reader) (Progress, error) {
+	var progress Progress
+
+	next, err := l.rows(r)
+	if err != nil {
+		return progress, err
+	}
+
+	key := progressPrefix + l.Name
+	if l.Name != "" {
+		if value, ok := l.WAL.Get(key); ok {
+			done, err := strconv.Atoi(value)
+			if err != nil {
+				return progress, fmt.Errorf("load: %s: %w", key, err)
+			}
+			for progress.Skipped < done {
+				if _, _, err := next(); err != nil {
+					if err == io.EOF {
+						err = fmt.Errorf("load: input has fewer rows than the %d already loaded", done)
+					}
+					return progress, err
+				}
+				progress.Skipped++
+			}
+			progress.Rows = done
+		}
+	}
+
+	size := l.TxnSize
+	if size <= 0 {
+		size = defaultTxnSize
+	}
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return progress, err
+		}
+
+		txn := &wal.Txn{}
+		rows := 0
+		var readErr error
+		for rows < size {
+			k, v, err := next()
+			if err != nil {
+				readErr = err
+				break
+			}
+			txn.Put(k, v)
+			rows++
+		}
+		if readErr != nil && readErr != io.EOF {
+			return progress, readErr
+		}
+
+		if rows > 0 {
+			if l.Name != "" {
+				txn.Put(key, strconv.Itoa(progress.Rows+rows))
+			}
+			lsn, err := l.WAL.CommitTxn(txn)
+			if err != nil {
+				return progress, err
+			}
+			progress.Rows += rows
+			progress.Txns++
+			progress.LSN = lsn
+			if l.OnProgress != nil {
+				l.OnProgress(progress)
+			}
+		}
+
+		if readErr == io.EOF {
+			return progress, nil
+		}
+	}
+}
+
+// rows returns a function reading one row at a time from r, returning
+// io.EOF after the last
+func (l *Loader) rows(r io.Reader) (func() (string, string, error), error) {
+	switch l.Format {
+	case CSV:
+		cr := csv.NewReader(r)
+		cr.FieldsPerRecord = 2
+		cr.ReuseRecord = true
+		if l.Header {
+			if _, err := cr.Read(); err != nil && err != io.EOF {
+				return nil, err
+			}
+		}
+		return func() (string, string, error) {
+			row, err := cr.Read()
+			if err != nil {
+				return "", "", err
+			}
+			return row[0], row[1], nil
+		}, nil
+
+	case JSONL:
+		scanner := bufio.NewScanner(r)
+		scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+		line := 0
+		return func() (string, string, error) {
+			for scanner.Scan() {
+				line++
+				if len(scanner.Bytes()) == 0 {
+					continue
+				}
+				return decodeRow(scanner.Bytes(), line)
+			}
+			if err := scanner.Err(); err != nil {
+				return "", "", err
+			}
+			return "", "", io.EOF
+		}, nil
+	}
+
+	return nil, fmt.Errorf("load: unknown format %q", l.Format)
+}
+
+// decodeRow decodes one line of JSON Lines input
+func decodeRow(buf []byte, line int) (string, string, error) {
+	var row struct {
+		Key   *string         `json:"key"`
+		Value json.RawMessage `json:"value"`
+	}
+	if err := json.Unmarshal(buf, &row); err != nil {
+		return "", "", fmt.Errorf("load: line %d: %w", line, err)
+	}
+	if row.Key == nil || row.Value == nil {
+		return "", "", fmt.Errorf("load: line %d: needs a key and a value", line)
+	}
+
+	var value string
+	if err := json.Unmarshal(row.Value, &value); err != nil {
+		value = string(row.Value)
+	}
+	return *row.Key, value, nil
+}
@@ -0,0 +1,250 @@
+package wal
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// legacyFormatVersion is the headerless, unframed format written before
+// format version 2
+const legacyFormatVersion = 1
+
+// ErrLegacyFormat is returned when opening a log written in the legacy format
+var ErrLegacyFormat = errors.New("wal: legacy log format, convert it with walctl migrate")
+
+// MigrateLegacyLog rewrites a legacy (version 1) log at srcPath into the
+// current format at dstPath and returns the number of records migrated.
+//
+// Legacy records store the operation and data back to back without lengths,
+// so each record is split on the longest matching entry of operations; the
+// transaction markers are always known. Records are renumbered into a single
+// increasing LSN sequence, and the output is re-read to verify that the
+// record count and checksums match before it is moved into place.
+//
+// A log in an older framed format, version 2, 3 or 4, is rewritten record
+// for record, keeping its LSNs and dropping alignment padding, and
+// operations is not needed. Such logs can also be opened as they are;
+// migrating them lets them use what needs the current format, such as
+// compression dictionaries.
+func MigrateLegacyLog(srcPath, dstPath string, operations []string) (int, error) {
+	if _, err := os.Stat(dstPath); err == nil {
+		return 0, fmt.Errorf("%s already exists", dstPath)
+	}
+
+	info, err := os.Stat(srcPath)
+	if err != nil {
+		return 0, err
+	}
+	src, err := os.ReadFile(srcPath)
+	if err != nil {
+		return 0, err
+	}
+	var header logHeader
+	var records []LogRecord
+	if len(src) >= 4 && bytesToUint32(src[:4]) == logMagic {
+		header, records, err = parseFramedLog(src)
+		if err == nil && header.Version == formatVersion {
+			return 0, fmt.Errorf("%s is already in format version %d", srcPath, formatVersion)
+		}
+	} else {
+		records, err = parseLegacyLog(src, append([]string{opBegin, opCommit}, operations...))
+	}
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", srcPath, err)
+	}
+	header.Version = formatVersion
+
+	tmpPath := dstPath + ".tmp"
+	if err := writeLog(tmpPath, header, records, info.Mode().Perm()); err != nil {
+		os.Remove(tmpPath)
+		return 0, err
+	}
+
+	if err := verifyMigratedLog(tmpPath, records); err != nil {
+		os.Remove(tmpPath)
+		return 0, err
+	}
+
+	if err := os.Rename(tmpPath, dstPath); err != nil {
+		os.Remove(tmpPath)
+		return 0, err
+	}
+
+	return len(records), nil
+}
+
+// parseLegacyLog decodes a legacy log into renumbered records. Record
+// boundaries are found by scanning for the CRC32 that closes each record.
+func parseLegacyLog(buf []byte, operations []string) ([]LogRecord, error) {
+	records := []LogRecord{}
+	offset := 0
+
+	for offset < len(buf) {
+		if len(buf)-offset < 8+4 {
+			return nil, fmt.Errorf("%w: truncated legacy record at offset %d", ErrCorruptRecord, offset)
+		}
+
+		lsn := bytesToUint64(buf[offset : offset+8])
+		payloadLen, ok := legacyPayloadLength(lsn, buf[offset+8:])
+		if !ok {
+			return nil, fmt.Errorf("%w: no valid legacy record at offset %d", ErrCorruptRecord, offset)
+		}
+
+		payload := string(buf[offset+8 : offset+8+payloadLen])
+		operation, data, ok := splitLegacyPayload(payload, operations)
+		if !ok {
+			return nil, fmt.Errorf("cannot determine the operation of legacy record %d at offset %d (%.40q)", lsn, offset, payload)
+		}
+
+		record := LogRecord{
+			LSN:       uint64(len(records) + 1),
+			Operation: operation,
+			Data:      data,
+		}
+		record.CRC32 = recordChecksum(record)
+		records = append(records, record)
+
+		offset += 8 + payloadLen + 4
+	}
+
+	return records, nil
+}
+
+// parseFramedLog decodes a log in a framed format version, without its
+// padding. A damaged record fails it: repair the log before migrating it.
+func parseFramedLog(buf []byte) (logHeader, []LogRecord, error) {
+	r := bufio.NewReader(bytes.NewReader(buf))
+	header, err := readHeader(r)
+	if err != nil {
+		return logHeader{}, nil, err
+	}
+
+	records := []LogRecord{}
+	for {
+		record, _, err := readRecord(r, header.Version)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return logHeader{}, nil, err
+		}
+		if record.Operation != opPad {
+			records = append(records, record)
+		}
+	}
+
+	return header, records, nil
+}
+
+// legacyPayloadLength finds the length of the payload of a legacy record
+// whose LSN has already been read, i.e. the shortest prefix of buf followed
+// by the CRC32 of the LSN and that prefix
+func legacyPayloadLength(lsn uint64, buf []byte) (int, bool) {
+	checksum := crc32.ChecksumIEEE([]byte(strconv.FormatUint(lsn, 10)))
+
+	for n := 0; n+4 <= len(buf); n++ {
+		if bytesToUint32(buf[n:n+4]) == checksum {
+			return n, true
+		}
+		checksum = crc32.Update(checksum, crc32.IEEETable, buf[n:n+1])
+	}
+
+	return 0, false
+}
+
+// splitLegacyPayload splits a legacy payload on the longest matching operation
+func splitLegacyPayload(payload string, operations []string) (string, string, bool) {
+	operation := ""
+	found := false
+	for _, candidate := range operations {
+		if strings.HasPrefix(payload, candidate) && (!found || len(candidate) > len(operation)) {
+			operation = candidate
+			found = true
+		}
+	}
+
+	return operation, strings.TrimPrefix(payload, operation), found
+}
+
+// isLegacyLog reports whether r starts with a valid legacy record
+func isLegacyLog(r io.Reader) bool {
+	buf := make([]byte, 64<<10)
+	n, _ := io.ReadFull(r, buf)
+	if n < 8+4 {
+		return false
+	}
+
+	_, ok := legacyPayloadLength(bytesToUint64(buf[:8]), buf[8:n])
+	return ok
+}
+
+// writeLog writes a complete, synced log file with the given permissions
+func writeLog(path string, header logHeader, records []LogRecord, mode os.FileMode) error {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, mode)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	if err := file.Chmod(mode); err != nil {
+		return err
+	}
+
+	w := bufio.NewWriter(file)
+	if _, err := w.Write(encodeHeader(header)); err != nil {
+		return err
+	}
+	for _, record := range records {
+		if _, err := w.Write(encodeRecord(record, header.Version)); err != nil {
+			return err
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	return file.Sync()
+}
+
+// verifyMigratedLog checks that a migrated log decodes to exactly the expected records
+func verifyMigratedLog(path string, expected []LogRecord) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	r := bufio.NewReader(file)
+	header, err := readHeader(r)
+	if err != nil {
+		return err
+	}
+
+	count := 0
+	for {
+		record, _, err := readRecord(r, header.Version)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("verifying %s: %w", path, err)
+		}
+		if count >= len(expected) || record != expected[count] {
+			return fmt.Errorf("verifying %s: record %d does not match the source", path, count+1)
+		}
+		count++
+	}
+
+	if count != len(expected) {
+		return fmt.Errorf("verifying %s: found %d records, expected %d", path, count, len(expected))
+	}
+
+	return nil
+}
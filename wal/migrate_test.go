@@ -0,0 +1,121 @@
+package wal
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// replayLog opens the log at name on its own, without a database snapshot,
+// and returns the database and committed LSN replaying it gives
+func replayLog(t *testing.T, name string) (map[string]string, uint64) {
+	t.Helper()
+	if err := os.Remove(snapshotFile); err != nil && !errors.Is(err, os.ErrNotExist) {
+		t.Fatal(err)
+	}
+	log, err := NewWAL(name)
+	if err != nil {
+		t.Fatalf("NewWAL(%s): %v", name, err)
+	}
+	defer log.Close()
+	return readAll(log), log.CommittedLSN()
+}
+
+// TestMigrateFramedLog checks that logs in format versions 2 and 3, the
+// bundled example among them, migrate to the current format and replay to
+// the same database
+func TestMigrateFramedLog(t *testing.T) {
+	fixture, err := os.ReadFile(filepath.Join("..", "wal.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := inTempDir(t)
+
+	// A version 3 log with terms, an aborted transaction and a delete
+	source := filepath.Join(dir, "source.log")
+	log, err := NewWAL(source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	commitKeys(t, log, "k0", "k1", "k2")
+	if err := log.Put("aborted", "v"); err != nil {
+		t.Fatal(err)
+	}
+	if err := log.AbortTransaction(); err != nil {
+		t.Fatal(err)
+	}
+	if err := log.Delete("k1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := log.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	log.Close()
+	buf, err := os.ReadFile(source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, records, err := parseFramedLog(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range records {
+		records[i].Term = 7
+		records[i].CRC32 = recordChecksum(records[i])
+	}
+	v3 := filepath.Join(dir, "v3.log")
+	if err := writeLog(v3, logHeader{Version: 3}, records, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	v2 := filepath.Join(dir, "v2.log")
+	if err := os.WriteFile(v2, fixture, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, version := range map[string]uint32{v2: 2, v3: 3} {
+		if header, _, err := parseFramedLog(mustRead(t, name)); err != nil || header.Version != version {
+			t.Fatalf("%s: version %d, %v; want version %d", name, header.Version, err, version)
+		}
+		want, wantLSN := replayLog(t, name)
+		if len(want) == 0 {
+			t.Fatalf("%s replays to an empty database", name)
+		}
+
+		migrated := name + ".migrated"
+		if _, err := MigrateLegacyLog(name, migrated, nil); err != nil {
+			t.Fatalf("migrating version %d: %v", version, err)
+		}
+		header, _, err := parseFramedLog(mustRead(t, migrated))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if header.Version != formatVersion {
+			t.Errorf("migrated log has version %d, want %d", header.Version, formatVersion)
+		}
+		if err := VerifyLog(migrated); err != nil {
+			t.Fatalf("VerifyLog: %v", err)
+		}
+
+		got, gotLSN := replayLog(t, migrated)
+		if !reflect.DeepEqual(got, want) || gotLSN != wantLSN {
+			t.Errorf("version %d log migrated to %v at LSN %d, want %v at LSN %d", version, got, gotLSN, want, wantLSN)
+		}
+
+		// A log already in the current format is left alone
+		if _, err := MigrateLegacyLog(migrated, migrated+".again", nil); err == nil {
+			t.Error("migrating a log in the current format succeeded")
+		}
+	}
+}
+
+func mustRead(t *testing.T, name string) []byte {
+	t.Helper()
+	buf, err := os.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return buf
+}
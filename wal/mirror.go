@@ -0,0 +1,178 @@
+package wal
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+)
+
+var (
+	// ErrQuorumNotMet is returned when too few copies of the log could be synced
+	ErrQuorumNotMet = errors.New("wal: sync quorum not met")
+	// ErrMirrorDiverged is returned when a mirror's contents differ from the log
+	ErrMirrorDiverged = errors.New("wal: mirror diverges from log")
+)
+
+// mirror is a byte-for-byte copy of the log, normally on another disk
+type mirror struct {
+	file   *os.File
+	failed error // first write or sync error; a failed mirror is no longer written
+}
+
+// WithMirrors writes every append to each of filenames as well as the log, and
+// makes a sync succeed only when at least quorum copies are on stable storage.
+// The log itself counts towards the quorum and must always sync.
+func WithMirrors(quorum int, filenames ...string) Option {
+	return func(wal *WAL) {
+		wal.quorum = quorum
+		wal.mirrorNames = filenames
+	}
+}
+
+// openMirrors opens the configured mirrors and brings each up to date with the log
+func (wal *WAL) openMirrors() error {
+	for _, name := range wal.mirrorNames {
+		file, err := wal.openFile(name, os.O_APPEND|os.O_RDWR)
+		if err != nil {
+			wal.closeMirrors()
+			return err
+		}
+		wal.mirrors = append(wal.mirrors, &mirror{file: file})
+
+		if err := alignMirror(wal.file, file); err != nil {
+			wal.closeMirrors()
+			return err
+		}
+	}
+
+	return nil
+}
+
+// closeMirrors closes all mirror files
+func (wal *WAL) closeMirrors() error {
+	var firstErr error
+	for _, m := range wal.mirrors {
+		if err := m.file.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	wal.mirrors = nil
+	return firstErr
+}
+
+// alignMirror makes a mirror identical to the log, provided the two agree on
+// their common prefix: a longer mirror is truncated and a shorter one extended
+func alignMirror(log, mirrorFile *os.File) error {
+	logInfo, err := log.Stat()
+	if err != nil {
+		return err
+	}
+	mirrorInfo, err := mirrorFile.Stat()
+	if err != nil {
+		return err
+	}
+
+	common := logInfo.Size()
+	if mirrorInfo.Size() < common {
+		common = mirrorInfo.Size()
+	}
+
+	logBuf := make([]byte, 64<<10)
+	mirrorBuf := make([]byte, 64<<10)
+	for offset := int64(0); offset < common; offset += int64(len(logBuf)) {
+		n := int64(len(logBuf))
+		if common-offset < n {
+			n = common - offset
+		}
+		if _, err := log.ReadAt(logBuf[:n], offset); err != nil {
+			return err
+		}
+		if _, err := mirrorFile.ReadAt(mirrorBuf[:n], offset); err != nil {
+			return err
+		}
+		if !bytes.Equal(logBuf[:n], mirrorBuf[:n]) {
+			return fmt.Errorf("%w: %s differs from %s near offset %d", ErrMirrorDiverged, mirrorFile.Name(), log.Name(), offset)
+		}
+	}
+
+	switch {
+	case mirrorInfo.Size() > logInfo.Size():
+		if err := mirrorFile.Truncate(logInfo.Size()); err != nil {
+			return err
+		}
+	case mirrorInfo.Size() < logInfo.Size():
+		missing := io.NewSectionReader(log, common, logInfo.Size()-common)
+		if _, err := io.Copy(mirrorFile, missing); err != nil {
+			return err
+		}
+	}
+
+	return mirrorFile.Sync()
+}
+
+// writeMirrors appends bufs to every healthy mirror
+func (wal *WAL) writeMirrors(bufs [][]byte) {
+	for _, m := range wal.mirrors {
+		if m.failed != nil {
+			continue
+		}
+		if _, err := writeVectored(m.file, bufs); err != nil {
+			m.failed = err
+		}
+	}
+}
+
+// syncLog flushes the log and its mirrors to stable storage in parallel,
+// then forwards what was written to the remote appender, if any. It fails if
+// the log itself cannot be synced or fewer than quorum copies are.
+func (wal *WAL) syncLog() error {
+	if debugChecks {
+		assertHeld(&wal.logMutex, "logMutex")
+	}
+	// The next write starts a new batch, which checks the epoch again
+	wal.epochChecked = false
+
+	errs := make([]error, len(wal.mirrors))
+	var wg sync.WaitGroup
+	for i, m := range wal.mirrors {
+		if m.failed != nil {
+			errs[i] = m.failed
+			continue
+		}
+
+		i, m := i, m
+		wg.Add(1)
+		go withLabels(context.Background(), "mirror-sync", func(context.Context) {
+			defer wg.Done()
+			errs[i] = m.file.Sync()
+		})
+	}
+
+	logErr := wal.syncLogFile()
+	wg.Wait()
+	wal.noteWriteResult(logErr)
+	if logErr != nil {
+		return logErr
+	}
+
+	synced := 1
+	for i, err := range errs {
+		if err != nil {
+			if wal.mirrors[i].failed == nil {
+				wal.mirrors[i].failed = err
+			}
+			continue
+		}
+		synced++
+	}
+
+	if synced < wal.quorum {
+		return fmt.Errorf("%w: %d of %d copies synced, need %d", ErrQuorumNotMet, synced, len(wal.mirrors)+1, wal.quorum)
+	}
+
+	return wal.forwardRemote()
+}
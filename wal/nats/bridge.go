@@ -0,0 +1,178 @@
+// Package nats ships the transactions committed to a WAL over NATS
+// JetStream, typically from edge deployments to a central WAL.
+//
+// Sink publishes an edge WAL's transactions, and Source applies them to
+// the central WAL. Both record their progress in their own WAL, so either
+// side can restart or lose its connection and resume where it left off.
+// The package does not depend on a NATS client: callers adapt their
+// client's JetStream publish and consume calls to Publisher and
+// Source.Handle.
+package nats
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/rachitsh92/write-ahead-log/wal"
+)
+
+// progressPrefix starts the keys under which sinks and sources record their
+// progress. It is one of wal.ReservedPrefixes.
+const progressPrefix = "nats/"
+
+// defaultRetryInterval is how long Sink waits before publishing again after
+// a failure, unless RetryInterval is set
+const defaultRetryInterval = time.Second
+
+// Msg is a NATS message carrying one transaction. Its header holds a
+// Nats-Msg-Id unique to the transaction, so JetStream discards a message
+// published twice.
+type Msg struct {
+	Subject string
+	Header  map[string][]string
+	Data    []byte
+}
+
+// Publisher publishes messages to JetStream. Publish must return only once
+// the stream has acknowledged the message.
+type Publisher interface {
+	Publish(ctx context.Context, msg Msg) error
+}
+
+// payload is the encoding of a transaction in Msg.Data
+type payload struct {
+	Source  string   `json:"source"`
+	LSN     uint64   `json:"lsn"` // commit LSN in the source WAL
+	Records []record `json:"records"`
+}
+
+// record is one record of a payload
+type record struct {
+	Operation string `json:"op"`
+	Data      []byte `json:"data"`
+}
+
+// Sink publishes every transaction committed to a WAL, one message each
+type Sink struct {
+	WAL           *wal.WAL
+	Name          string // identifies the sink to Source; must be unique among sinks
+	Subject       string
+	Publisher     Publisher
+	RetryInterval time.Duration // wait between failed publishes; zero means one second
+}
+
+// Run publishes committed transactions until ctx is done. A failed publish,
+// e.g. while the connection to NATS is down, is retried every RetryInterval
+// by the WAL's clock. After a transaction is published its commit LSN is
+// committed under the key "nats/" + Name, and Run resumes after it. Records
+// on keys under wal.ReservedPrefixes, where sinks and relays record their
+// progress, are never published.
+func (s *Sink) Run(ctx context.Context) error {
+	progressKey := progressPrefix + s.Name
+
+	from := uint64(1)
+	if value, ok := s.WAL.Get(progressKey); ok {
+		lsn, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			return err
+		}
+		from = lsn + 1
+	}
+
+	retry := s.RetryInterval
+	if retry <= 0 {
+		retry = defaultRetryInterval
+	}
+
+	return s.WAL.Follow(ctx, from, func(txn wal.CommittedTxn) error {
+		p := payload{Source: s.Name, LSN: txn.LSN}
+		for _, r := range txn.Records {
+			if key, ok := r.Key(); ok && wal.IsReservedKey(key) {
+				continue
+			}
+			p.Records = append(p.Records, record{Operation: r.Operation, Data: []byte(r.Data)})
+		}
+		if len(p.Records) == 0 {
+			return nil
+		}
+
+		data, err := json.Marshal(p)
+		if err != nil {
+			return err
+		}
+		msg := Msg{
+			Subject: s.Subject,
+			Header:  map[string][]string{"Nats-Msg-Id": {fmt.Sprintf("%s-%d", s.Name, txn.LSN)}},
+			Data:    data,
+		}
+		for {
+			err := s.Publisher.Publish(ctx, msg)
+			if err == nil {
+				break
+			}
+			ticker := s.WAL.Clock().NewTicker(retry)
+			select {
+			case <-ctx.Done():
+				ticker.Stop()
+				return ctx.Err()
+			case <-ticker.C():
+			}
+			ticker.Stop()
+		}
+
+		progress := &wal.Txn{}
+		progress.Put(progressKey, strconv.FormatUint(txn.LSN, 10))
+		lsn, err := s.WAL.CommitTxn(progress)
+		if err != nil {
+			return err
+		}
+
+		// A restart must find the progress recorded
+		return s.WAL.WaitForLSN(ctx, lsn)
+	})
+}
+
+// Source applies transactions published by sinks to a WAL
+type Source struct {
+	WAL *wal.WAL
+}
+
+// Handle commits the transaction carried by a message published by a Sink,
+// together with the sink's progress, under the key "nats/from/" and the
+// sink's name. A transaction the source has already committed is ignored,
+// so redelivered messages are harmless. Acknowledge the message to
+// JetStream only once Handle returns nil.
+func (s *Source) Handle(msg Msg) error {
+	var p payload
+	if err := json.Unmarshal(msg.Data, &p); err != nil {
+		return fmt.Errorf("nats: bad message: %w", err)
+	}
+	progressKey := progressPrefix + "from/" + p.Source
+
+	// Sinks publish in order, so anything at or before the last LSN
+	// committed has been seen
+	txn := s.WAL.BeginTxn()
+	if value, ok := s.WAL.Get(progressKey); ok {
+		lsn, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			return err
+		}
+		if p.LSN <= lsn {
+			return nil
+		}
+	}
+
+	for _, r := range p.Records {
+		txn.Write(r.Operation, string(r.Data))
+	}
+	txn.Put(progressKey, strconv.FormatUint(p.LSN, 10))
+
+	lsn, err := s.WAL.CommitTxn(txn)
+	if err != nil {
+		return err
+	}
+	return s.WAL.WaitForLSN(context.Background(), lsn)
+}
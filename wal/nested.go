@@ -0,0 +1,52 @@
+package wal
+
+import "errors"
+
+// ErrTxnDone is returned when a nested transaction is committed or rolled
+// back a second time
+var ErrTxnDone = errors.New("wal: nested transaction already finished")
+
+// ErrNotNested is returned when committing a transaction that was not
+// started with Begin; top-level transactions are committed with CommitTxn
+var ErrNotNested = errors.New("wal: not a nested transaction")
+
+// Begin starts a transaction nested in txn. Its writes join txn when it
+// commits and are discarded when it rolls back. Nothing reaches the log
+// until the top-level transaction is committed with CommitTxn, so replay
+// only ever sees the writes that survived, in the order they joined it.
+func (txn *Txn) Begin() *Txn {
+	return &Txn{parent: txn}
+}
+
+// Commit merges a nested transaction's writes into its parent, after any
+// the parent already holds
+func (txn *Txn) Commit() error {
+	if txn.parent == nil {
+		return ErrNotNested
+	}
+	if txn.done {
+		return ErrTxnDone
+	}
+
+	txn.done = true
+	for _, record := range txn.records {
+		txn.parent.Write(record.Operation, record.Data)
+	}
+	txn.records = nil
+	return nil
+}
+
+// Rollback discards a nested transaction's writes, including those of
+// transactions nested in it that already committed into it
+func (txn *Txn) Rollback() error {
+	if txn.parent == nil {
+		return ErrNotNested
+	}
+	if txn.done {
+		return ErrTxnDone
+	}
+
+	txn.done = true
+	txn.records = nil
+	return nil
+}
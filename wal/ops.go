@@ -0,0 +1,189 @@
+package wal
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"strconv"
+)
+
+// Key-value operations understood by the in-memory database. Each is logged
+// as a record in the current transaction and applied when it commits, so
+// replay reproduces exactly the same state.
+const (
+	OpPut            = "PUT"
+	OpDelete         = "DELETE"
+	OpIncrement      = "INCREMENT"
+	OpAppend         = "APPEND"
+	OpCompareAndSwap = "CAS"
+)
+
+// errMalformedFields is returned when record data cannot be split into fields
+var errMalformedFields = errors.New("wal: malformed record fields")
+
+// Put sets key to value
+func (wal *WAL) Put(key, value string) error {
+	return wal.WriteRecord(OpPut, encodeFields(key, value))
+}
+
+// Delete removes key
+func (wal *WAL) Delete(key string) error {
+	return wal.WriteRecord(OpDelete, encodeFields(key))
+}
+
+// Increment adds delta to the integer stored under key. A missing key or a
+// value that is not an integer counts as zero.
+func (wal *WAL) Increment(key string, delta int64) error {
+	return wal.WriteRecord(OpIncrement, encodeFields(key, strconv.FormatInt(delta, 10)))
+}
+
+// Append appends suffix to the value stored under key
+func (wal *WAL) Append(key, suffix string) error {
+	return wal.WriteRecord(OpAppend, encodeFields(key, suffix))
+}
+
+// CompareAndSwap sets key to value if, when the transaction is applied, it
+// currently holds expected. Otherwise the operation has no effect.
+func (wal *WAL) CompareAndSwap(key, expected, value string) error {
+	return wal.WriteRecord(OpCompareAndSwap, encodeFields(key, expected, value))
+}
+
+// PutInt64 stores an integer under key
+func (wal *WAL) PutInt64(key string, value int64) error {
+	return wal.Put(key, strconv.FormatInt(value, 10))
+}
+
+// GetInt64 returns the integer stored under key
+func (wal *WAL) GetInt64(key string) (int64, bool, error) {
+	value, ok := wal.Get(key)
+	if !ok {
+		return 0, false, nil
+	}
+
+	n, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return 0, true, err
+	}
+	return n, true, nil
+}
+
+// PutJSON stores the JSON encoding of v under key
+func (wal *WAL) PutJSON(key string, v interface{}) error {
+	buf, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return wal.Put(key, string(buf))
+}
+
+// GetJSON decodes the JSON value stored under key into v
+func (wal *WAL) GetJSON(key string, v interface{}) (bool, error) {
+	value, ok := wal.Get(key)
+	if !ok {
+		return false, nil
+	}
+	return true, json.Unmarshal([]byte(value), v)
+}
+
+// applyOperation applies a key-value record to the database. Malformed
+// records are ignored so that replay never fails on them. The caller must
+// hold dbMutex.
+func (wal *WAL) applyOperation(record LogRecord) {
+	fields, err := decodeFields(record.Data)
+	if err != nil || len(fields) == 0 {
+		return
+	}
+
+	key := fields[0]
+	current, exists := wal.inMemoryDB[key]
+
+	switch {
+	case record.Operation == OpPut && len(fields) == 2:
+		wal.setKey(key, fields[1])
+		delete(wal.expiries, key)
+	case record.Operation == OpDelete && len(fields) == 1:
+		wal.deleteKey(key)
+		delete(wal.expiries, key)
+	case record.Operation == opPutTTL && len(fields) == 3:
+		expiresAt, err := strconv.ParseInt(fields[2], 10, 64)
+		if err != nil {
+			return
+		}
+		wal.setKey(key, fields[1])
+		wal.expiries[key] = expiresAt
+		wal.startExpiryWorker()
+	case record.Operation == opExpire && len(fields) == 1:
+		wal.deleteKey(key)
+		delete(wal.expiries, key)
+	case record.Operation == OpIncrement && len(fields) == 2:
+		delta, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil {
+			return
+		}
+		n, _ := strconv.ParseInt(current, 10, 64)
+		wal.setKey(key, strconv.FormatInt(n+delta, 10))
+	case record.Operation == OpAppend && len(fields) == 2:
+		wal.setKey(key, current+fields[1])
+	case record.Operation == OpCompareAndSwap && len(fields) == 3:
+		if exists && current == fields[1] {
+			wal.setKey(key, fields[2])
+		}
+	}
+}
+
+// encodeFields packs strings into record data, each prefixed by its length
+func encodeFields(fields ...string) string {
+	buf := make([]byte, 0, 16)
+	for _, field := range fields {
+		buf = binary.AppendUvarint(buf, uint64(len(field)))
+		buf = append(buf, field...)
+	}
+	return string(buf)
+}
+
+// decodeFields unpacks record data written by encodeFields
+func decodeFields(data string) ([]string, error) {
+	buf := []byte(data)
+	fields := []string{}
+	for len(buf) > 0 {
+		n, size := binary.Uvarint(buf)
+		if size <= 0 || n > uint64(len(buf)-size) {
+			return nil, errMalformedFields
+		}
+		fields = append(fields, string(buf[size:size+int(n)]))
+		buf = buf[size+int(n):]
+	}
+	return fields, nil
+}
+
+// recordKey returns the key a key-value operation acts on, reading it in
+// place rather than decoding every field
+func recordKey(record LogRecord) (string, bool) {
+	switch record.Operation {
+	case OpPut, OpDelete, OpIncrement, OpAppend, OpCompareAndSwap, opPutTTL, opExpire, opCheck:
+	default:
+		return "", false
+	}
+
+	head := record.Data
+	if len(head) > binary.MaxVarintLen64 {
+		head = head[:binary.MaxVarintLen64]
+	}
+	n, size := binary.Uvarint([]byte(head))
+	if size <= 0 || n > uint64(len(record.Data)-size) {
+		return "", false
+	}
+	return record.Data[size : size+int(n)], true
+}
+
+// Key returns the key the record acts on, if it is a key-value operation
+func (record LogRecord) Key() (string, bool) {
+	return recordKey(record)
+}
+
+// Fields decodes the data of a record written by a key-value operation, such
+// as the key and value of OpPut, or the key, expected and new values of
+// OpCompareAndSwap
+func (record LogRecord) Fields() ([]string, error) {
+	return decodeFields(record.Data)
+}
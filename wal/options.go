@@ -0,0 +1,12 @@
+package wal
+
+// Option configures a WAL when it is opened
+type Option func(*WAL)
+
+// WithRecoveryProgress registers a callback that is invoked periodically
+// while the log is replayed on open, and once more when replay finishes
+func WithRecoveryProgress(fn func(RecoveryProgress)) Option {
+	return func(wal *WAL) {
+		wal.recoveryProgress = fn
+	}
+}
@@ -0,0 +1,57 @@
+package wal
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+)
+
+// orphanSuffixes name the temporary files that operations replacing a log
+// create next to it: relocation and migration, DropBefore, repair,
+// redaction, compaction, restores and epoch updates
+var orphanSuffixes = []string{".tmp", ".drop", ".repair", redactSuffix, compactSuffix, restoreSuffix, epochSuffix + ".tmp"}
+
+// FindOrphans lists temporary files that interrupted operations left next
+// to the log at filename. NewWAL removes them when it opens the log.
+func FindOrphans(filename string) ([]string, error) {
+	orphans := []string{}
+	for _, suffix := range orphanSuffixes {
+		name := filename + suffix
+		_, err := os.Lstat(name)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		orphans = append(orphans, name)
+	}
+
+	return orphans, nil
+}
+
+// removeOrphans removes the temporary files left next to the log, and
+// unfinished recovery profiles. With fencing, it must only run once the
+// WAL has claimed its epoch, so the files of the writer it fences off are
+// never removed while that writer could still own the log.
+func (wal *WAL) removeOrphans(filename string) error {
+	orphans, err := FindOrphans(filename)
+	if err != nil {
+		return err
+	}
+	if wal.profileDir != "" {
+		profiles, err := filepath.Glob(filepath.Join(wal.profileDir, "recovery-cpu-*.pprof.tmp"))
+		if err != nil {
+			return err
+		}
+		orphans = append(orphans, profiles...)
+	}
+
+	for _, name := range orphans {
+		if err := os.Remove(name); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,89 @@
+package wal
+
+import (
+	"context"
+	"strconv"
+)
+
+// opOutbox is a message to publish once its transaction commits. Its data is
+// the topic and payload. It changes nothing in the database.
+const opOutbox = "OUTBOX"
+
+// outboxPrefix starts the keys under which relays record their progress. It
+// is one of ReservedPrefixes.
+const outboxPrefix = "outbox/"
+
+// OutboxMessage is a message written to the outbox by a committed transaction
+type OutboxMessage struct {
+	LSN     uint64 // LSN of the transaction's commit record
+	Topic   string
+	Payload string
+}
+
+// Publisher delivers outbox messages to a message broker such as Kafka or SQS
+type Publisher interface {
+	Publish(ctx context.Context, msg OutboxMessage) error
+}
+
+// Outbox adds a message to the transaction, to be published by RelayOutbox
+// once the transaction commits. The message is committed atomically with
+// the transaction's other records, and never published if it aborts.
+func (txn *Txn) Outbox(topic, payload string) {
+	txn.Write(opOutbox, encodeFields(topic, payload))
+}
+
+// WriteOutbox is Txn.Outbox for the transaction being built with WriteRecord
+func (wal *WAL) WriteOutbox(topic, payload string) error {
+	return wal.WriteRecord(opOutbox, encodeFields(topic, payload))
+}
+
+// RelayOutbox passes the outbox messages of committed transactions to pub,
+// in commit order, until ctx is done or pub fails. After all the messages of
+// a transaction are published its commit LSN is committed under the key
+// "outbox/" + name, and a relay of the same name resumes after it. Delivery
+// is at least once: messages published before a failure or crash and not
+// yet recorded are published again. Messages in transactions dropped with
+// DropBefore before they were relayed are lost.
+func (wal *WAL) RelayOutbox(ctx context.Context, name string, pub Publisher) error {
+	key := outboxPrefix + name
+
+	from := uint64(1)
+	if value, ok := wal.Get(key); ok {
+		acked, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			return err
+		}
+		from = acked + 1
+	}
+
+	return wal.Follow(ctx, from, func(txn CommittedTxn) error {
+		published := false
+		for _, record := range txn.Records {
+			if record.Operation != opOutbox {
+				continue
+			}
+			fields, err := record.Fields()
+			if err != nil || len(fields) != 2 {
+				continue
+			}
+			msg := OutboxMessage{LSN: txn.LSN, Topic: fields[0], Payload: fields[1]}
+			if err := pub.Publish(ctx, msg); err != nil {
+				return err
+			}
+			published = true
+		}
+		if !published {
+			return nil
+		}
+
+		ack := &Txn{}
+		ack.Put(key, strconv.FormatUint(txn.LSN, 10))
+		lsn, err := wal.CommitTxn(ack)
+		if err != nil {
+			return err
+		}
+
+		// A restart must find the progress recorded
+		return wal.WaitForLSN(ctx, lsn)
+	})
+}
@@ -0,0 +1,111 @@
+package wal
+
+import (
+	"errors"
+	"io"
+)
+
+// TrimPlan describes what Truncate or DropBefore would remove from a log
+type TrimPlan struct {
+	Boundary  uint64 // Truncate keeps the records up to this LSN; DropBefore drops them
+	FirstLSN  uint64 // first LSN that would be removed; zero if nothing would
+	LastLSN   uint64 // last LSN that would be removed
+	Records   int    // records that would be removed
+	Committed int    // committed transactions among them
+}
+
+// PlanTruncate reports what Truncate(afterLSN) would remove from the log at
+// filename, without changing it. A transaction cut in two is removed whole,
+// as is a transaction left incomplete at the end of the log, which any
+// reopening removes anyway.
+func PlanTruncate(filename string, afterLSN uint64) (*TrimPlan, error) {
+	records, err := readLogFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	plan := &TrimPlan{}
+	open := false
+	for _, record := range records {
+		if record.LSN > afterLSN {
+			break
+		}
+		switch record.Operation {
+		case opCommit, opAbort:
+			open = false
+		case opNoop, opChain, opConfig:
+		default:
+			open = true
+		}
+		if !open {
+			plan.Boundary = record.LSN
+		}
+	}
+
+	for _, record := range records {
+		if record.LSN > plan.Boundary {
+			plan.remove(record)
+		}
+	}
+	return plan, nil
+}
+
+// PlanDropBefore reports what DropBefore(lsn) would remove from the log at
+// filename, without changing it
+func PlanDropBefore(filename string, lsn uint64) (*TrimPlan, error) {
+	records, err := readLogFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	plan := &TrimPlan{}
+	for _, record := range records {
+		if record.LSN >= lsn {
+			break
+		}
+		if record.Operation == opCommit || record.Operation == opAbort {
+			plan.Boundary = record.LSN
+		}
+	}
+
+	for _, record := range records {
+		if record.LSN <= plan.Boundary {
+			plan.remove(record)
+		}
+	}
+	return plan, nil
+}
+
+// remove counts record as removed
+func (p *TrimPlan) remove(record LogRecord) {
+	if p.FirstLSN == 0 {
+		p.FirstLSN = record.LSN
+	}
+	p.LastLSN = record.LSN
+	p.Records++
+	if record.Operation == opCommit {
+		p.Committed++
+	}
+}
+
+// readLogFile reads the records of the log at filename, up to the first
+// damaged one
+func readLogFile(filename string) ([]LogRecord, error) {
+	lr, err := OpenLogReader(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer lr.Close()
+
+	var records []LogRecord
+	for {
+		record, err := lr.Next()
+		if err == io.EOF || errors.Is(err, ErrCorruptRecord) {
+			return records, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, record)
+	}
+}
@@ -0,0 +1,82 @@
+package wal
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime/pprof"
+	"time"
+)
+
+// WithRecoveryProfile profiles replay of the log on open. If replay takes
+// longer than threshold, its CPU profile and a heap profile taken at the end
+// are kept in dir for diagnosing slow startups; otherwise they are discarded.
+func WithRecoveryProfile(threshold time.Duration, dir string) Option {
+	return func(wal *WAL) {
+		wal.profileThreshold = threshold
+		wal.profileDir = dir
+	}
+}
+
+// withLabels runs fn with pprof labels identifying a WAL goroutine's role
+func withLabels(ctx context.Context, role string, fn func(context.Context)) {
+	pprof.Do(ctx, pprof.Labels("wal", role), fn)
+}
+
+// recoveryProfile is a CPU profile being captured during replay
+type recoveryProfile struct {
+	file      *os.File
+	threshold time.Duration
+	clock     Clock
+	start     time.Time
+	mode      os.FileMode
+}
+
+// startRecoveryProfile starts profiling replay, if configured. Profiling is
+// best effort: if it cannot start, e.g. because another CPU profile is
+// running, replay goes ahead without it.
+func (wal *WAL) startRecoveryProfile() *recoveryProfile {
+	if wal.profileDir == "" {
+		return nil
+	}
+
+	file, err := os.CreateTemp(wal.profileDir, "recovery-cpu-*.pprof.tmp")
+	if err != nil {
+		return nil
+	}
+	if err := pprof.StartCPUProfile(file); err != nil {
+		file.Close()
+		os.Remove(file.Name())
+		return nil
+	}
+
+	return &recoveryProfile{file: file, threshold: wal.profileThreshold, clock: wal.clock, start: wal.clock.Now(), mode: wal.fileMode}
+}
+
+// stop ends the profile and keeps it only if replay was slow
+func (p *recoveryProfile) stop() {
+	if p == nil {
+		return
+	}
+
+	pprof.StopCPUProfile()
+	p.file.Close()
+
+	elapsed := p.clock.Now().Sub(p.start)
+	if elapsed <= p.threshold {
+		os.Remove(p.file.Name())
+		return
+	}
+
+	dir := filepath.Dir(p.file.Name())
+	stamp := p.start.Format("20060102-150405")
+	os.Rename(p.file.Name(), filepath.Join(dir, fmt.Sprintf("recovery-cpu-%s.pprof", stamp)))
+
+	heap, err := os.OpenFile(filepath.Join(dir, fmt.Sprintf("recovery-heap-%s.pprof", stamp)), os.O_CREATE|os.O_WRONLY|os.O_TRUNC, p.mode)
+	if err != nil {
+		return
+	}
+	defer heap.Close()
+	pprof.WriteHeapProfile(heap)
+}
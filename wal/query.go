@@ -0,0 +1,96 @@
+package wal
+
+import (
+	"sort"
+	"strings"
+)
+
+// Iterator walks a point-in-time view of the in-memory database in key order
+type Iterator struct {
+	db     map[string]string
+	prefix string
+	keys   []string
+	pos    int
+	loaded bool
+}
+
+// Get returns the value stored under key
+func (wal *WAL) Get(key string) (string, bool) {
+	wal.dbMutex.Lock()
+	defer wal.dbMutex.Unlock()
+
+	value, ok := wal.inMemoryDB[key]
+	return value, ok
+}
+
+// Scan calls fn for each key starting with prefix, in key order, until fn
+// returns false. It sees the database as it was when Scan was called, and fn
+// may safely call back into the WAL.
+func (wal *WAL) Scan(prefix string, fn func(key, value string) bool) {
+	it := wal.NewIterator(prefix)
+	for it.Next() {
+		if !fn(it.Key(), it.Value()) {
+			return
+		}
+	}
+}
+
+// NewIterator returns an iterator over the keys starting with prefix. The
+// iterator sees the database as it was when it was created; later commits
+// are not visible to it.
+func (wal *WAL) NewIterator(prefix string) *Iterator {
+	return &Iterator{db: wal.snapshotDB(), prefix: prefix, pos: -1}
+}
+
+// Next advances the iterator and reports whether there is a current entry
+func (it *Iterator) Next() bool {
+	if !it.loaded {
+		for key := range it.db {
+			if strings.HasPrefix(key, it.prefix) {
+				it.keys = append(it.keys, key)
+			}
+		}
+		sort.Strings(it.keys)
+		it.loaded = true
+	}
+
+	if it.pos < len(it.keys) {
+		it.pos++
+	}
+	return it.pos < len(it.keys)
+}
+
+// Key returns the key of the current entry
+func (it *Iterator) Key() string {
+	return it.keys[it.pos]
+}
+
+// Value returns the value of the current entry
+func (it *Iterator) Value() string {
+	return it.db[it.keys[it.pos]]
+}
+
+// snapshotDB returns the current database map without copying it. The map is
+// marked shared so the next change copies it first, leaving the snapshot intact.
+func (wal *WAL) snapshotDB() map[string]string {
+	wal.dbMutex.Lock()
+	defer wal.dbMutex.Unlock()
+
+	wal.dbShared = true
+	return wal.inMemoryDB
+}
+
+// mutableDB returns the database map for modification, copying it first if
+// a snapshot still refers to it. The caller must hold dbMutex.
+func (wal *WAL) mutableDB() map[string]string {
+	if wal.dbShared {
+		db := make(map[string]string, len(wal.inMemoryDB))
+		for key, value := range wal.inMemoryDB {
+			db[key] = value
+		}
+		wal.inMemoryDB = db
+		wal.dbShared = false
+	}
+
+	return wal.inMemoryDB
+}
@@ -0,0 +1,209 @@
+// Package queue provides a crash-safe work queue stored in a WAL.
+//
+// Every enqueued message is committed to the log as a transaction, and
+// acknowledging a message commits its deletion, so a queue reopened after a
+// crash holds exactly the messages that were enqueued and not acknowledged.
+// Delivery is at least once: messages dequeued but not acknowledged before
+// a crash are delivered again.
+package queue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/rachitsh92/write-ahead-log/wal"
+)
+
+// ErrUnknownMessage is returned by Ack and Nack for a message that is not
+// currently dequeued
+var ErrUnknownMessage = errors.New("queue: unknown message")
+
+// Message is a message taken from a queue
+type Message struct {
+	ID   uint64 // increases with every message enqueued
+	Body string
+}
+
+// Queue is a named queue stored in a WAL under keys starting with its name.
+// It is safe for concurrent use.
+type Queue struct {
+	wal  *wal.WAL
+	name string
+
+	mu      sync.Mutex
+	next    uint64             // ID of the last message enqueued
+	ready   []Message          // waiting to be dequeued, in ID order
+	leased  map[uint64]Message // dequeued but not yet acknowledged
+	waiting chan struct{}      // closed when a message becomes ready
+}
+
+// Open loads the queue called name from w. Messages that were dequeued but
+// not acknowledged before w was last closed are ready to be dequeued again.
+func Open(w *wal.WAL, name string) (*Queue, error) {
+	q := &Queue{
+		wal:     w,
+		name:    name,
+		leased:  make(map[uint64]Message),
+		waiting: make(chan struct{}),
+	}
+
+	if value, ok := w.Get(q.nextKey()); ok {
+		next, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("queue %s: bad message counter %q", name, value)
+		}
+		q.next = next
+	}
+
+	prefix := q.messagePrefix()
+	var err error
+	w.Scan(prefix, func(key, value string) bool {
+		var id uint64
+		if id, err = strconv.ParseUint(strings.TrimPrefix(key, prefix), 10, 64); err != nil {
+			err = fmt.Errorf("queue %s: bad message key %q", name, key)
+			return false
+		}
+		q.ready = append(q.ready, Message{ID: id, Body: value})
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return q, nil
+}
+
+// Enqueue durably appends a message to the queue and returns its ID.
+// Enqueues to the same queue are committed one at a time.
+func (q *Queue) Enqueue(body string) (uint64, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	id := q.next + 1
+	txn := &wal.Txn{}
+	txn.Put(q.messageKey(id), body)
+	txn.Put(q.nextKey(), strconv.FormatUint(id, 10))
+	if _, err := q.wal.CommitTxn(txn); err != nil {
+		return 0, err
+	}
+
+	q.next = id
+	q.ready = append(q.ready, Message{ID: id, Body: body})
+	q.wake()
+	return id, nil
+}
+
+// TryDequeue takes the oldest ready message without waiting, and reports
+// whether there was one. The message is redelivered if it is not
+// acknowledged before the queue is reopened, or if it is passed to Nack.
+func (q *Queue) TryDequeue() (Message, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if len(q.ready) == 0 {
+		return Message{}, false
+	}
+	msg := q.ready[0]
+	q.ready = q.ready[1:]
+	q.leased[msg.ID] = msg
+	return msg, true
+}
+
+// Dequeue is like TryDequeue but waits for a message until ctx is done
+func (q *Queue) Dequeue(ctx context.Context) (Message, error) {
+	for {
+		if msg, ok := q.TryDequeue(); ok {
+			return msg, nil
+		}
+
+		q.mu.Lock()
+		waiting := q.waiting
+		q.mu.Unlock()
+
+		// A message may have arrived between TryDequeue and taking the
+		// channel, which then is already closed
+		select {
+		case <-ctx.Done():
+			return Message{}, ctx.Err()
+		case <-waiting:
+		}
+	}
+}
+
+// Ack durably removes a dequeued message from the queue
+func (q *Queue) Ack(id uint64) error {
+	q.mu.Lock()
+	msg, ok := q.leased[id]
+	delete(q.leased, id)
+	q.mu.Unlock()
+
+	if !ok {
+		return fmt.Errorf("%w: %d", ErrUnknownMessage, id)
+	}
+
+	txn := &wal.Txn{}
+	txn.Delete(q.messageKey(id))
+	if _, err := q.wal.CommitTxn(txn); err != nil {
+		// Still not acknowledged; let it be retried
+		q.mu.Lock()
+		q.leased[id] = msg
+		q.mu.Unlock()
+		return err
+	}
+	return nil
+}
+
+// Nack returns a dequeued message to the queue, ahead of any newer message
+func (q *Queue) Nack(id uint64) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	msg, ok := q.leased[id]
+	if !ok {
+		return fmt.Errorf("%w: %d", ErrUnknownMessage, id)
+	}
+	delete(q.leased, id)
+
+	i := sort.Search(len(q.ready), func(i int) bool { return q.ready[i].ID > id })
+	q.ready = append(q.ready, Message{})
+	copy(q.ready[i+1:], q.ready[i:])
+	q.ready[i] = msg
+	q.wake()
+	return nil
+}
+
+// Len returns how many messages are ready and how many are dequeued but not
+// yet acknowledged
+func (q *Queue) Len() (ready, leased int) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return len(q.ready), len(q.leased)
+}
+
+// wake releases the goroutines waiting in Dequeue. The caller must hold mu.
+func (q *Queue) wake() {
+	close(q.waiting)
+	q.waiting = make(chan struct{})
+}
+
+// messagePrefix is the prefix of the keys holding the queue's messages
+func (q *Queue) messagePrefix() string {
+	return q.name + "/msg/"
+}
+
+// messageKey returns the key holding message id. IDs are zero padded so
+// that key order is ID order.
+func (q *Queue) messageKey(id uint64) string {
+	return fmt.Sprintf("%s%020d", q.messagePrefix(), id)
+}
+
+// nextKey is the key holding the ID of the last message enqueued
+func (q *Queue) nextKey() string {
+	return q.name + "/next"
+}
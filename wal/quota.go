@@ -0,0 +1,88 @@
+package wal
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrQuotaExceeded is returned when writing a record would take the log and
+// snapshot past the WithDiskQuota limit
+var ErrQuotaExceeded = errors.New("wal: disk quota exceeded")
+
+// WithDiskQuota rejects new records with ErrQuotaExceeded once the log and
+// the database snapshot together would exceed limit bytes. Commit and abort
+// records are always written, so a transaction in progress can still be
+// finished. Space is freed by dropping the start of the log with DropBefore.
+func WithDiskQuota(limit int64) Option {
+	return func(wal *WAL) {
+		wal.diskQuota = limit
+	}
+}
+
+// limitWarnPercent is the share of a limit, in percent, from which
+// WithQuotaWarning and WithLimitWarning warn
+const limitWarnPercent = 80
+
+// WithQuotaWarning calls fn once disk usage reaches 80% of the WithDiskQuota
+// limit, with warning set, and again with it unset once usage is back
+// below, so operators can free space before writes start failing with
+// ErrQuotaExceeded. Usage is checked as records are written and when the
+// quota is changed. fn runs under the log lock, so it must not call the WAL.
+func WithQuotaWarning(fn func(usage, limit int64, warning bool)) Option {
+	return func(wal *WAL) {
+		wal.quotaWarn = fn
+	}
+}
+
+// DiskUsage returns the bytes used by the log and the database snapshot
+func (wal *WAL) DiskUsage() int64 {
+	wal.logMutex.Lock()
+	defer wal.logMutex.Unlock()
+
+	return wal.diskUsage()
+}
+
+// diskUsage returns the bytes used by the log and the database snapshot. The
+// caller must hold logMutex.
+func (wal *WAL) diskUsage() int64 {
+	wal.dbMutex.Lock()
+	defer wal.dbMutex.Unlock()
+
+	return wal.logSize + wal.snapshotSize
+}
+
+// checkQuota fails if writing a record of n bytes would exceed the disk
+// quota. The caller must hold logMutex.
+func (wal *WAL) checkQuota(n int) error {
+	if wal.diskQuota <= 0 {
+		return nil
+	}
+
+	usage := wal.diskUsage()
+	if usage+int64(n) > wal.diskQuota {
+		wal.noteUsage(usage)
+		return fmt.Errorf("%w: %d of %d bytes used", ErrQuotaExceeded, usage, wal.diskQuota)
+	}
+	wal.noteUsage(usage + int64(n))
+
+	return nil
+}
+
+// noteUsage tells the WithQuotaWarning callback when usage has crossed the
+// warning level since it was last called. The caller must hold logMutex.
+func (wal *WAL) noteUsage(usage int64) {
+	if wal.quotaWarn == nil {
+		return
+	}
+
+	warning := wal.diskQuota > 0 && nearLimit(usage, wal.diskQuota)
+	if warning != wal.quotaWarned {
+		wal.quotaWarned = warning
+		wal.quotaWarn(usage, wal.diskQuota, warning)
+	}
+}
+
+// nearLimit reports whether usage has reached the warning level of limit
+func nearLimit(usage, limit int64) bool {
+	return usage*100 >= limit*limitWarnPercent
+}
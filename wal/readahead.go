@@ -0,0 +1,82 @@
+package wal
+
+import (
+	"context"
+	"io"
+)
+
+const (
+	// readAheadChunk is how much the read-ahead goroutine reads at a time
+	readAheadChunk = 1 << 20
+	// readAheadDepth is how many chunks may be read ahead of the consumer
+	readAheadDepth = 4
+)
+
+// readAheadChunkResult is one chunk read ahead, or the error that ended reading
+type readAheadChunkResult struct {
+	buf []byte
+	err error
+}
+
+// readAhead reads a file sequentially on a background goroutine, so that
+// decoding one chunk overlaps with reading the next ones
+type readAhead struct {
+	chunks chan readAheadChunkResult
+	stop   chan struct{}
+	done   chan struct{}
+	buf    []byte
+	err    error
+}
+
+// newReadAhead starts reading r ahead of the caller, who must Close it
+func newReadAhead(r io.Reader) *readAhead {
+	ra := &readAhead{
+		chunks: make(chan readAheadChunkResult, readAheadDepth),
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+
+	go withLabels(context.Background(), "readahead", func(context.Context) {
+		defer close(ra.done)
+		for {
+			buf := make([]byte, readAheadChunk)
+			n, err := io.ReadFull(r, buf)
+			if err == io.ErrUnexpectedEOF {
+				err = io.EOF
+			}
+
+			select {
+			case ra.chunks <- readAheadChunkResult{buf: buf[:n], err: err}:
+			case <-ra.stop:
+				return
+			}
+			if err != nil {
+				return
+			}
+		}
+	})
+
+	return ra
+}
+
+// Read returns data read ahead, waiting for it if necessary
+func (ra *readAhead) Read(p []byte) (int, error) {
+	for len(ra.buf) == 0 {
+		if ra.err != nil {
+			return 0, ra.err
+		}
+		chunk := <-ra.chunks
+		ra.buf, ra.err = chunk.buf, chunk.err
+	}
+
+	n := copy(p, ra.buf)
+	ra.buf = ra.buf[n:]
+	return n, nil
+}
+
+// Close stops reading ahead and waits for the goroutine to exit
+func (ra *readAhead) Close() error {
+	close(ra.stop)
+	<-ra.done
+	return nil
+}
@@ -0,0 +1,79 @@
+package wal
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"os"
+)
+
+// LogReader reads the records of a log file in order without opening a WAL
+// on it, so it can read a log that another process is writing. Each reader
+// has a file handle of its own, so any number of them can read a log at
+// once; a single reader is not safe for concurrent use.
+type LogReader struct {
+	file    *os.File
+	r       *bufio.Reader
+	header  logHeader
+	offset  int64  // offset following the last record read
+	lastLSN uint64 // LSN of the last record returned
+}
+
+// OpenLogReader opens the log at filename for reading
+func OpenLogReader(filename string) (*LogReader, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	r := bufio.NewReader(file)
+	header, err := readHeader(r)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	return &LogReader{file: file, r: r, header: header, offset: headerSize}, nil
+}
+
+// Next returns the next record. Padding and records written twice by a
+// retried append are skipped. At the end of the log it returns io.EOF, and
+// at a damaged or partly written record an error wrapping ErrCorruptRecord;
+// either way the reader stays where it was, so Next can be called again
+// once more of the log has been written.
+func (lr *LogReader) Next() (LogRecord, error) {
+	for {
+		record, n, err := readRecord(lr.r, lr.header.Version)
+		if err != nil {
+			if err == io.EOF || errors.Is(err, ErrCorruptRecord) {
+				if _, seekErr := lr.file.Seek(lr.offset, io.SeekStart); seekErr != nil {
+					return LogRecord{}, seekErr
+				}
+				lr.r.Reset(lr.file)
+			}
+			return LogRecord{}, err
+		}
+		lr.offset += int64(n)
+
+		if record.Operation == opPad || (lr.lastLSN != 0 && record.LSN <= lr.lastLSN) {
+			continue
+		}
+		lr.lastLSN = record.LSN
+		return record, nil
+	}
+}
+
+// BaseLSN returns the LSN preceding the first record in the log
+func (lr *LogReader) BaseLSN() uint64 {
+	return lr.header.BaseLSN
+}
+
+// Version returns the format version of the log
+func (lr *LogReader) Version() uint32 {
+	return lr.header.Version
+}
+
+// Close closes the log file
+func (lr *LogReader) Close() error {
+	return lr.file.Close()
+}
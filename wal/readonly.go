@@ -0,0 +1,47 @@
+package wal
+
+// ReadTxn is a read-only transaction: a stable view of the database as of
+// the transaction committed at its LSN. Reading from it never blocks
+// writers, and commits made after it began are not visible to it.
+type ReadTxn struct {
+	db  map[string]string
+	lsn uint64
+}
+
+// BeginReadOnly starts a read-only transaction pinned to the last
+// transaction applied to the database
+func (wal *WAL) BeginReadOnly() *ReadTxn {
+	// A transaction being applied is seen whole or not at all
+	wal.applying.RLock()
+	defer wal.applying.RUnlock()
+
+	db := wal.snapshotDB()
+	return &ReadTxn{db: db, lsn: wal.CommittedLSN()}
+}
+
+// LSN returns the LSN of the last commit the transaction sees
+func (txn *ReadTxn) LSN() uint64 {
+	return txn.lsn
+}
+
+// Get returns the value stored under key
+func (txn *ReadTxn) Get(key string) (string, bool) {
+	value, ok := txn.db[key]
+	return value, ok
+}
+
+// Scan calls fn for each key starting with prefix, in key order, until fn
+// returns false
+func (txn *ReadTxn) Scan(prefix string, fn func(key, value string) bool) {
+	it := txn.NewIterator(prefix)
+	for it.Next() {
+		if !fn(it.Key(), it.Value()) {
+			return
+		}
+	}
+}
+
+// NewIterator returns an iterator over the keys starting with prefix
+func (txn *ReadTxn) NewIterator(prefix string) *Iterator {
+	return &Iterator{db: txn.db, prefix: prefix, pos: -1}
+}
@@ -0,0 +1,234 @@
+package wal
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// opConfig records an option changed with SetOption. Its data is the time
+// of the change, in Unix nanoseconds, and the option's name and new value.
+// Like a heartbeat it stands on its own outside a transaction, becomes part
+// of one written during it, and changes nothing.
+const opConfig = "CONFIG"
+
+// ErrNotRuntimeOption is returned by SetOption for an option that cannot be
+// changed while the log is open
+var ErrNotRuntimeOption = errors.New("wal: option cannot be changed at runtime")
+
+// ConfigChange is a change of option recorded in the log
+type ConfigChange struct {
+	LSN   uint64
+	Time  time.Time
+	Name  string
+	Value string
+}
+
+// SetOption changes an option of the open WAL, named as in Config:
+//
+//   - heartbeat: the heartbeat interval, zero to stop heartbeats
+//   - expiry_interval: how often the expiry worker runs
+//   - disk_quota: the disk quota in bytes, zero for none
+//   - max_clock_offset: the hybrid clock's limit, with WithHybridClock
+//
+// Every change is written to the log and synced before it takes effect, so
+// the log shows what was changed when. ConfigChangeOf reads such a record.
+// A follower, whose log holds only its primary's records, makes the change
+// without recording it. Setting an option to its current value does
+// nothing. The changes are not replayed when the log is reopened.
+func (wal *WAL) SetOption(name, value string) error {
+	wal.configMutex.Lock()
+	defer wal.configMutex.Unlock()
+
+	var apply func()
+	switch name {
+	case "heartbeat":
+		period, err := parseRuntimeDuration(name, value, false)
+		if err != nil {
+			return err
+		}
+		wal.logMutex.Lock()
+		current := wal.heartbeatPeriod
+		wal.logMutex.Unlock()
+		if period == current {
+			return nil
+		}
+		apply = func() { wal.setHeartbeat(period) }
+
+	case "expiry_interval":
+		interval, err := parseRuntimeDuration(name, value, true)
+		if err != nil {
+			return err
+		}
+		wal.dbMutex.Lock()
+		current := wal.expiryInterval
+		wal.dbMutex.Unlock()
+		if interval == current {
+			return nil
+		}
+		apply = func() { wal.setExpiryInterval(interval) }
+
+	case "disk_quota":
+		limit, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || limit < 0 {
+			return fmt.Errorf("wal: %s: %q is not a size in bytes", name, value)
+		}
+		wal.logMutex.Lock()
+		current := wal.diskQuota
+		wal.logMutex.Unlock()
+		if limit == current {
+			return nil
+		}
+		apply = func() {
+			wal.logMutex.Lock()
+			wal.diskQuota = limit
+			wal.noteUsage(wal.diskUsage())
+			wal.logMutex.Unlock()
+		}
+
+	case "max_clock_offset":
+		if wal.hlc == nil {
+			return fmt.Errorf("%w: %s needs WithHybridClock", ErrNotRuntimeOption, name)
+		}
+		offset, err := parseRuntimeDuration(name, value, false)
+		if err != nil {
+			return err
+		}
+		wal.hlc.mu.Lock()
+		current := wal.hlc.maxOffset
+		wal.hlc.mu.Unlock()
+		if offset == current {
+			return nil
+		}
+		apply = func() {
+			wal.hlc.mu.Lock()
+			wal.hlc.maxOffset = offset
+			wal.hlc.mu.Unlock()
+		}
+
+	default:
+		return fmt.Errorf("%w: %s", ErrNotRuntimeOption, name)
+	}
+
+	if err := wal.writeConfigChange(name, value); err != nil {
+		return err
+	}
+	apply()
+	return nil
+}
+
+// ApplyConfig applies the options of c that SetOption can change, as when
+// a configuration file is reloaded. Options left at zero return to their
+// defaults. Other options take effect only when the log is reopened.
+func (wal *WAL) ApplyConfig(c *Config) error {
+	expiry := time.Duration(c.ExpiryInterval)
+	if expiry <= 0 {
+		expiry = defaultExpiryInterval
+	}
+
+	settings := [][2]string{
+		{"heartbeat", time.Duration(c.Heartbeat).String()},
+		{"expiry_interval", expiry.String()},
+		{"disk_quota", strconv.FormatInt(c.DiskQuota, 10)},
+	}
+	if wal.hlc != nil {
+		settings = append(settings, [2]string{"max_clock_offset", time.Duration(c.MaxClockOffset).String()})
+	}
+
+	for _, setting := range settings {
+		if err := wal.SetOption(setting[0], setting[1]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ConfigChangeOf returns the option change a record describes, and false if
+// record does not describe one
+func ConfigChangeOf(record LogRecord) (*ConfigChange, bool) {
+	if record.Operation != opConfig {
+		return nil, false
+	}
+
+	fields, err := decodeFields(record.Data)
+	if err != nil || len(fields) != 3 {
+		return nil, false
+	}
+	nanos, err := strconv.ParseInt(fields[0], 10, 64)
+	if err != nil {
+		return nil, false
+	}
+
+	return &ConfigChange{LSN: record.LSN, Time: time.Unix(0, nanos), Name: fields[1], Value: fields[2]}, true
+}
+
+// parseRuntimeDuration parses the value of a duration option
+func parseRuntimeDuration(name, value string, positive bool) (time.Duration, error) {
+	d, err := time.ParseDuration(value)
+	if err != nil || d < 0 || (positive && d == 0) {
+		return 0, fmt.Errorf("wal: %s: %q is not a valid interval", name, value)
+	}
+	return d, nil
+}
+
+// writeConfigChange writes and syncs the record of an option change
+func (wal *WAL) writeConfigChange(name, value string) error {
+	wal.logMutex.Lock()
+	defer wal.logMutex.Unlock()
+
+	if wal.follower {
+		return nil
+	}
+
+	now := wal.hlc.stamp(wal.clock.Now())
+	record := LogRecord{
+		LSN:       wal.currentLSN + 1,
+		Term:      wal.term,
+		Operation: opConfig,
+		Data:      encodeFields(strconv.FormatInt(now.UnixNano(), 10), name, value),
+	}
+	record.CRC32 = recordChecksum(record)
+
+	// Not held to the disk quota, or a full log could not have it raised
+	if err := wal.writeEncoded(encodeRecord(record, wal.logVersion)); err != nil {
+		return err
+	}
+
+	wal.currentLSN = record.LSN
+	if len(wal.records) > 0 {
+		wal.records = append(wal.records, record)
+	}
+
+	return wal.syncLog()
+}
+
+// setHeartbeat restarts the heartbeat worker with a new period
+func (wal *WAL) setHeartbeat(period time.Duration) {
+	wal.stopHeartbeat()
+
+	wal.logMutex.Lock()
+	wal.heartbeatPeriod = period
+	wal.logMutex.Unlock()
+
+	if period > 0 {
+		wal.startHeartbeat()
+	}
+}
+
+// setExpiryInterval changes how often the expiry worker runs, restarting it
+// if it is running
+func (wal *WAL) setExpiryInterval(interval time.Duration) {
+	wal.dbMutex.Lock()
+	wal.expiryInterval = interval
+	running := wal.expiryStop != nil
+	wal.dbMutex.Unlock()
+
+	if !running {
+		return
+	}
+	wal.stopExpiryWorker()
+	wal.dbMutex.Lock()
+	wal.startExpiryWorker()
+	wal.dbMutex.Unlock()
+}
@@ -0,0 +1,330 @@
+package wal
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// progressInterval is how many bytes are replayed between progress reports
+const progressInterval = 4 << 20
+
+// RecoveryProgress describes how far replay of the log has got
+type RecoveryProgress struct {
+	File           string
+	BytesProcessed int64
+	TotalBytes     int64
+	Records        int
+	Elapsed        time.Duration
+	ETA            time.Duration // estimated time remaining, zero until known
+	Done           bool
+}
+
+// RecoveryReport describes what replaying a log would do
+type RecoveryReport struct {
+	File             string
+	FileSize         int64
+	Records          int // valid records in the log
+	CommittedTxns    int
+	AbortedTxns      int // transactions that replay discards
+	DiscardedRecords int // uncommitted records replay truncates from the tail
+	DuplicateRecords int // repeated copies of a record that replay skips
+	LastCommittedLSN uint64
+	TruncateOffset   int64 // size replay truncates the file to
+	TailError        error // corruption that ended the scan, if any
+}
+
+// logScan summarises a pass over a log file
+type logScan struct {
+	header          logHeader
+	size            int64
+	records         int
+	committedTxns   int
+	committedOffset int64 // end of the last commit or abort record
+	committedLSN    uint64
+	lastLSN         uint64 // LSN of the last commit or abort record
+	abortedTxns     int
+	validOffset     int64       // end of the last valid record
+	uncommitted     int         // records after the last commit
+	duplicates      int         // repeated copies of the preceding record
+	tailErr         error       // corruption that ended the scan, if any
+	chain           *chainState // nil until the first chain record
+	lastTime        time.Time   // latest heartbeat time, zero if none
+}
+
+// reportProgress invokes a recovery progress callback, if any
+func reportProgress(fn func(RecoveryProgress), clock Clock, progress RecoveryProgress, start time.Time) {
+	if fn == nil {
+		return
+	}
+
+	progress.Elapsed = clock.Now().Sub(start)
+	if progress.BytesProcessed > 0 && !progress.Done {
+		rate := float64(progress.Elapsed) / float64(progress.BytesProcessed)
+		progress.ETA = time.Duration(rate * float64(progress.TotalBytes-progress.BytesProcessed))
+	}
+
+	fn(progress)
+}
+
+// scanLog reads a log from the start, calling onCommit with the records of
+// each committed transaction in order. The scan stops at the end of the file
+// or at the first torn or corrupt record.
+func scanLog(ctx context.Context, clock Clock, file *os.File, onCommit func([]LogRecord) error, onProgress func(RecoveryProgress)) (logScan, error) {
+	info, err := file.Stat()
+	if err != nil {
+		return logScan{}, err
+	}
+
+	// Replay reads the whole file in order; keep the disk busy while
+	// records are decoded
+	adviseSequential(file)
+	ra := newReadAhead(io.NewSectionReader(file, 0, info.Size()))
+	defer ra.Close()
+
+	r := bufio.NewReader(ra)
+	header, err := readHeader(r)
+	var versionErr *VersionError
+	if errors.As(err, &versionErr) {
+		versionErr.Path = file.Name()
+		return logScan{}, versionErr
+	}
+	if errors.Is(err, ErrInvalidHeader) {
+		if _, seekErr := file.Seek(0, io.SeekStart); seekErr == nil && isLegacyLog(file) {
+			err = ErrLegacyFormat
+		}
+	}
+	if err != nil {
+		return logScan{}, fmt.Errorf("%s: %w", file.Name(), err)
+	}
+
+	scan := logScan{
+		header:          header,
+		size:            info.Size(),
+		committedOffset: headerSize,
+		committedLSN:    header.BaseLSN,
+		lastLSN:         header.BaseLSN,
+		validOffset:     headerSize,
+	}
+	offset := int64(headerSize)
+	pending := []LogRecord{}
+	var previous LogRecord
+
+	start := clock.Now()
+	progress := RecoveryProgress{File: file.Name(), TotalBytes: info.Size()}
+	nextReport := offset + progressInterval
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return logScan{}, fmt.Errorf("replaying %s: %w", file.Name(), err)
+		}
+
+		record, n, err := readRecord(r, header.Version)
+		if err == io.EOF {
+			break
+		}
+		if errors.Is(err, ErrCorruptRecord) {
+			scan.tailErr = err
+			break
+		}
+		if err != nil {
+			return logScan{}, err
+		}
+
+		// A retried append can leave a record written twice in a row. An
+		// exact copy is skipped; a different record reusing the LSN is not
+		// something a writer produces, so it ends the scan like corruption.
+		duplicate := false
+		if record.Operation != opPad && previous.LSN != 0 && record.LSN == previous.LSN {
+			if record != previous {
+				scan.tailErr = fmt.Errorf("%w: conflicting records at LSN %d", ErrCorruptRecord, record.LSN)
+				break
+			}
+			duplicate = true
+		}
+
+		offset += int64(n)
+		scan.validOffset = offset
+
+		progress.BytesProcessed = offset
+		if offset >= nextReport {
+			reportProgress(onProgress, clock, progress, start)
+			nextReport = offset + progressInterval
+		}
+
+		if record.Operation == opPad {
+			continue
+		}
+		if duplicate {
+			scan.duplicates++
+			continue
+		}
+		previous = record
+		scan.records++
+		progress.Records++
+		if t, ok := HeartbeatTime(record); ok && t.After(scan.lastTime) {
+			scan.lastTime = t
+		}
+
+		// A heartbeat, chain or config record outside a transaction is
+		// complete in itself
+		if (record.Operation == opNoop || record.Operation == opChain || record.Operation == opConfig) && len(pending) == 0 {
+			if err := scan.followChain([]LogRecord{record}); err != nil {
+				return logScan{}, fmt.Errorf("%s: %w", file.Name(), err)
+			}
+			scan.committedOffset = offset
+			scan.lastLSN = record.LSN
+			continue
+		}
+		pending = append(pending, record)
+
+		if record.Operation == opCommit || record.Operation == opAbort {
+			if err := scan.followChain(pending); err != nil {
+				return logScan{}, fmt.Errorf("%s: %w", file.Name(), err)
+			}
+		}
+
+		if record.Operation == opCommit {
+			if onCommit != nil {
+				if err := onCommit(pending); err != nil {
+					return logScan{}, err
+				}
+			}
+			pending = pending[:0]
+			scan.committedTxns++
+			scan.committedOffset = offset
+			scan.committedLSN = record.LSN
+			scan.lastLSN = record.LSN
+		}
+
+		if record.Operation == opAbort {
+			pending = pending[:0]
+			scan.abortedTxns++
+			scan.committedOffset = offset
+			scan.lastLSN = record.LSN
+		}
+	}
+	scan.uncommitted = len(pending)
+
+	progress.BytesProcessed = info.Size()
+	progress.Done = true
+	reportProgress(onProgress, clock, progress, start)
+
+	return scan, nil
+}
+
+// replayLog rebuilds the in-memory database from the log file. Committed
+// transactions are re-applied; a torn or corrupt tail and any transaction
+// left uncommitted by a crash are truncated so new records start clean.
+func (wal *WAL) replayLog(ctx context.Context) error {
+	info, err := wal.file.Stat()
+	if err != nil {
+		return err
+	}
+
+	// A fresh log only needs its header. It is synced, along with the
+	// directory entry, so that the first commit is not lost with the file.
+	if info.Size() == 0 {
+		n, err := wal.file.Write(encodeHeader(logHeader{Version: formatVersion}))
+		wal.logSize = int64(n)
+		wal.logVersion = formatVersion
+		if err == nil {
+			err = wal.file.Sync()
+		}
+		if err == nil {
+			err = syncDir(filepath.Dir(wal.file.Name()))
+		}
+		return err
+	}
+
+	return wal.restoreLog(ctx, wal.recoveryProgress)
+}
+
+// restoreLog applies the committed transactions in the log to the database
+// and truncates whatever follows the last of them
+func (wal *WAL) restoreLog(ctx context.Context, onProgress func(RecoveryProgress)) error {
+	scan, err := scanLog(ctx, wal.clock, wal.file, func(records []LogRecord) error {
+		for _, record := range records {
+			record, err := wal.upgradeRecord(record)
+			if err != nil {
+				return err
+			}
+			if err := wal.applyChanges(record); err != nil {
+				return err
+			}
+		}
+		return nil
+	}, onProgress)
+	if err != nil {
+		return err
+	}
+
+	wal.baseLSN = scan.header.BaseLSN
+	wal.logVersion = scan.header.Version
+	wal.currentLSN = scan.lastLSN
+	wal.dbMutex.Lock()
+	wal.committedLSN = scan.committedLSN
+	wal.dbMutex.Unlock()
+	wal.logSize = scan.committedOffset
+	wal.hlc.observe(scan.lastTime)
+	if wal.hashChain {
+		wal.chain = scan.chain
+		if wal.chain == nil {
+			wal.chain = newChainState()
+		}
+	}
+
+	// Drop everything after the last committed or aborted transaction
+	if scan.committedOffset < scan.size {
+		if err := wal.file.Truncate(scan.committedOffset); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// DryRunRecovery scans the log at filename the way NewWAL replays it and
+// reports what would be applied and discarded, without modifying the file
+func DryRunRecovery(ctx context.Context, filename string) (*RecoveryReport, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	// An empty log is initialised on open; there is nothing to replay
+	if info, err := file.Stat(); err != nil {
+		return nil, err
+	} else if info.Size() == 0 {
+		return &RecoveryReport{File: filename}, nil
+	}
+
+	scan, err := scanLog(ctx, systemClock{}, file, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &RecoveryReport{
+		File:             filename,
+		FileSize:         scan.size,
+		Records:          scan.records,
+		CommittedTxns:    scan.committedTxns,
+		DiscardedRecords: scan.uncommitted,
+		DuplicateRecords: scan.duplicates,
+		LastCommittedLSN: scan.committedLSN,
+		TruncateOffset:   scan.committedOffset,
+		AbortedTxns:      scan.abortedTxns,
+		TailError:        scan.tailErr,
+	}
+	if scan.uncommitted > 0 {
+		report.AbortedTxns++
+	}
+
+	return report, nil
+}
@@ -0,0 +1,110 @@
+package wal
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// opRedacted marks where a record was removed by RedactLog. It keeps the
+// record's LSN; when the record was covered by a hash chain its data is the
+// SHA-256 of the removed record, which the chain uses in its place.
+// Otherwise its data is empty. It changes nothing.
+const opRedacted = "REDACTED"
+
+// redactSuffix names the file RedactLog writes before replacing the log
+const redactSuffix = ".redact"
+
+// RedactLog rewrites the log at filename, replacing every record that acts
+// on one of keys with a redaction marker, e.g. to honour a request to erase
+// someone's data. LSNs and any hash chain stay valid. It returns the number
+// of records redacted. The log must not be open, and mirrors and archived
+// copies must be redacted separately. The database snapshot keeps the old
+// values until the WAL is next opened and commits.
+//
+// A marker in a hash chain keeps the hash of the record it replaced, which
+// is enough to confirm a guess of the record's exact contents.
+func RedactLog(filename string, keys ...string) (int, error) {
+	scan, err := scanFile(filename)
+	if err != nil {
+		return 0, err
+	}
+	if scan.tailErr != nil {
+		return 0, fmt.Errorf("%s: offset %d: %w; repair the log before redacting it", filename, scan.validOffset, scan.tailErr)
+	}
+
+	redact := make(map[string]bool, len(keys))
+	for _, key := range keys {
+		redact[key] = true
+	}
+
+	info, err := os.Stat(filename)
+	if err != nil {
+		return 0, err
+	}
+	file, err := os.Open(filename)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	r := bufio.NewReader(file)
+	header, err := readHeader(r)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", filename, err)
+	}
+
+	records := []LogRecord{}
+	redacted := 0
+	chained := false
+	for {
+		record, _, err := readRecord(r, header.Version)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return 0, fmt.Errorf("%s: %w", filename, err)
+		}
+		if record.Operation == opPad {
+			continue
+		}
+		if record.Operation == opChain {
+			chained = true
+		}
+
+		if key, ok := recordKey(record); ok && redact[key] {
+			marker := LogRecord{LSN: record.LSN, Term: record.Term, Operation: opRedacted}
+			if chained {
+				sum := sha256.Sum256(encodeRecord(record, header.Version))
+				marker.Data = string(sum[:])
+			}
+			marker.CRC32 = recordChecksum(marker)
+			record = marker
+			redacted++
+		}
+		records = append(records, record)
+	}
+
+	if redacted == 0 {
+		return 0, nil
+	}
+
+	tmpName := filename + redactSuffix
+	if err := writeLog(tmpName, header, records, info.Mode().Perm()); err != nil {
+		os.Remove(tmpName)
+		return 0, err
+	}
+	if err := VerifyLog(tmpName); err != nil {
+		os.Remove(tmpName)
+		return 0, err
+	}
+	if err := os.Rename(tmpName, filename); err != nil {
+		os.Remove(tmpName)
+		return 0, err
+	}
+
+	return redacted, syncDir(filepath.Dir(filename))
+}
@@ -0,0 +1,76 @@
+package wal
+
+import (
+	"bytes"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// TestRedactLog redacts a key from a log, with and without a hash chain,
+// and checks that the log still verifies and replays to the same database
+// less that key
+func TestRedactLog(t *testing.T) {
+	for name, opts := range map[string][]Option{
+		"plain":      nil,
+		"hash chain": {WithHashChain()},
+	} {
+		opts := opts
+		t.Run(name, func(t *testing.T) {
+			filename := filepath.Join(inTempDir(t), "wal.log")
+			log, err := NewWAL(filename, opts...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			commitKeys(t, log, "alice", "bob", "carol")
+			if err := log.Put("alice", "again"); err != nil {
+				t.Fatal(err)
+			}
+			if err := log.Put("dave", "v"); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := log.Commit(); err != nil {
+				t.Fatal(err)
+			}
+			want := readAll(log)
+			delete(want, "alice")
+			lsn := log.CommittedLSN()
+			headLSN, head := log.ChainHead()
+			log.Close()
+
+			n, err := RedactLog(filename, "alice", "nobody")
+			if err != nil {
+				t.Fatalf("RedactLog: %v", err)
+			}
+			if n != 2 {
+				t.Errorf("RedactLog redacted %d records, want 2", n)
+			}
+			if err := VerifyLog(filename); err != nil {
+				t.Fatalf("VerifyLog: %v", err)
+			}
+			if bytes.Contains(mustRead(t, filename), []byte("alice")) {
+				t.Error("the redacted key is still in the log")
+			}
+
+			got, gotLSN := replayLog(t, filename)
+			if !reflect.DeepEqual(got, want) || gotLSN != lsn {
+				t.Errorf("redacted log replays to %v at LSN %d, want %v at LSN %d", got, gotLSN, want, lsn)
+			}
+
+			// Nothing is left to redact
+			if n, err := RedactLog(filename, "alice"); err != nil || n != 0 {
+				t.Errorf("redacting again: %d, %v", n, err)
+			}
+
+			// The chain still ends where it did
+			log, err = NewWAL(filename, opts...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer log.Close()
+			if gotLSN, got := log.ChainHead(); gotLSN != headLSN || !bytes.Equal(got, head) {
+				t.Errorf("chain head moved from %d to %d", headLSN, gotLSN)
+			}
+		})
+	}
+}
@@ -0,0 +1,133 @@
+package wal
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// ErrSameLocation is returned by Relocate when the target is in the
+// directory already holding the log
+var ErrSameLocation = errors.New("wal: relocation target is in the log's own directory")
+
+// Relocate moves the log to filename without closing the WAL, e.g. when the
+// volume holding it is filling up. The log is copied and synced at the new
+// location before writes switch over, then the old file is removed. Records
+// of an open transaction move with the log. The target must be in another
+// directory, or ErrSameLocation is returned: copying the log over itself,
+// or over a file next to it, gains nothing and risks losing it. Nor may
+// the target exist already; the error then wraps os.ErrExist.
+func (wal *WAL) Relocate(filename string) error {
+	wal.logMutex.Lock()
+	defer wal.logMutex.Unlock()
+
+	oldName := wal.file.Name()
+	if err := checkRelocation(oldName, filename); err != nil {
+		return err
+	}
+	tmpName := filename + ".tmp"
+	if err := wal.copyFile(oldName, tmpName); err != nil {
+		os.Remove(tmpName)
+		return err
+	}
+	if err := os.Rename(tmpName, filename); err != nil {
+		os.Remove(tmpName)
+		return err
+	}
+	if err := syncDir(filepath.Dir(filename)); err != nil {
+		return err
+	}
+
+	// The epoch moves with the log; a writer still using the old path is fenced
+	oldEpochFile := wal.epochFile
+	if oldEpochFile != "" {
+		if err := wal.writeEpoch(filename+epochSuffix, wal.epoch); err != nil {
+			return err
+		}
+	}
+
+	file, err := wal.openFile(filename, os.O_APPEND|os.O_RDWR)
+	if err != nil {
+		return err
+	}
+
+	wal.file.Close()
+	wal.file = file
+	wal.rewrites++
+
+	if oldEpochFile != "" {
+		wal.epochFile = filename + epochSuffix
+		if err := os.Remove(oldEpochFile); err != nil {
+			return err
+		}
+	}
+
+	return os.Remove(oldName)
+}
+
+// checkRelocation rejects a target for the log at oldName that lies in the
+// log's directory, or that already exists
+func checkRelocation(oldName, filename string) error {
+	oldDir, err := filepath.Abs(filepath.Dir(oldName))
+	if err != nil {
+		return err
+	}
+	newDir, err := filepath.Abs(filepath.Dir(filename))
+	if err != nil {
+		return err
+	}
+	if oldDir == newDir {
+		return ErrSameLocation
+	}
+
+	// Different paths can still lead to the same directory
+	if old, err := os.Stat(oldDir); err == nil {
+		if dir, err := os.Stat(newDir); err == nil && os.SameFile(old, dir) {
+			return ErrSameLocation
+		}
+	}
+
+	// The rename would silently replace whatever is there, the log itself
+	// included if the target is a link to it
+	if _, err := os.Lstat(filename); !errors.Is(err, os.ErrNotExist) {
+		if err == nil {
+			err = os.ErrExist
+		}
+		return fmt.Errorf("wal: %s: %w", filename, err)
+	}
+	return nil
+}
+
+// copyFile copies src to a new, synced file at dst
+func (wal *WAL) copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := wal.openFile(dst, os.O_EXCL|os.O_WRONLY)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	if _, err := io.Copy(out, in); err != nil {
+		return err
+	}
+
+	return out.Sync()
+}
+
+// syncDir flushes directory metadata so renames and creations are durable
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+
+	return d.Sync()
+}
@@ -0,0 +1,79 @@
+package wal
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRelocate(t *testing.T) {
+	dir := inTempDir(t)
+	name := filepath.Join(dir, "a", "wal.log")
+	log, err := NewWAL(name, WithFileMode(0600, 0700))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer log.Close()
+	if err := log.Put("key", "value"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := log.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Targets that would lose the log or another file are refused
+	if err := log.Relocate(name); !errors.Is(err, ErrSameLocation) {
+		t.Errorf("relocating onto the log: got %v, want ErrSameLocation", err)
+	}
+	if err := log.Relocate(filepath.Join(dir, "a", "other.log")); !errors.Is(err, ErrSameLocation) {
+		t.Errorf("relocating next to the log: got %v, want ErrSameLocation", err)
+	}
+	existing := filepath.Join(dir, "b", "wal.log")
+	if err := os.MkdirAll(filepath.Dir(existing), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(existing, []byte("keep"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := log.Relocate(existing); !errors.Is(err, os.ErrExist) {
+		t.Errorf("relocating onto an existing file: got %v, want os.ErrExist", err)
+	}
+	if data, _ := os.ReadFile(existing); string(data) != "keep" {
+		t.Error("an existing target was overwritten")
+	}
+
+	target := filepath.Join(dir, "c", "wal.log")
+	if err := log.Relocate(target); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(name); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("the old log is still there: %v", err)
+	}
+	info, err := os.Stat(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mode := info.Mode().Perm(); mode != 0600 {
+		t.Errorf("relocated log has mode %o, want 600", mode)
+	}
+
+	// Writes carry on at the new location
+	if err := log.Put("after", "value"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := log.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	log.Close()
+	log, err = NewWAL(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer log.Close()
+	for _, key := range []string{"key", "after"} {
+		if _, ok := log.Get(key); !ok {
+			t.Errorf("%s is missing after relocation", key)
+		}
+	}
+}
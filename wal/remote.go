@@ -0,0 +1,175 @@
+package wal
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// remoteQueueSize is how many batches may wait for an asynchronous remote
+// appender before commits wait for it
+const remoteQueueSize = 64
+
+// remoteRetryInterval is how long the asynchronous remote appender waits
+// before retrying a failed append
+const remoteRetryInterval = time.Second
+
+// RemoteAppender forwards the log to a replica on another machine
+type RemoteAppender interface {
+	// Append sends a batch of records, encoded as on disk, and returns once
+	// the replica has made them durable. Batches arrive in log order.
+	Append(ctx context.Context, batch *Batch) error
+}
+
+// WithRemoteAppender forwards the records written to the log to appender
+// each time the log is synced, which commits do. With synchronous set, a
+// commit is acknowledged only once both the local sync and the remote
+// append have succeeded, giving semi-synchronous replication; a failed
+// append fails the commit, although it is durable locally, and the records
+// are sent again with the next sync. Otherwise records are appended in the
+// background and retried until they succeed, and commits only wait once 64
+// batches are outstanding. At Close, outstanding batches get one more
+// attempt unless an append is failing, and are dropped after that. Records
+// that Truncate, DropBefore or Compact remove once forwarded are not removed
+// from the replica.
+func WithRemoteAppender(appender RemoteAppender, synchronous bool) Option {
+	return func(wal *WAL) {
+		wal.remote = &remoteState{appender: appender, synchronous: synchronous}
+	}
+}
+
+// remoteState tracks the records waiting to be forwarded to a RemoteAppender
+type remoteState struct {
+	appender    RemoteAppender
+	synchronous bool
+	pending     *Batch        // written since the last forward; nil if none
+	acked       atomic.Uint64 // LSN of the last record appended
+	queue       chan *Batch
+	stop        chan struct{}
+	done        chan struct{}
+}
+
+// add records that frame was written to the log
+func (r *remoteState) add(version uint32, frame ...[]byte) {
+	lsn := bytesToUint64(frame[0][0:8])
+	if r.pending == nil {
+		r.pending = &Batch{Version: version, FirstLSN: lsn}
+	}
+	r.pending.LastLSN = lsn
+	r.pending.Count++
+	for _, part := range frame {
+		r.pending.Data = append(r.pending.Data, part...)
+	}
+}
+
+// truncate drops the records after lsn that are waiting to be forwarded
+func (r *remoteState) truncate(lsn uint64) error {
+	if r.pending == nil || r.pending.LastLSN <= lsn {
+		return nil
+	}
+	records, err := r.pending.Records()
+	if err != nil {
+		return err
+	}
+
+	version := r.pending.Version
+	r.pending = nil
+	for _, record := range records {
+		if record.LSN <= lsn {
+			r.add(version, encodeRecord(record, version))
+		}
+	}
+	return nil
+}
+
+// forwardRemote forwards the records written since the last forward, after
+// the log has been synced. The caller must hold logMutex.
+func (wal *WAL) forwardRemote() error {
+	r := wal.remote
+	if r == nil || r.pending == nil {
+		return nil
+	}
+	batch := r.pending
+
+	if !r.synchronous {
+		r.pending = nil
+		// Once the WAL is closing, the worker may have stopped taking
+		// batches; this one is dropped, like any outstanding at Close
+		select {
+		case r.queue <- batch:
+		case <-r.stop:
+		}
+		return nil
+	}
+
+	if err := r.appender.Append(context.Background(), batch); err != nil {
+		return fmt.Errorf("wal: remote append of LSNs %d to %d: %w", batch.FirstLSN, batch.LastLSN, err)
+	}
+	r.acked.Store(batch.LastLSN)
+	r.pending = nil
+	return nil
+}
+
+// startRemote starts the worker appending batches in the background
+func (wal *WAL) startRemote() {
+	r := wal.remote
+	r.queue = make(chan *Batch, remoteQueueSize)
+	r.stop, r.done = make(chan struct{}), make(chan struct{})
+	go withLabels(context.Background(), "remote-append", func(ctx context.Context) {
+		wal.runRemote(ctx, r)
+	})
+}
+
+// stopRemote stops the background worker and waits for it to exit
+func (wal *WAL) stopRemote() {
+	r := wal.remote
+	if r == nil || r.stop == nil {
+		return
+	}
+	close(r.stop)
+	<-r.done
+}
+
+// runRemote appends queued batches in order until stop is closed
+func (wal *WAL) runRemote(ctx context.Context, r *remoteState) {
+	defer close(r.done)
+
+	for {
+		var batch *Batch
+		select {
+		case <-r.stop:
+			r.drain(ctx)
+			return
+		case batch = <-r.queue:
+		}
+
+		for r.appender.Append(ctx, batch) != nil {
+			ticker := wal.clock.NewTicker(remoteRetryInterval)
+			select {
+			case <-r.stop:
+				ticker.Stop()
+				return
+			case <-ticker.C():
+			}
+			ticker.Stop()
+		}
+		r.acked.Store(batch.LastLSN)
+	}
+}
+
+// drain makes one more attempt at each queued batch, in order, giving up at
+// the first failure
+func (r *remoteState) drain(ctx context.Context) {
+	for {
+		select {
+		case batch := <-r.queue:
+			if r.appender.Append(ctx, batch) != nil {
+				return
+			}
+			r.acked.Store(batch.LastLSN)
+		default:
+			return
+		}
+	}
+}
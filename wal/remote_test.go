@@ -0,0 +1,58 @@
+package wal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// failingAppender is a RemoteAppender whose appends always fail
+type failingAppender struct{}
+
+func (failingAppender) Append(context.Context, *Batch) error {
+	return errors.New("replica unreachable")
+}
+
+// TestCloseWithFullRemoteQueue checks that Close does not hang while a
+// commit waits for room in the queue of a failing asynchronous appender
+func TestCloseWithFullRemoteQueue(t *testing.T) {
+	name := filepath.Join(inTempDir(t), "wal.log")
+	log, err := NewWAL(name, WithRemoteAppender(failingAppender{}, false))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// One batch is being retried and the queue holds the rest, so the
+	// commit after them waits
+	var commits atomic.Int64
+	committing := make(chan struct{})
+	go func() {
+		defer close(committing)
+		for i := 0; i < remoteQueueSize+2; i++ {
+			if err := log.Put(fmt.Sprint("k", i), "v"); err != nil {
+				return
+			}
+			if _, err := log.Commit(); err != nil {
+				return
+			}
+			commits.Add(1)
+		}
+	}()
+	for commits.Load() < remoteQueueSize+1 {
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(10 * time.Millisecond)
+
+	closed := make(chan error, 1)
+	go func() { closed <- log.Close() }()
+	select {
+	case <-closed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Close hung behind a commit waiting for the remote queue")
+	}
+	<-committing
+}
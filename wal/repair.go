@@ -0,0 +1,160 @@
+package wal
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// ErrNoRepairSource is returned when no copy can supply the damaged part of a log
+var ErrNoRepairSource = errors.New("wal: no usable copy to repair from")
+
+// RepairReport describes the outcome of RepairLog
+type RepairReport struct {
+	CorruptOffset int64  // first damaged offset, -1 if the log was intact
+	Source        string // copy the good bytes were taken from
+	Size          int64  // size of the repaired log
+	Discarded     int64  // bytes of the damaged log that could not be recovered
+}
+
+// scanFile scans the log at filename without applying anything
+func scanFile(filename string) (logScan, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return logScan{}, err
+	}
+	defer file.Close()
+
+	return scanLog(context.Background(), systemClock{}, file, nil, nil)
+}
+
+// VerifyLog checks every record of the log at filename and returns an error
+// describing the first damaged record, or nil if the log is intact
+func VerifyLog(filename string) error {
+	scan, err := scanFile(filename)
+	if err != nil {
+		return err
+	}
+
+	if scan.tailErr != nil {
+		return fmt.Errorf("%s: offset %d: %w", filename, scan.validOffset, scan.tailErr)
+	}
+
+	return nil
+}
+
+// RepairLog repairs a damaged log using good copies of it, such as mirrors or
+// archived files. The damaged range is replaced with bytes from the copy that
+// holds the most valid records, anything still unreadable after that is cut
+// off, and the result is re-verified before it replaces filename. The log
+// must not be open while it is repaired.
+func RepairLog(filename string, sources ...string) (*RepairReport, error) {
+	damaged, err := scanFile(filename)
+	bad := damaged.validOffset
+	if err != nil {
+		var versionErr *VersionError
+		if !errors.Is(err, ErrInvalidHeader) || errors.As(err, &versionErr) {
+			return nil, err
+		}
+		// The header itself is damaged
+		bad = 0
+	} else if damaged.tailErr == nil {
+		return &RepairReport{CorruptOffset: -1, Size: damaged.size}, nil
+	}
+
+	damagedBytes, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	source := ""
+	var sourceBytes []byte
+	var sourceValid int64
+	for _, candidate := range sources {
+		scan, err := scanFile(candidate)
+		if err != nil || scan.validOffset <= bad || scan.validOffset <= sourceValid {
+			continue
+		}
+
+		candidateBytes, err := os.ReadFile(candidate)
+		if err != nil || !bytes.Equal(candidateBytes[:bad], damagedBytes[:bad]) {
+			// Unreadable, or a copy of a different log
+			continue
+		}
+
+		source, sourceBytes, sourceValid = candidate, candidateBytes, scan.validOffset
+	}
+	if source == "" {
+		return nil, fmt.Errorf("%w: %s is damaged at offset %d", ErrNoRepairSource, filename, bad)
+	}
+
+	patched := append([]byte{}, sourceBytes[:sourceValid]...)
+	if int64(len(damagedBytes)) > sourceValid {
+		patched = append(patched, damagedBytes[sourceValid:]...)
+	}
+
+	size, err := replaceWithValidPrefix(filename, patched)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := VerifyLog(filename); err != nil {
+		return nil, err
+	}
+
+	report := &RepairReport{CorruptOffset: bad, Source: source, Size: size}
+	if lost := int64(len(damagedBytes)) - size; lost > 0 {
+		report.Discarded = lost
+	}
+
+	return report, nil
+}
+
+// replaceWithValidPrefix atomically replaces filename with the readable
+// prefix of contents, keeping its permissions, and returns its size
+func replaceWithValidPrefix(filename string, contents []byte) (int64, error) {
+	info, err := os.Stat(filename)
+	if err != nil {
+		return 0, err
+	}
+
+	tmpName := filename + ".repair"
+	if err := os.WriteFile(tmpName, contents, info.Mode().Perm()); err != nil {
+		os.Remove(tmpName)
+		return 0, err
+	}
+
+	scan, err := scanFile(tmpName)
+	if err == nil {
+		err = os.Chmod(tmpName, info.Mode().Perm())
+	}
+	if err == nil {
+		err = os.Truncate(tmpName, scan.validOffset)
+	}
+	if err == nil {
+		err = syncFile(tmpName)
+	}
+	if err == nil {
+		err = os.Rename(tmpName, filename)
+	}
+	if err != nil {
+		os.Remove(tmpName)
+		return 0, err
+	}
+
+	return scan.validOffset, syncDir(filepath.Dir(filename))
+}
+
+// syncFile flushes a closed file to stable storage
+func syncFile(filename string) error {
+	file, err := os.OpenFile(filename, os.O_RDWR, 0)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	return file.Sync()
+}
@@ -0,0 +1,68 @@
+package wal
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// TestRepairLog damages a log in the middle, repairs it from a copy, and
+// checks that replay gives back the database it had
+func TestRepairLog(t *testing.T) {
+	dir := inTempDir(t)
+	name := filepath.Join(dir, "wal.log")
+	log, err := NewWAL(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	commitKeys(t, log, "k0", "k1", "k2", "k3", "k4")
+	log.Close()
+	want, wantLSN := replayLog(t, name)
+
+	good := mustRead(t, name)
+	mirror := filepath.Join(dir, "mirror.log")
+	if err := os.WriteFile(mirror, good, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if report, err := RepairLog(name, mirror); err != nil || report.CorruptOffset != -1 {
+		t.Fatalf("repairing an intact log: %+v, %v", report, err)
+	}
+
+	damaged := append([]byte(nil), good...)
+	damaged[len(damaged)/2] ^= 0xff
+	if err := os.WriteFile(name, damaged, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := VerifyLog(name); err == nil {
+		t.Fatal("VerifyLog passed a damaged log")
+	}
+
+	// A copy of another log is no use
+	other := filepath.Join(dir, "other", "wal.log")
+	otherLog, err := NewWAL(other)
+	if err != nil {
+		t.Fatal(err)
+	}
+	commitKeys(t, otherLog, "x0", "x1", "x2", "x3", "x4", "x5")
+	otherLog.Close()
+	if _, err := RepairLog(name, other); !errors.Is(err, ErrNoRepairSource) {
+		t.Fatalf("repairing from another log: got %v, want ErrNoRepairSource", err)
+	}
+
+	report, err := RepairLog(name, other, mirror)
+	if err != nil {
+		t.Fatalf("RepairLog: %v", err)
+	}
+	if report.Source != mirror || report.CorruptOffset <= 0 || report.Discarded != 0 {
+		t.Errorf("RepairLog reported %+v", report)
+	}
+	if err := VerifyLog(name); err != nil {
+		t.Fatalf("VerifyLog after repair: %v", err)
+	}
+	got, gotLSN := replayLog(t, name)
+	if !reflect.DeepEqual(got, want) || gotLSN != wantLSN {
+		t.Errorf("repaired log replays to %v at LSN %d, want %v at LSN %d", got, gotLSN, want, wantLSN)
+	}
+}
@@ -0,0 +1,78 @@
+package wal
+
+import (
+	"context"
+	"errors"
+	"os"
+	"time"
+)
+
+// replicaBatchBytes is how much of its source's log a replica reads at a time
+const replicaBatchBytes = 1 << 20
+
+// ReplicaSource is what a read replica is seeded from and kept up to date
+// with. A WAL is one; a client for a WAL in another process can be another.
+type ReplicaSource interface {
+	// Backup copies the log, up to its last complete transaction, to a
+	// new file at dst, and returns the LSN the copy ends at
+	Backup(dst string) (uint64, error)
+	// ReadTransactions returns the whole transactions starting at fromLSN
+	ReadTransactions(fromLSN uint64, maxBytes, maxCount int) (*Batch, error)
+}
+
+// NewReplica opens a read replica of source: a follower whose log is
+// seeded with a backup of source's log if filename does not exist yet,
+// and otherwise carries on from where it left off. Replicate then keeps it
+// up to date. opts are applied as by NewWAL, along with WithFollower.
+func NewReplica(filename string, source ReplicaSource, opts ...Option) (*WAL, error) {
+	if _, err := os.Stat(filename); errors.Is(err, os.ErrNotExist) {
+		if _, err := source.Backup(filename); err != nil {
+			return nil, err
+		}
+	} else if err != nil {
+		return nil, err
+	}
+
+	return NewWAL(filename, append(opts, WithFollower())...)
+}
+
+// Replicate appends the transactions committed to source after the last
+// one the replica has, checking for new ones every interval once it has
+// caught up, until ctx is done or an append fails. It fails with
+// ErrLSNOutOfRange if source has dropped transactions the replica has yet
+// to receive, in which case the replica must be seeded again.
+func (wal *WAL) Replicate(ctx context.Context, source ReplicaSource, interval time.Duration) error {
+	if !wal.follower {
+		return ErrNotFollower
+	}
+
+	ticker := wal.clock.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		wal.logMutex.Lock()
+		from := wal.currentLSN + 1
+		wal.logMutex.Unlock()
+
+		batch, err := source.ReadTransactions(from, replicaBatchBytes, 0)
+		if err != nil {
+			return err
+		}
+		if batch.Count > 0 {
+			if err := wal.AppendBatch(batch); err != nil {
+				return err
+			}
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C():
+		}
+	}
+}
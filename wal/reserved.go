@@ -0,0 +1,21 @@
+package wal
+
+import "strings"
+
+// ReservedPrefixes start the keys under which code built on the WAL records
+// its own progress: relays in RelayOutbox, the sinks and sources of packages
+// kafka and nats, and the named loads of package load. Sinks that ship the
+// log elsewhere skip these keys. Shipping a sink's progress would be worse
+// than useless: two sinks on one WAL would each ship the other's progress,
+// record that, and so on forever.
+var ReservedPrefixes = []string{"outbox/", "kafka/", "nats/", "load/"}
+
+// IsReservedKey reports whether key starts with one of ReservedPrefixes
+func IsReservedKey(key string) bool {
+	for _, prefix := range ReservedPrefixes {
+		if strings.HasPrefix(key, prefix) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,50 @@
+package wal
+
+import "unsafe"
+
+// maxScratch bounds the encoding buffer a WAL keeps between writes; a
+// record with a larger frame is encoded into a buffer of its own
+const maxScratch = 1 << 20
+
+// scratch is the memory the write path encodes frames in. A frame is
+// written to the log, its mirrors and the remote appender before the next
+// one is encoded, and none of them keeps it, so the same memory serves
+// every frame and each record written costs no allocation.
+type scratch struct {
+	buf   []byte
+	parts [3][]byte
+}
+
+// encodeParts encodes record for writing: into one buffer, or for large
+// data into the frame before the data, the data in place, and the
+// checksum. The result is only valid until the next call. The caller must
+// hold logMutex.
+func (wal *WAL) encodeParts(record LogRecord) [][]byte {
+	s := &wal.scratch
+	head, data := frameHead(s.buf[:0], record, wal.logVersion)
+	if len(data) < vectoredMin {
+		head = appendTail(append(head, data...), record)
+		s.keep(head)
+		s.parts[0] = head
+		return s.parts[:1]
+	}
+
+	n := len(head)
+	head = appendTail(head, record)
+	s.keep(head)
+	s.parts[0], s.parts[1], s.parts[2] = head[:n], stringBytes(data), head[n:]
+	return s.parts[:3]
+}
+
+// keep holds on to buf for the next frame, unless it has grown too large
+func (s *scratch) keep(buf []byte) {
+	if cap(buf) <= maxScratch {
+		s.buf = buf
+	}
+}
+
+// stringBytes returns the bytes of s without copying them. They must not be
+// modified.
+func stringBytes(s string) []byte {
+	return unsafe.Slice(unsafe.StringData(s), len(s))
+}
@@ -0,0 +1,218 @@
+package wal
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// ScrubReport describes one pass of Scrub
+type ScrubReport struct {
+	Bytes    int64    // bytes of the log verified in each copy
+	Damaged  []string // copies that failed verification
+	Repaired []string // damaged copies restored from a good one
+}
+
+// WithScrubber re-verifies the log and its mirrors every interval, as Scrub
+// does, and passes the outcome of each pass to fn
+func WithScrubber(interval time.Duration, fn func(*ScrubReport, error)) Option {
+	return func(wal *WAL) {
+		wal.scrubInterval = interval
+		wal.scrubReport = fn
+	}
+}
+
+// Scrub re-reads everything written to the log and its mirrors so far and
+// validates every checksum, to catch damage to data at rest. A damaged copy
+// is patched from one that verified; a damaged mirror with no good copy to
+// patch from stops being written. The copies are read without holding the
+// log lock, so writes carry on during a pass.
+func (wal *WAL) Scrub(ctx context.Context) (*ScrubReport, error) {
+	wal.logMutex.Lock()
+	end, version, rewrites := wal.logSize, wal.logVersion, wal.rewrites
+	names := []string{wal.file.Name()}
+	for _, m := range wal.mirrors {
+		if m.failed == nil {
+			names = append(names, m.file.Name())
+		}
+	}
+	wal.logMutex.Unlock()
+
+	valid := make([]int64, len(names))
+	for i, name := range names {
+		n, err := verifiedPrefix(ctx, name, version, end)
+		if err != nil {
+			return nil, err
+		}
+		valid[i] = n
+	}
+
+	wal.logMutex.Lock()
+	defer wal.logMutex.Unlock()
+
+	// The log was rewritten during the pass; its result means nothing
+	report := &ScrubReport{Bytes: end}
+	if wal.rewrites != rewrites {
+		return report, nil
+	}
+
+	source := ""
+	for i, name := range names {
+		if valid[i] == end {
+			source = name
+			break
+		}
+	}
+
+	var logErr error
+	for i, name := range names {
+		if valid[i] == end {
+			continue
+		}
+		report.Damaged = append(report.Damaged, name)
+
+		err := fmt.Errorf("%w: %s is damaged at offset %d", ErrNoRepairSource, name, valid[i])
+		if source != "" {
+			err = patchRange(name, source, valid[i], end)
+		}
+		if err == nil {
+			if i == 0 && wal.blockCache != nil {
+				wal.blockCache.reset()
+			}
+			report.Repaired = append(report.Repaired, name)
+			continue
+		}
+
+		if i == 0 {
+			logErr = err
+			continue
+		}
+		for _, m := range wal.mirrors {
+			if m.file.Name() == name && m.failed == nil {
+				m.failed = err
+			}
+		}
+	}
+
+	return report, logErr
+}
+
+// verifiedPrefix returns how much of the first end bytes of a log file hold
+// a valid header followed by valid records
+func verifiedPrefix(ctx context.Context, name string, version uint32, end int64) (int64, error) {
+	file, err := os.Open(name)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	r := bufio.NewReader(io.NewSectionReader(file, 0, end))
+	header, err := readHeader(r)
+	if err != nil || header.Version != version {
+		return 0, nil
+	}
+
+	offset := int64(headerSize)
+	for offset < end {
+		if err := ctx.Err(); err != nil {
+			return 0, err
+		}
+
+		_, n, err := readRecord(r, version)
+		if err == io.EOF || errors.Is(err, ErrCorruptRecord) {
+			break
+		}
+		if err != nil {
+			return 0, err
+		}
+		offset += int64(n)
+	}
+
+	return offset, nil
+}
+
+// patchRange copies the bytes from offset to end of src over dst, and syncs dst
+func patchRange(dst, src string, offset, end int64) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_WRONLY, 0)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	buf := make([]byte, end-offset)
+	if _, err := in.ReadAt(buf, offset); err != nil {
+		return err
+	}
+	if _, err := out.WriteAt(buf, offset); err != nil {
+		return err
+	}
+
+	return out.Sync()
+}
+
+// startScrubber starts the scrubber
+func (wal *WAL) startScrubber() {
+	stop, done := make(chan struct{}), make(chan struct{})
+	wal.scrubStop, wal.scrubDone = stop, done
+	go withLabels(context.Background(), "scrubber", func(ctx context.Context) {
+		wal.runScrubber(ctx, stop, done)
+	})
+}
+
+// stopScrubber stops the scrubber and waits for it to exit
+func (wal *WAL) stopScrubber() {
+	wal.logMutex.Lock()
+	stop, done := wal.scrubStop, wal.scrubDone
+	wal.scrubStop, wal.scrubDone = nil, nil
+	wal.logMutex.Unlock()
+
+	if stop == nil {
+		return
+	}
+	close(stop)
+	<-done
+}
+
+// runScrubber scrubs the log on every tick until stop is closed
+func (wal *WAL) runScrubber(ctx context.Context, stop, done chan struct{}) {
+	defer close(done)
+
+	// Stopping abandons a pass in progress
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		select {
+		case <-stop:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	ticker := wal.clock.NewTicker(wal.scrubInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C():
+			report, err := wal.Scrub(ctx)
+			if ctx.Err() != nil {
+				return
+			}
+			if wal.scrubReport != nil {
+				wal.scrubReport(report, err)
+			}
+		}
+	}
+}
@@ -0,0 +1,138 @@
+package wal
+
+import (
+	"io"
+	"os"
+	"runtime/debug"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// Session identifies the process that opened a log for writing
+type Session struct {
+	LSN     uint64 // LSN of the record announcing the session
+	Time    time.Time
+	Host    string
+	PID     int
+	Version string // version of the main module of the writing binary
+	Labels  map[string]string
+}
+
+// WithSessionInfo announces each opening of the log with a record naming the
+// host, process ID and binary version of the writer, along with labels, so
+// the records that follow can be attributed to the process that wrote them.
+// The record is a heartbeat, so it changes nothing and readers that do not
+// know about sessions skip it. ReadSessions lists the sessions of a log.
+func WithSessionInfo(labels map[string]string) Option {
+	return func(wal *WAL) {
+		wal.sessionInfo = true
+		wal.sessionLabels = labels
+	}
+}
+
+// SessionOf returns the session a record announces, and false if record
+// does not announce one
+func SessionOf(record LogRecord) (*Session, bool) {
+	if record.Operation != opNoop {
+		return nil, false
+	}
+
+	// The time, then host, PID and version, then label pairs
+	fields, err := decodeFields(record.Data)
+	if err != nil || len(fields) < 4 || len(fields)%2 != 0 {
+		return nil, false
+	}
+	nanos, err := strconv.ParseInt(fields[0], 10, 64)
+	if err != nil {
+		return nil, false
+	}
+	pid, err := strconv.Atoi(fields[2])
+	if err != nil {
+		return nil, false
+	}
+
+	session := &Session{
+		LSN:     record.LSN,
+		Time:    time.Unix(0, nanos),
+		Host:    fields[1],
+		PID:     pid,
+		Version: fields[3],
+		Labels:  make(map[string]string),
+	}
+	for i := 4; i < len(fields); i += 2 {
+		session.Labels[fields[i]] = fields[i+1]
+	}
+	return session, true
+}
+
+// ReadSessions returns the sessions announced in the log at filename, oldest
+// first
+func ReadSessions(filename string) ([]Session, error) {
+	lr, err := OpenLogReader(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer lr.Close()
+
+	sessions := []Session{}
+	for {
+		record, err := lr.Next()
+		if err == io.EOF {
+			return sessions, nil
+		}
+		if err != nil {
+			return sessions, err
+		}
+		if session, ok := SessionOf(record); ok {
+			sessions = append(sessions, *session)
+		}
+	}
+}
+
+// writeSession writes and syncs the record announcing this session. The
+// caller must hold logMutex.
+func (wal *WAL) writeSession() error {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "unknown"
+	}
+	version := "unknown"
+	if info, ok := debug.ReadBuildInfo(); ok {
+		version = info.Main.Version
+	}
+
+	fields := []string{
+		strconv.FormatInt(wal.hlc.stamp(wal.clock.Now()).UnixNano(), 10),
+		host,
+		strconv.Itoa(os.Getpid()),
+		version,
+	}
+	keys := make([]string, 0, len(wal.sessionLabels))
+	for key := range wal.sessionLabels {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		fields = append(fields, key, wal.sessionLabels[key])
+	}
+
+	record := LogRecord{
+		LSN:       wal.currentLSN + 1,
+		Term:      wal.term,
+		Operation: opNoop,
+		Data:      encodeFields(fields...),
+	}
+	record.CRC32 = recordChecksum(record)
+
+	buf := encodeRecord(record, wal.logVersion)
+	if err := wal.checkQuota(len(buf)); err != nil {
+		return err
+	}
+	if err := wal.writeEncoded(buf); err != nil {
+		return err
+	}
+	wal.currentLSN = record.LSN
+
+	return wal.syncLog()
+}
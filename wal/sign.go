@@ -0,0 +1,89 @@
+package wal
+
+import (
+	"bufio"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// ErrBadSignature is returned when a chain record of a log is not signed by
+// the expected key
+var ErrBadSignature = errors.New("wal: bad chain signature")
+
+// WithSigningKey turns on WithHashChain and signs every chain record with
+// key, so that anyone holding the public key can check with VerifySignatures
+// that the log up to its last chain record was written by the key's owner
+func WithSigningKey(key ed25519.PrivateKey) Option {
+	return func(wal *WAL) {
+		wal.hashChain = true
+		wal.signingKey = key
+	}
+}
+
+// signChain signs the hash of a chain record at lsn, or returns nil without
+// a signing key
+func (wal *WAL) signChain(lsn uint64, sum []byte) []byte {
+	if wal.signingKey == nil {
+		return nil
+	}
+	return ed25519.Sign(wal.signingKey, chainMessage(lsn, sum))
+}
+
+// chainMessage is what the signature of a chain record covers: its LSN and
+// hash, so a signature cannot be moved to another place in the log
+func chainMessage(lsn uint64, sum []byte) []byte {
+	return append(uint64ToBytes(lsn), sum...)
+}
+
+// VerifySignatures checks the log at filename as VerifyLog does, and also
+// that it has a hash chain whose every record is signed with the private
+// half of key. Records after the last chain record are not covered.
+func VerifySignatures(filename string, key ed25519.PublicKey) error {
+	if err := VerifyLog(filename); err != nil {
+		return err
+	}
+
+	file, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	r := bufio.NewReader(file)
+	header, err := readHeader(r)
+	if err != nil {
+		return fmt.Errorf("%s: %w", filename, err)
+	}
+
+	signed := 0
+	for {
+		record, _, err := readRecord(r, header.Version)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %w", filename, err)
+		}
+		if record.Operation != opChain {
+			continue
+		}
+
+		data := []byte(record.Data)
+		if len(data) != sha256.Size+ed25519.SignatureSize {
+			return fmt.Errorf("%s: %w: chain record at LSN %d is not signed", filename, ErrBadSignature, record.LSN)
+		}
+		if !ed25519.Verify(key, chainMessage(record.LSN, data[:sha256.Size]), data[sha256.Size:]) {
+			return fmt.Errorf("%s: %w at LSN %d", filename, ErrBadSignature, record.LSN)
+		}
+		signed++
+	}
+
+	if signed == 0 {
+		return fmt.Errorf("%s: %w: the log has no signed chain records", filename, ErrBadSignature)
+	}
+	return nil
+}
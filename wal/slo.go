@@ -0,0 +1,56 @@
+package wal
+
+import "time"
+
+// sloRecoveryCommits is how many consecutive commits must meet the latency
+// target before a degraded WAL is considered healthy again
+const sloRecoveryCommits = 10
+
+// WithCommitSLO marks the WAL degraded as soon as a commit takes longer than
+// target, and healthy again once sloRecoveryCommits commits in a row have
+// not. onChange, if not nil, is called with the new state on every change,
+// after the log lock is released, so operators can react before callers
+// start timing out.
+func WithCommitSLO(target time.Duration, onChange func(degraded bool)) Option {
+	return func(wal *WAL) {
+		wal.sloTarget = target
+		wal.sloOnChange = onChange
+	}
+}
+
+// Degraded reports whether recent commits have missed the WithCommitSLO target
+func (wal *WAL) Degraded() bool {
+	wal.sloMutex.Lock()
+	defer wal.sloMutex.Unlock()
+
+	return wal.degraded
+}
+
+// checkCommitSLO updates the degraded state with a commit's latency
+func (wal *WAL) checkCommitSLO(result CommitResult) {
+	if wal.sloTarget <= 0 {
+		return
+	}
+
+	latency := result.Queue + result.Encode + result.Write + result.Sync + result.Apply
+
+	wal.sloMutex.Lock()
+	changed := false
+	if latency > wal.sloTarget {
+		wal.sloMet = 0
+		changed = !wal.degraded
+		wal.degraded = true
+	} else if wal.degraded {
+		wal.sloMet++
+		if wal.sloMet >= sloRecoveryCommits {
+			wal.degraded = false
+			changed = true
+		}
+	}
+	degraded := wal.degraded
+	wal.sloMutex.Unlock()
+
+	if changed && wal.sloOnChange != nil {
+		wal.sloOnChange(degraded)
+	}
+}
@@ -0,0 +1,84 @@
+package wal
+
+import (
+	"fmt"
+	"io"
+)
+
+// LogRangeError is returned by NewWAL when the log does not carry on from
+// the snapshot given to WithSnapshotLSN. Replaying it on top of the
+// snapshot would produce a database that matches neither.
+type LogRangeError struct {
+	Path        string
+	SnapshotLSN uint64
+	FirstLSN    uint64 // first LSN the log holds, or would hold if empty
+	LastLSN     uint64 // last LSN the log holds; known only once it is replayed
+}
+
+func (e *LogRangeError) Error() string {
+	if e.SnapshotLSN+1 < e.FirstLSN {
+		return fmt.Sprintf("wal: %s: log starts at LSN %d but the snapshot ends at LSN %d; LSNs %d to %d are in neither",
+			e.Path, e.FirstLSN, e.SnapshotLSN, e.SnapshotLSN+1, e.FirstLSN-1)
+	}
+	return fmt.Sprintf("wal: %s: log ends at LSN %d but the snapshot ends at LSN %d; the log has lost LSNs %d to %d",
+		e.Path, e.LastLSN, e.SnapshotLSN, e.LastLSN+1, e.SnapshotLSN)
+}
+
+// Unwrap makes a LogRangeError match ErrLSNOutOfRange
+func (e *LogRangeError) Unwrap() error {
+	return ErrLSNOutOfRange
+}
+
+// WithSnapshotLSN tells NewWAL that the caller's own snapshot of the
+// database, such as the one DropBefore expects callers to keep, covers the
+// transactions through lsn, and has it check on open that the log carries
+// on from there. If the log starts after lsn+1, the transactions between
+// are lost, and this is found before the log is replayed. If the log ends
+// before lsn, it has lost transactions the snapshot has. Either way NewWAL
+// fails with a *LogRangeError.
+func WithSnapshotLSN(lsn uint64) Option {
+	return func(wal *WAL) {
+		wal.snapshotLSN = lsn
+		wal.checkSnapshot = true
+	}
+}
+
+// checkLogStart checks, before replay, that the log does not start after
+// the snapshot ends
+func (wal *WAL) checkLogStart() error {
+	if !wal.checkSnapshot {
+		return nil
+	}
+
+	info, err := wal.file.Stat()
+	if err != nil {
+		return err
+	}
+	var base uint64
+	if info.Size() > 0 {
+		header, err := readHeader(io.NewSectionReader(wal.file, 0, info.Size()))
+		if err != nil {
+			return err
+		}
+		base = header.BaseLSN
+	}
+
+	if wal.snapshotLSN < base {
+		return &LogRangeError{Path: wal.file.Name(), SnapshotLSN: wal.snapshotLSN, FirstLSN: base + 1}
+	}
+	return nil
+}
+
+// checkLogEnd checks, after replay, that the log does not end before the
+// snapshot does
+func (wal *WAL) checkLogEnd() error {
+	if !wal.checkSnapshot || wal.snapshotLSN <= wal.currentLSN {
+		return nil
+	}
+	return &LogRangeError{
+		Path:        wal.file.Name(),
+		SnapshotLSN: wal.snapshotLSN,
+		FirstLSN:    wal.baseLSN + 1,
+		LastLSN:     wal.currentLSN,
+	}
+}
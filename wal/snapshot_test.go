@@ -0,0 +1,107 @@
+package wal
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// adversarialSnapshots are databases whose keys and values are likely to
+// trip up a snapshot encoding
+var adversarialSnapshots = map[string]map[string]string{
+	"empty":             {},
+	"empty key":         {"": "value"},
+	"empty value":       {"key": ""},
+	"empty key value":   {"": ""},
+	"nul":               {"a\x00b": "\x00", "\x00": "c\x00\x00d"},
+	"separators":        {"a=b": "c=d", "line\n": "\nline\r\n", "k\x1f": "\x1e\x1d"},
+	"length prefixes":   {"\x80\x80\x80\x80\x01": "\xff\xff\xff\xff\x0f", "\x05": "\x00\x00\x00\x05"},
+	"magic":             {"SNAP": "SNAP", string(uint32ToBytes(snapshotMagic)): "x"},
+	"invalid utf-8":     {"\xff\xfe": "\xc3\x28", "\xed\xa0\x80": "\xf4\x90\x80\x80"},
+	"large value":       {"big": strings.Repeat("v", 8<<20)},
+	"large key":         {strings.Repeat("k", 1<<20): "v"},
+	"many keys":         manyKeys(10000),
+	"prefix keys":       {"a": "1", "aa": "2", "aaa": "3", "a\x00": "4"},
+	"binary everywhere": allBytes(),
+}
+
+func manyKeys(n int) map[string]string {
+	db := make(map[string]string, n)
+	for i := 0; i < n; i++ {
+		db[strconv.Itoa(i)] = strings.Repeat("x", i%17)
+	}
+	return db
+}
+
+func allBytes() map[string]string {
+	db := make(map[string]string, 256)
+	for i := 0; i < 256; i++ {
+		db[string([]byte{byte(i)})] = string([]byte{byte(255 - i), byte(i)})
+	}
+	return db
+}
+
+func TestBinaryCodecRoundTrip(t *testing.T) {
+	testRoundTrip(t, BinaryCodec{})
+}
+
+func TestGobCodecRoundTrip(t *testing.T) {
+	testRoundTrip(t, GobCodec{})
+}
+
+func testRoundTrip(t *testing.T, codec SnapshotCodec) {
+	for name, db := range adversarialSnapshots {
+		db := db
+		t.Run(name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := codec.Encode(&buf, db); err != nil {
+				t.Fatalf("Encode: %v", err)
+			}
+			got, err := codec.Decode(&buf)
+			if err != nil {
+				t.Fatalf("Decode: %v", err)
+			}
+			if !reflect.DeepEqual(got, db) {
+				t.Fatalf("decoded %d keys, want %d, or contents differ", len(got), len(db))
+			}
+		})
+	}
+}
+
+func TestBinaryCodecDeterministic(t *testing.T) {
+	db := adversarialSnapshots["separators"]
+	var a, b bytes.Buffer
+	if err := (BinaryCodec{}).Encode(&a, db); err != nil {
+		t.Fatal(err)
+	}
+	if err := (BinaryCodec{}).Encode(&b, db); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(a.Bytes(), b.Bytes()) {
+		t.Fatal("two encodings of the same database differ")
+	}
+}
+
+func TestBinaryCodecDetectsDamage(t *testing.T) {
+	var buf bytes.Buffer
+	if err := (BinaryCodec{}).Encode(&buf, adversarialSnapshots["nul"]); err != nil {
+		t.Fatal(err)
+	}
+	encoded := buf.Bytes()
+
+	for i := range encoded {
+		damaged := append([]byte(nil), encoded...)
+		damaged[i] ^= 0x40
+		if _, err := (BinaryCodec{}).Decode(bytes.NewReader(damaged)); !errors.Is(err, ErrCorruptSnapshot) {
+			t.Fatalf("flipping byte %d: got %v, want ErrCorruptSnapshot", i, err)
+		}
+	}
+	for n := 0; n < len(encoded); n++ {
+		if _, err := (BinaryCodec{}).Decode(bytes.NewReader(encoded[:n])); !errors.Is(err, ErrCorruptSnapshot) {
+			t.Fatalf("truncating to %d bytes: got %v, want ErrCorruptSnapshot", n, err)
+		}
+	}
+}
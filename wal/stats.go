@@ -0,0 +1,138 @@
+package wal
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Stats describes how far the log extends and how far along its consumers
+// are, as LSN watermarks, so that a system coordinating retention, such as
+// a backup scheduler, can tell what may be dropped without knowing how the
+// WAL works
+type Stats struct {
+	FirstLSN    uint64 `json:"first_lsn"`    // first record still in the log
+	LastLSN     uint64 `json:"last_lsn"`     // last record written
+	AppliedLSN  uint64 `json:"applied_lsn"`  // last transaction applied to the database
+	ArchivedLSN uint64 `json:"archived_lsn"` // end of the last Backup taken since the log was opened
+	AckedLSN    uint64 `json:"acked_lsn"`    // last record the remote appender acknowledged
+	LogSize     int64  `json:"log_size"`
+	DiskUsage   int64  `json:"disk_usage"`    // log and snapshot
+	DiskQuota   int64  `json:"disk_quota"`    // zero without a quota
+	Degraded    bool   `json:"degraded"`      // recent commits missed the WithCommitSLO target
+	Pending     int64  `json:"pending_bytes"` // of the open transaction's records
+	ActiveTxns  int    `json:"active_txns"`   // passed to CommitTxn and not committed yet
+}
+
+// WithWatermarkFile writes the WAL's Stats as JSON to the file at name every
+// interval, when they have changed, and when the WAL is closed. The file is
+// replaced atomically, so a reader never sees it half written.
+func WithWatermarkFile(name string, interval time.Duration) Option {
+	return func(wal *WAL) {
+		wal.watermarkFile = name
+		wal.watermarkPeriod = interval
+	}
+}
+
+// Stats returns the log's current watermarks
+func (wal *WAL) Stats() Stats {
+	wal.logMutex.Lock()
+	stats := Stats{
+		FirstLSN:    wal.baseLSN + 1,
+		LastLSN:     wal.currentLSN,
+		ArchivedLSN: wal.archivedLSN,
+		LogSize:     wal.logSize,
+		DiskUsage:   wal.diskUsage(),
+		DiskQuota:   wal.diskQuota,
+		Pending:     wal.pendingBytes,
+	}
+	wal.logMutex.Unlock()
+
+	stats.AppliedLSN = wal.CommittedLSN()
+	stats.Degraded = wal.Degraded()
+	stats.ActiveTxns = wal.ActiveTxns()
+	if wal.remote != nil {
+		stats.AckedLSN = wal.remote.acked.Load()
+	}
+	return stats
+}
+
+// startWatermarks starts the worker writing the watermark file
+func (wal *WAL) startWatermarks() {
+	stop, done := make(chan struct{}), make(chan struct{})
+	wal.watermarkStop, wal.watermarkDone = stop, done
+	go withLabels(context.Background(), "watermarks", func(context.Context) {
+		wal.runWatermarks(stop, done)
+	})
+}
+
+// stopWatermarks stops the worker and writes the watermark file a last time
+func (wal *WAL) stopWatermarks() {
+	if wal.watermarkStop == nil {
+		return
+	}
+	close(wal.watermarkStop)
+	<-wal.watermarkDone
+	wal.watermarkStop, wal.watermarkDone = nil, nil
+}
+
+// runWatermarks writes the watermark file on every tick the stats have
+// changed, and once more when stop is closed
+func (wal *WAL) runWatermarks(stop, done chan struct{}) {
+	defer close(done)
+
+	ticker := wal.clock.NewTicker(wal.watermarkPeriod)
+	defer ticker.Stop()
+
+	var written Stats
+	write := func() {
+		// A failed write is retried on the next tick
+		if stats := wal.Stats(); stats != written && wal.writeWatermarks(stats) == nil {
+			written = stats
+		}
+	}
+
+	write()
+	for {
+		select {
+		case <-stop:
+			write()
+			return
+		case <-ticker.C():
+			write()
+		}
+	}
+}
+
+// writeWatermarks atomically replaces the watermark file
+func (wal *WAL) writeWatermarks(stats Stats) error {
+	buf, err := json.Marshal(stats)
+	if err != nil {
+		return err
+	}
+
+	name := wal.watermarkFile
+	tmpName := name + ".tmp"
+	file, err := wal.openFile(tmpName, os.O_WRONLY|os.O_TRUNC)
+	if err != nil {
+		return err
+	}
+	_, err = file.Write(append(buf, '\n'))
+	if err == nil {
+		err = file.Sync()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmpName, name)
+	}
+	if err != nil {
+		os.Remove(tmpName)
+		return err
+	}
+
+	return syncDir(filepath.Dir(name))
+}
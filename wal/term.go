@@ -0,0 +1,31 @@
+package wal
+
+import "errors"
+
+// ErrTermUnsupported is returned when a term is given to a log in a format
+// version that cannot store one
+var ErrTermUnsupported = errors.New("wal: log format version 2 cannot store terms")
+
+// SetTerm sets the term stamped on records written from now on, so that
+// consensus implementations need not carry it inside the record data. Terms
+// are stored in the record frame and returned in LogRecord.Term. Logs
+// created before format version 3 accept only the zero term.
+func (wal *WAL) SetTerm(term uint64) error {
+	wal.logMutex.Lock()
+	defer wal.logMutex.Unlock()
+
+	if term != 0 && wal.logVersion < 3 {
+		return ErrTermUnsupported
+	}
+
+	wal.term = term
+	return nil
+}
+
+// Term returns the term stamped on new records
+func (wal *WAL) Term() uint64 {
+	wal.logMutex.Lock()
+	defer wal.logMutex.Unlock()
+
+	return wal.term
+}
@@ -0,0 +1,37 @@
+package wal
+
+import "time"
+
+// CommitResult breaks down where the time of one commit went
+type CommitResult struct {
+	LSN     uint64
+	Records int           // records in the transaction, including the commit record
+	Queue   time.Duration // waiting for the log lock
+	Encode  time.Duration // checksumming and encoding the commit record
+	Write   time.Duration // writing the commit record
+	Sync    time.Duration // syncing the log and its mirrors
+	Apply   time.Duration // applying to the database and saving its state
+	Err     error
+}
+
+// WithCommitObserver registers a callback that receives the timing breakdown
+// of every commit made through Commit or CommitTransaction, including failed
+// ones. It is called after the log lock is released.
+func WithCommitObserver(fn func(CommitResult)) Option {
+	return func(wal *WAL) {
+		wal.commitObserver = fn
+	}
+}
+
+// observeCommit checks a commit's latency and passes its result to the
+// observer, if any
+func (wal *WAL) observeCommit(result CommitResult, err error) {
+	result.Err = err
+	wal.checkCommitSLO(result)
+
+	if wal.commitObserver == nil {
+		return
+	}
+
+	wal.commitObserver(result)
+}
@@ -0,0 +1,272 @@
+package wal
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// decodeTOML sets the fields of c from a TOML document. Only what a Config
+// needs is understood: keys set to strings, integers, booleans or arrays of
+// strings, and tables of strings, written inline, as a [table] or with
+// dotted keys. As with JSON, unknown keys are an error.
+func (c *Config) decodeTOML(doc string) error {
+	fields := make(map[string]reflect.Value)
+	v := reflect.ValueOf(c).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		tag := strings.Split(v.Type().Field(i).Tag.Get("json"), ",")[0]
+		fields[tag] = v.Field(i)
+	}
+
+	seen := make(map[string]bool)
+	table := ""
+	lines := strings.Split(doc, "\n")
+	for i := 0; i < len(lines); i++ {
+		lineNo := i + 1
+		line := strings.TrimSpace(stripTOMLComment(lines[i]))
+		if line == "" {
+			continue
+		}
+
+		if strings.HasPrefix(line, "[") {
+			if strings.HasPrefix(line, "[[") || !strings.HasSuffix(line, "]") {
+				return fmt.Errorf("line %d: unsupported table header %q", lineNo, line)
+			}
+			name, err := tomlKey(strings.TrimSpace(line[1 : len(line)-1]))
+			if err != nil {
+				return fmt.Errorf("line %d: %w", lineNo, err)
+			}
+			if field, ok := fields[name]; !ok || field.Kind() != reflect.Map {
+				return fmt.Errorf("line %d: unknown table %q", lineNo, name)
+			}
+			if seen[name] {
+				return fmt.Errorf("line %d: %s is set twice", lineNo, name)
+			}
+			seen[name] = true
+			table = name
+			continue
+		}
+
+		rawKey, value, ok := cutUnquoted(line, '=')
+		if !ok {
+			return fmt.Errorf("line %d: want key = value", lineNo)
+		}
+		value = strings.TrimSpace(value)
+		// An array may go on over several lines
+		for strings.HasPrefix(value, "[") && !strings.HasSuffix(value, "]") && i+1 < len(lines) {
+			i++
+			value += " " + strings.TrimSpace(stripTOMLComment(lines[i]))
+		}
+
+		// Within a table, and for a dotted key, the key is a label
+		name, label := table, strings.TrimSpace(rawKey)
+		if name == "" {
+			if before, after, dotted := cutUnquoted(label, '.'); dotted {
+				name, label = strings.TrimSpace(before), strings.TrimSpace(after)
+			} else {
+				name, label = label, ""
+			}
+		}
+		var err error
+		if name, err = tomlKey(name); err != nil {
+			return fmt.Errorf("line %d: %w", lineNo, err)
+		}
+		field, ok := fields[name]
+		if !ok {
+			return fmt.Errorf("line %d: unknown field %q", lineNo, name)
+		}
+
+		if table != "" || label != "" {
+			if field.Kind() != reflect.Map {
+				return fmt.Errorf("line %d: %s is not a table", lineNo, name)
+			}
+			if label, err = tomlKey(label); err != nil {
+				return fmt.Errorf("line %d: %w", lineNo, err)
+			}
+			s, err := tomlString(value)
+			if err != nil {
+				return fmt.Errorf("line %d: %s.%s: %w", lineNo, name, label, err)
+			}
+			if field.IsNil() {
+				field.Set(reflect.MakeMap(field.Type()))
+			}
+			if field.MapIndex(reflect.ValueOf(label)).IsValid() {
+				return fmt.Errorf("line %d: %s.%s is set twice", lineNo, name, label)
+			}
+			field.SetMapIndex(reflect.ValueOf(label), reflect.ValueOf(s))
+			continue
+		}
+
+		if seen[name] {
+			return fmt.Errorf("line %d: %s is set twice", lineNo, name)
+		}
+		seen[name] = true
+		if err := setTOMLField(field, value); err != nil {
+			return fmt.Errorf("line %d: %s: %w", lineNo, name, err)
+		}
+	}
+	return nil
+}
+
+// setTOMLField sets a Config field from a TOML value
+func setTOMLField(field reflect.Value, value string) error {
+	if d, ok := field.Addr().Interface().(*Duration); ok {
+		s, err := tomlString(value)
+		if err != nil {
+			return err
+		}
+		return d.parse(s)
+	}
+
+	switch field.Kind() {
+	case reflect.Bool:
+		switch value {
+		case "true":
+			field.SetBool(true)
+		case "false":
+			field.SetBool(false)
+		default:
+			return fmt.Errorf("%q is not a boolean", value)
+		}
+	case reflect.Int, reflect.Int64:
+		n, err := tomlInt(value)
+		if err != nil {
+			return err
+		}
+		field.SetInt(n)
+	case reflect.String:
+		s, err := tomlString(value)
+		if err != nil {
+			return err
+		}
+		field.SetString(s)
+	case reflect.Ptr:
+		elem := reflect.New(field.Type().Elem())
+		if err := setTOMLField(elem.Elem(), value); err != nil {
+			return err
+		}
+		field.Set(elem)
+	case reflect.Slice:
+		if !strings.HasPrefix(value, "[") || !strings.HasSuffix(value, "]") {
+			return fmt.Errorf("%q is not an array", value)
+		}
+		list := []string{}
+		for _, item := range splitTOMLList(value[1 : len(value)-1]) {
+			s, err := tomlString(item)
+			if err != nil {
+				return err
+			}
+			list = append(list, s)
+		}
+		field.Set(reflect.ValueOf(list))
+	case reflect.Map:
+		if !strings.HasPrefix(value, "{") || !strings.HasSuffix(value, "}") {
+			return fmt.Errorf("%q is not an inline table", value)
+		}
+		labels := make(map[string]string)
+		for _, pair := range splitTOMLList(value[1 : len(value)-1]) {
+			k, v, ok := cutUnquoted(pair, '=')
+			if !ok {
+				return fmt.Errorf("%q is not key = value", pair)
+			}
+			key, err := tomlKey(strings.TrimSpace(k))
+			if err != nil {
+				return err
+			}
+			s, err := tomlString(strings.TrimSpace(v))
+			if err != nil {
+				return err
+			}
+			labels[key] = s
+		}
+		field.Set(reflect.ValueOf(labels))
+	default:
+		return fmt.Errorf("unsupported field type %s", field.Type())
+	}
+	return nil
+}
+
+// tomlString parses a basic ("...") or literal ('...') string
+func tomlString(value string) (string, error) {
+	if strings.HasPrefix(value, `"""`) || strings.HasPrefix(value, "'''") {
+		return "", fmt.Errorf("multi-line strings are not supported")
+	}
+	if len(value) >= 2 && value[0] == '\'' && value[len(value)-1] == '\'' && !strings.Contains(value[1:len(value)-1], "'") {
+		return value[1 : len(value)-1], nil
+	}
+	if len(value) >= 2 && value[0] == '"' {
+		if s, err := strconv.Unquote(value); err == nil {
+			return s, nil
+		}
+	}
+	return "", fmt.Errorf("%s is not a string", value)
+}
+
+// tomlInt parses a decimal, hexadecimal, octal or binary integer, which
+// may have underscores between digits
+func tomlInt(value string) (int64, error) {
+	digits := strings.TrimLeft(value, "+-")
+	if len(digits) > 1 && digits[0] == '0' && digits[1] >= '0' && digits[1] <= '9' {
+		return 0, fmt.Errorf("%q has a leading zero", value)
+	}
+	return strconv.ParseInt(value, 0, 64)
+}
+
+// tomlKey unquotes a bare or quoted key
+func tomlKey(key string) (string, error) {
+	if strings.HasPrefix(key, `"`) || strings.HasPrefix(key, "'") {
+		return tomlString(key)
+	}
+	for _, r := range key {
+		if !(r == '_' || r == '-' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9') {
+			return "", fmt.Errorf("%q is not a valid key", key)
+		}
+	}
+	if key == "" {
+		return "", fmt.Errorf("empty key")
+	}
+	return key, nil
+}
+
+// cutUnquoted slices s around the first c outside strings
+func cutUnquoted(s string, c byte) (before, after string, found bool) {
+	quote := byte(0)
+	for i := 0; i < len(s); i++ {
+		switch {
+		case quote != 0:
+			if s[i] == '\\' && quote == '"' {
+				i++
+			} else if s[i] == quote {
+				quote = 0
+			}
+		case s[i] == '"' || s[i] == '\'':
+			quote = s[i]
+		case s[i] == c:
+			return s[:i], s[i+1:], true
+		}
+	}
+	return s, "", false
+}
+
+// splitTOMLList splits the items of an array or inline table on the commas
+// outside strings, allowing a trailing comma
+func splitTOMLList(s string) []string {
+	var items []string
+	for {
+		item, rest, found := cutUnquoted(s, ',')
+		if item = strings.TrimSpace(item); item != "" || found {
+			items = append(items, item)
+		}
+		if !found {
+			return items
+		}
+		s = rest
+	}
+}
+
+// stripTOMLComment removes a comment from a line, leaving strings alone
+func stripTOMLComment(line string) string {
+	line, _, _ = cutUnquoted(line, '#')
+	return line
+}
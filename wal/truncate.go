@@ -0,0 +1,262 @@
+package wal
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// ErrLSNOutOfRange is returned when an LSN lies before the start of the log
+var ErrLSNOutOfRange = errors.New("wal: LSN out of range")
+
+// Truncate deletes every record after afterLSN, e.g. when a consensus
+// follower must discard a divergent tail. The database is rebuilt from what
+// remains, so transactions that committed after afterLSN are undone, and a
+// transaction cut in two is dropped entirely. The log's mirrors are
+// truncated with it.
+func (wal *WAL) Truncate(afterLSN uint64) error {
+	wal.logMutex.Lock()
+	defer wal.logMutex.Unlock()
+
+	return wal.truncate(afterLSN)
+}
+
+// truncate implements Truncate. The caller must hold logMutex.
+func (wal *WAL) truncate(afterLSN uint64) error {
+	if len(wal.records) > 0 {
+		return ErrTransactionInProgress
+	}
+	if afterLSN >= wal.currentLSN {
+		return nil
+	}
+	if err := wal.checkEpoch(); err != nil {
+		return err
+	}
+
+	// Nothing may be applied from the old tail once it is gone
+	wal.drainApplier()
+
+	offset, err := recordOffset(wal.file, afterLSN)
+	if err != nil {
+		return err
+	}
+	if err := wal.file.Truncate(offset); err != nil {
+		return err
+	}
+	wal.rewrites++
+	if wal.remote != nil {
+		if err := wal.remote.truncate(afterLSN); err != nil {
+			return err
+		}
+	}
+
+	wal.batchHint = batchPosition{}
+	wal.applying.Lock()
+	defer wal.applying.Unlock()
+	wal.resetDB()
+	if err := wal.restoreLog(context.Background(), nil); err != nil {
+		return err
+	}
+	// Replay dropped any replicated transaction left incomplete
+	wal.replicated = nil
+
+	for _, m := range wal.mirrors {
+		if m.failed != nil {
+			continue
+		}
+		if err := m.file.Truncate(wal.logSize); err != nil {
+			m.failed = err
+		}
+	}
+	if err := wal.syncLog(); err != nil {
+		return err
+	}
+
+	lsn := wal.CommittedLSN()
+	wal.queuedLSN = lsn
+	return wal.flushDB(lsn)
+}
+
+// DropBefore deletes the transactions that ended before lsn from the start
+// of the log, for callers that keep their own snapshot of the state those
+// transactions produced, e.g. after installing a Raft snapshot. Only whole
+// transactions are dropped. The LSN preceding the first retained record is
+// kept in the log header, so LSNs stay the same. The database is left as it
+// is, but reopening the log no longer restores the dropped transactions.
+func (wal *WAL) DropBefore(lsn uint64) error {
+	wal.logMutex.Lock()
+	defer wal.logMutex.Unlock()
+
+	if err := wal.checkEpoch(); err != nil {
+		return err
+	}
+
+	cut, base, err := transactionBoundary(wal.file, lsn)
+	if err != nil || base <= wal.baseLSN {
+		return err
+	}
+
+	// Rewrite the retained records under a new header, padded so that they
+	// keep their alignment
+	header := encodeHeader(logHeader{Version: wal.logVersion, BaseLSN: base})
+	if wal.alignment > 0 {
+		if gap := (cut - headerSize) % wal.alignment; gap != 0 {
+			header = append(header, wal.paddingRecord(gap)...)
+		}
+	}
+
+	name := wal.file.Name()
+	tmpName := name + ".drop"
+	retained := io.NewSectionReader(wal.file, cut, wal.logSize-cut)
+	if err := wal.writeRetained(tmpName, header, retained); err != nil {
+		os.Remove(tmpName)
+		return err
+	}
+	if err := os.Rename(tmpName, name); err != nil {
+		os.Remove(tmpName)
+		return err
+	}
+	if err := syncDir(filepath.Dir(name)); err != nil {
+		return err
+	}
+
+	file, err := wal.openFile(name, os.O_APPEND|os.O_RDWR)
+	if err != nil {
+		return err
+	}
+	wal.file.Close()
+	wal.file = file
+	wal.rewrites++
+	wal.baseLSN = base
+	wal.batchHint = batchPosition{}
+	wal.logSize = int64(len(header)) + wal.logSize - cut
+
+	// Mirrors are rewritten from the new log
+	for _, m := range wal.mirrors {
+		if m.failed != nil {
+			continue
+		}
+		if err := m.file.Truncate(0); err != nil {
+			m.failed = err
+			continue
+		}
+		if err := alignMirror(wal.file, m.file); err != nil {
+			m.failed = err
+		}
+	}
+
+	return nil
+}
+
+// FirstLSN returns the LSN of the first record the log retains
+func (wal *WAL) FirstLSN() uint64 {
+	wal.logMutex.Lock()
+	defer wal.logMutex.Unlock()
+
+	return wal.baseLSN + 1
+}
+
+// transactionBoundary returns the offset just past the last transaction in
+// the log file that ended before lsn, and the LSN it ended at
+func transactionBoundary(file *os.File, lsn uint64) (int64, uint64, error) {
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return 0, 0, err
+	}
+
+	r := bufio.NewReader(file)
+	header, err := readHeader(r)
+	if err != nil {
+		return 0, 0, fmt.Errorf("%s: %w", file.Name(), err)
+	}
+
+	cut, base := int64(headerSize), header.BaseLSN
+	offset := cut
+	for {
+		record, n, err := readRecord(r, header.Version)
+		if err == io.EOF || errors.Is(err, ErrCorruptRecord) {
+			break
+		}
+		if err != nil {
+			return 0, 0, err
+		}
+		if record.Operation != opPad && record.LSN >= lsn {
+			break
+		}
+
+		offset += int64(n)
+		if record.Operation == opCommit || record.Operation == opAbort {
+			cut, base = offset, record.LSN
+		}
+	}
+
+	return cut, base, nil
+}
+
+// writeRetained writes a synced log made of header followed by records
+func (wal *WAL) writeRetained(name string, header []byte, records io.Reader) error {
+	file, err := wal.openFile(name, os.O_WRONLY|os.O_TRUNC)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	if _, err := file.Write(header); err != nil {
+		return err
+	}
+	if _, err := io.Copy(file, records); err != nil {
+		return err
+	}
+
+	return file.Sync()
+}
+
+// recordOffset returns the offset just past the last record at or before
+// lsn in the log file
+func recordOffset(file *os.File, lsn uint64) (int64, error) {
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return 0, err
+	}
+
+	r := bufio.NewReader(file)
+	header, err := readHeader(r)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", file.Name(), err)
+	}
+	if lsn < header.BaseLSN {
+		return 0, fmt.Errorf("%w: %d precedes the first record of %s (%d)", ErrLSNOutOfRange, lsn, file.Name(), header.BaseLSN+1)
+	}
+
+	offset := int64(headerSize)
+	for {
+		record, n, err := readRecord(r, header.Version)
+		if err == io.EOF || errors.Is(err, ErrCorruptRecord) {
+			break
+		}
+		if err != nil {
+			return 0, err
+		}
+		if record.LSN > lsn {
+			break
+		}
+		offset += int64(n)
+	}
+
+	return offset, nil
+}
+
+// resetDB empties the database, its expiries and its indexes
+func (wal *WAL) resetDB() {
+	wal.dbMutex.Lock()
+	defer wal.dbMutex.Unlock()
+
+	wal.inMemoryDB = make(map[string]string)
+	wal.dbShared = false
+	wal.expiries = make(map[string]int64)
+	for name, idx := range wal.indexes {
+		wal.indexes[name] = newIndex(idx.extract)
+	}
+}
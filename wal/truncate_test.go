@@ -0,0 +1,195 @@
+package wal
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// commitKeys commits one transaction per key, each putting the key, and
+// returns the LSNs of their commit records
+func commitKeys(t *testing.T, log *WAL, keys ...string) []uint64 {
+	t.Helper()
+	lsns := make([]uint64, len(keys))
+	for i, key := range keys {
+		if err := log.Put(key, "v"); err != nil {
+			t.Fatal(err)
+		}
+		lsn, err := log.Commit()
+		if err != nil {
+			t.Fatal(err)
+		}
+		lsns[i] = lsn
+	}
+	return lsns
+}
+
+// keysOf returns the keys of a database, for comparing with a want list
+func keysOf(db map[string]string) map[string]bool {
+	keys := make(map[string]bool, len(db))
+	for key := range db {
+		keys[key] = true
+	}
+	return keys
+}
+
+func keySet(keys ...string) map[string]bool {
+	set := make(map[string]bool, len(keys))
+	for _, key := range keys {
+		set[key] = true
+	}
+	return set
+}
+
+func TestTruncate(t *testing.T) {
+	keys := []string{"k0", "k1", "k2", "k3", "k4"}
+	for _, tc := range []struct {
+		name  string
+		after func(lsns []uint64) uint64
+		want  map[string]bool
+	}{
+		{"at a commit", func(lsns []uint64) uint64 { return lsns[2] }, keySet("k0", "k1", "k2")},
+		// The put of k2 is kept, but its transaction is cut in two
+		{"inside a transaction", func(lsns []uint64) uint64 { return lsns[2] - 1 }, keySet("k0", "k1")},
+		{"before everything", func([]uint64) uint64 { return 0 }, keySet()},
+	} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			name := filepath.Join(inTempDir(t), "wal.log")
+			log, err := NewWAL(name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer log.Close()
+			lsns := commitKeys(t, log, keys...)
+
+			if err := log.Truncate(tc.after(lsns)); err != nil {
+				t.Fatalf("Truncate: %v", err)
+			}
+			if got := keysOf(readAll(log)); !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("after Truncate the database holds %v, want %v", got, tc.want)
+			}
+
+			// The log carries on from the cut
+			commitKeys(t, log, "after")
+			live := readAll(log)
+			log.Close()
+
+			if err := VerifyLog(name); err != nil {
+				t.Fatalf("VerifyLog: %v", err)
+			}
+			log, err = NewWAL(name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer log.Close()
+			if got := readAll(log); !reflect.DeepEqual(got, live) {
+				t.Errorf("reopened with %v, want %v", got, live)
+			}
+		})
+	}
+}
+
+func TestDropBefore(t *testing.T) {
+	keys := []string{"k0", "k1", "k2", "k3", "k4"}
+	for _, tc := range []struct {
+		name   string
+		before func(lsns []uint64) uint64
+		want   map[string]bool // what replay restores
+		first  func(lsns []uint64) uint64
+	}{
+		{"at a boundary", func(lsns []uint64) uint64 { return lsns[2] + 1 }, keySet("k3", "k4"), func(lsns []uint64) uint64 { return lsns[2] + 1 }},
+		// Only whole transactions are dropped, so k2's stays
+		{"inside a transaction", func(lsns []uint64) uint64 { return lsns[2] }, keySet("k2", "k3", "k4"), func(lsns []uint64) uint64 { return lsns[1] + 1 }},
+	} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			name := filepath.Join(inTempDir(t), "wal.log")
+			log, err := NewWAL(name, WithFileMode(0640, 0750))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer log.Close()
+			lsns := commitKeys(t, log, keys...)
+			live := readAll(log)
+
+			if err := log.DropBefore(tc.before(lsns)); err != nil {
+				t.Fatalf("DropBefore: %v", err)
+			}
+			if got := readAll(log); !reflect.DeepEqual(got, live) {
+				t.Errorf("DropBefore changed the database to %v", got)
+			}
+			if first := log.FirstLSN(); first != tc.first(lsns) {
+				t.Errorf("FirstLSN is %d, want %d", first, tc.first(lsns))
+			}
+			info, err := os.Stat(name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if mode := info.Mode().Perm(); mode != 0640 {
+				t.Errorf("rewritten log has mode %o, want 640", mode)
+			}
+
+			// The log carries on with the same LSNs
+			after := commitKeys(t, log, "after")
+			log.Close()
+
+			if err := VerifyLog(name); err != nil {
+				t.Fatalf("VerifyLog: %v", err)
+			}
+			log, err = NewWAL(name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer log.Close()
+			want := keySet("after")
+			for key := range tc.want {
+				want[key] = true
+			}
+			if got := keysOf(readAll(log)); !reflect.DeepEqual(got, want) {
+				t.Errorf("reopened with %v, want %v", got, want)
+			}
+			if lsn := log.CommittedLSN(); lsn != after[0] {
+				t.Errorf("reopened at LSN %d, want %d", lsn, after[0])
+			}
+			if first := log.FirstLSN(); first != tc.first(lsns) {
+				t.Errorf("reopened with FirstLSN %d, want %d", first, tc.first(lsns))
+			}
+		})
+	}
+}
+
+// TestDropBeforeAligned checks that dropping keeps the retained records
+// aligned
+func TestDropBeforeAligned(t *testing.T) {
+	name := filepath.Join(inTempDir(t), "wal.log")
+	log, err := NewWAL(name, WithRecordAlignment(512))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer log.Close()
+	var keys []string
+	for i := 0; i < 10; i++ {
+		keys = append(keys, fmt.Sprintf("k%d", i))
+	}
+	lsns := commitKeys(t, log, keys...)
+	if err := log.DropBefore(lsns[4] + 1); err != nil {
+		t.Fatal(err)
+	}
+	commitKeys(t, log, "after")
+	log.Close()
+
+	if err := VerifyLog(name); err != nil {
+		t.Fatalf("VerifyLog: %v", err)
+	}
+	log, err = NewWAL(name, WithRecordAlignment(512))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer log.Close()
+	if got, want := keysOf(readAll(log)), keySet("k5", "k6", "k7", "k8", "k9", "after"); !reflect.DeepEqual(got, want) {
+		t.Errorf("reopened with %v, want %v", got, want)
+	}
+}
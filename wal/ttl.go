@@ -0,0 +1,125 @@
+package wal
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"time"
+)
+
+const (
+	// opPutTTL sets a key that expires at an absolute time
+	opPutTTL = "PUT TTL"
+	// opExpire is the tombstone the expiry worker writes for an expired key
+	opExpire = "EXPIRE"
+)
+
+// defaultExpiryInterval is how often the expiry worker runs by default
+const defaultExpiryInterval = time.Second
+
+// WithExpiryInterval sets how often the expiry worker looks for expired keys
+func WithExpiryInterval(interval time.Duration) Option {
+	return func(wal *WAL) {
+		wal.expiryInterval = interval
+	}
+}
+
+// PutWithTTL sets key to value until ttl has passed. Expired keys stay
+// visible until the background expiry worker logs a tombstone for them, so
+// replay after a crash reproduces exactly the state that was visible.
+func (wal *WAL) PutWithTTL(key, value string, ttl time.Duration) error {
+	expiresAt := wal.clock.Now().Add(ttl).UnixNano()
+	return wal.WriteRecord(opPutTTL, encodeFields(key, value, strconv.FormatInt(expiresAt, 10)))
+}
+
+// startExpiryWorker starts the expiry worker if it is not running yet. The
+// caller must hold dbMutex.
+func (wal *WAL) startExpiryWorker() {
+	if wal.expiryStop != nil {
+		return
+	}
+
+	stop, done := make(chan struct{}), make(chan struct{})
+	wal.expiryStop, wal.expiryDone = stop, done
+	interval := wal.expiryInterval
+	go withLabels(context.Background(), "expiry", func(context.Context) {
+		wal.runExpiryWorker(interval, stop, done)
+	})
+}
+
+// stopExpiryWorker stops the expiry worker and waits for it to exit
+func (wal *WAL) stopExpiryWorker() {
+	wal.dbMutex.Lock()
+	stop, done := wal.expiryStop, wal.expiryDone
+	wal.expiryStop, wal.expiryDone = nil, nil
+	wal.dbMutex.Unlock()
+
+	if stop == nil {
+		return
+	}
+	close(stop)
+	<-done
+}
+
+// runExpiryWorker tombstones expired keys every interval until stop is closed
+func (wal *WAL) runExpiryWorker(interval time.Duration, stop, done chan struct{}) {
+	defer close(done)
+
+	ticker := wal.clock.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C():
+			// A failed expiry pass is retried on the next tick
+			wal.expireKeys()
+		}
+	}
+}
+
+// expireKeys logs and commits a tombstone for every expired key. It waits for
+// any open transaction to finish so tombstones never commit someone else's
+// records.
+func (wal *WAL) expireKeys() error {
+	wal.logMutex.Lock()
+	defer wal.logMutex.Unlock()
+
+	if len(wal.records) > 0 {
+		return nil
+	}
+
+	// Expiry decisions must see every committed transaction
+	wal.drainApplier()
+
+	keys := wal.expiredKeys(wal.clock.Now().UnixNano())
+	if len(keys) == 0 {
+		return nil
+	}
+
+	for _, key := range keys {
+		if err := wal.appendRecord(opExpire, encodeFields(key)); err != nil {
+			return err
+		}
+	}
+
+	_, err := wal.commitLocked(&CommitResult{})
+	return err
+}
+
+// expiredKeys returns the keys whose expiry time is not after now, in order
+func (wal *WAL) expiredKeys(now int64) []string {
+	wal.dbMutex.Lock()
+	defer wal.dbMutex.Unlock()
+
+	keys := []string{}
+	for key, expiresAt := range wal.expiries {
+		if expiresAt <= now {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	return keys
+}
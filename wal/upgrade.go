@@ -0,0 +1,43 @@
+package wal
+
+import "fmt"
+
+// UpgradeFunc rewrites a record written under an older payload schema. The
+// returned record keeps its place in the log whatever its LSN.
+type UpgradeFunc func(record LogRecord) (LogRecord, error)
+
+// WithUpgrade registers fn to upgrade records of operation as they are
+// replayed or ingested, so that payloads written by older versions of an
+// application are applied in the current schema without rewriting the log.
+// A schema version is named by the operation, e.g. "ORDER.v1"; fn may
+// return a record of a later version, which is upgraded in turn, so
+// upgrades registered for v1 and v2 take a v1 record to v3.
+func WithUpgrade(operation string, fn UpgradeFunc) Option {
+	return func(wal *WAL) {
+		if wal.upgrades == nil {
+			wal.upgrades = make(map[string]UpgradeFunc)
+		}
+		wal.upgrades[operation] = fn
+	}
+}
+
+// upgradeRecord runs the upgrades registered for a record's operation until
+// none applies
+func (wal *WAL) upgradeRecord(record LogRecord) (LogRecord, error) {
+	for steps := 0; ; steps++ {
+		fn, ok := wal.upgrades[record.Operation]
+		if !ok {
+			return record, nil
+		}
+		if steps == len(wal.upgrades) {
+			return LogRecord{}, fmt.Errorf("wal: upgrades of %q at LSN %d form a cycle", record.Operation, record.LSN)
+		}
+
+		upgraded, err := fn(record)
+		if err != nil {
+			return LogRecord{}, fmt.Errorf("wal: upgrading %q at LSN %d: %w", record.Operation, record.LSN, err)
+		}
+		upgraded.LSN, upgraded.Term, upgraded.CRC32 = record.LSN, record.Term, record.CRC32
+		record = upgraded
+	}
+}
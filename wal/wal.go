@@ -1,111 +1,521 @@
 package wal
 
 import (
+	"context"
+	"crypto/ed25519"
 	"encoding/binary"
 	"fmt"
-	"hash/crc32"
+	"math/rand"
 	"os"
 	"sync"
+	"time"
+)
+
+const (
+	opBegin  = "BEGIN TRANSACTION"
+	opCommit = "COMMIT TRANSACTION"
+	opAbort  = "ABORT TRANSACTION"
 )
 
 // LogRecord represents a single log entry
 type LogRecord struct {
 	LSN       uint64
+	Term      uint64 // caller-defined, e.g. a consensus term; zero if unset
 	Operation string
 	Data      string
 	CRC32     uint32
+
+	packed     string // Data compressed, if it is stored compressed
+	unpacked   string // the Data packed holds
+	packedDict bool   // packed starts with the ID of its dictionary
 }
 
 // WAL represents a write-ahead log
 type WAL struct {
-	Records     []LogRecord
-	File        *os.File
+	records     []LogRecord // the transaction being built with WriteRecord
+	file        *os.File
 	inMemoryDB  map[string]string // Simple in-memory database
+	dbShared    bool              // inMemoryDB is referenced by a snapshot
+	expiries    map[string]int64  // expiry time of TTL keys, in Unix nanoseconds
+	indexes     map[string]*index
+	committed   chan struct{}     // closed and replaced when committedLSN advances
 	logMutex    sync.Mutex
 	dbMutex     sync.Mutex
 	currentLSN  uint64
 	version     uint64
 	committedLSN uint64
+
+	recoveryProgress func(RecoveryProgress)
+	commitObserver   func(CommitResult)
+	profileThreshold time.Duration
+	profileDir       string
+	clock            Clock
+	mirrorNames      []string
+	mirrors          []*mirror
+	quorum           int
+	expiryInterval   time.Duration
+	expiryStop       chan struct{}
+	expiryDone       chan struct{}
+	asyncApply       bool
+	applyQueue       chan applyBatch
+	applierDone      chan struct{}
+	queuedLSN        uint64 // commit LSN of the last transaction queued for apply
+	applyErr         error  // first background apply failure
+	alignment        int64  // record alignment in bytes, zero if unaligned
+	logSize          int64  // size of the log file
+	fencing          bool
+	epoch            uint64 // epoch this WAL writes under
+	epochFile        string // empty without fencing
+	epochChecked     bool   // since the log was last synced
+	baseLSN          uint64 // LSN preceding the first record in the log
+	logVersion       uint32 // format version of the log file
+	compressAbove    int    // data size from which records are compressed; zero if never
+	dictData         []byte // as given to WithCompressionDictionary
+	dict             *dictionary // nil without a dictionary
+	blockCache       *blockCache
+	scratch          scratch
+	term             uint64 // term stamped on new records
+	batchHint        batchPosition
+	sloTarget        time.Duration
+	sloOnChange      func(degraded bool)
+	sloMutex         sync.Mutex
+	sloMet           int // consecutive commits within sloTarget while degraded
+	degraded         bool
+	heartbeatPeriod  time.Duration
+	heartbeatStop    chan struct{}
+	heartbeatDone    chan struct{}
+	snapshotCodec    SnapshotCodec
+	fileMode         os.FileMode
+	dirMode          os.FileMode
+	fileUID          int // -1 to leave unchanged
+	fileGID          int // -1 to leave unchanged
+	diskQuota        int64
+	quotaWarn        func(usage, limit int64, warning bool)
+	quotaWarned      bool
+	pendingLimit     int64 // bytes; zero for no limit
+	pendingBytes     int64 // of the open transaction's records
+	pendingWarned    bool
+	txnLimit         int // zero for no limit
+	limitWarn        func(name string, usage, limit int64, warning bool)
+	failureLimit     int // WithReadOnlyFallback failures; zero never falls back
+	writeFailures    int // failed writes and syncs of the log in a row
+	readOnlyErr      error
+	onReadOnly       func(err error)
+	snapshotSize     int64  // size of the database snapshot file
+	snapshotLSN      uint64 // end of the caller's snapshot, if checkSnapshot
+	checkSnapshot    bool
+	rewrites         uint64 // bumped when the log is truncated, rewritten or moved
+	scrubInterval    time.Duration
+	scrubReport      func(*ScrubReport, error)
+	scrubStop        chan struct{}
+	scrubDone        chan struct{}
+	upgrades         map[string]UpgradeFunc
+	hashChain        bool
+	chain            *chainState // nil without hashChain
+	signingKey       ed25519.PrivateKey
+	faults           *FaultInjector
+	faultRand        *rand.Rand
+	group            groupQueue
+	preCommitHooks   []PreCommitHook
+	postCommitHooks  []PostCommitHook
+	applying         sync.RWMutex // held while transactions are applied
+	lastWrites       map[string]uint64 // commit LSN of the last write to each key
+	writeFloor       uint64            // lastWrites covers commits after this LSN
+	remote           *remoteState      // nil without WithRemoteAppender
+	follower         bool
+	replicated       []LogRecord // records of the replicated transaction in progress
+	sessionInfo      bool
+	sessionLabels    map[string]string
+	hlc              *hybridClock // nil without WithHybridClock
+	configMutex      sync.Mutex   // serializes SetOption
+	archivedLSN      uint64       // LSN the last Backup ended at
+	watermarkFile    string
+	watermarkPeriod  time.Duration
+	watermarkStop    chan struct{}
+	watermarkDone    chan struct{}
+}
+
+// NewWAL creates a new WAL, replaying any committed transactions already in the log
+func NewWAL(filename string, opts ...Option) (*WAL, error) {
+	return NewWALContext(context.Background(), filename, opts...)
 }
 
-// NewWAL creates a new WAL
-func NewWAL(filename string) (*WAL, error) {
-	file, err := os.OpenFile(filename, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+// NewWALContext is like NewWAL but abandons replay if ctx is cancelled, in
+// which case the log file is left untouched
+func NewWALContext(ctx context.Context, filename string, opts ...Option) (*WAL, error) {
+	wal, err := newWAL(opts)
 	if err != nil {
 		return nil, err
 	}
 
-	return &WAL{
-		Records:    []LogRecord{},
-		File:       file,
+	file, err := wal.openFile(filename, os.O_APPEND|os.O_RDWR)
+	if err != nil {
+		return nil, err
+	}
+
+	return wal.open(ctx, file)
+}
+
+// NewWALFromFile is like NewWAL for a log file the caller has opened, e.g.
+// with flags of its own or on a file system it set up. f must be open for
+// reading and writing, with os.O_APPEND. The WAL takes ownership of f and
+// closes it on Close, or if opening fails. f's name locates the files kept
+// next to the log, and DropBefore, Compact and Relocate replace the log by
+// name, reopening it as NewWAL would.
+func NewWALFromFile(f *os.File, opts ...Option) (*WAL, error) {
+	wal, err := newWAL(opts)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	return wal.open(context.Background(), f)
+}
+
+// newWAL returns a WAL configured by opts, without a log
+func newWAL(opts []Option) (*WAL, error) {
+	wal := &WAL{
+		records:    []LogRecord{},
 		inMemoryDB: make(map[string]string),
+		expiries:   make(map[string]int64),
+		indexes:    make(map[string]*index),
+		committed:  make(chan struct{}),
 		currentLSN: 0,
 		version:    0,
 		committedLSN: 0,
-	}, nil
+		quorum:     1,
+		expiryInterval: defaultExpiryInterval,
+		clock:          systemClock{},
+		snapshotCodec:  BinaryCodec{},
+		fileMode:       defaultFileMode,
+		dirMode:        defaultDirMode,
+		fileUID:        -1,
+		fileGID:        -1,
+	}
+	for _, opt := range opts {
+		opt(wal)
+	}
+	if wal.quorum < 1 || wal.quorum > len(wal.mirrorNames)+1 {
+		return nil, fmt.Errorf("wal: quorum %d is impossible with %d mirrors", wal.quorum, len(wal.mirrorNames))
+	}
+	if wal.dictData != nil {
+		dict, err := registerDictionary(wal.dictData)
+		if err != nil {
+			return nil, err
+		}
+		wal.dict = dict
+	}
+
+	return wal, nil
+}
+
+// open replays the log in file and starts the WAL's workers, closing file
+// if that fails
+func (wal *WAL) open(ctx context.Context, file *os.File) (*WAL, error) {
+	if info, err := os.Stat(snapshotFile); err == nil {
+		wal.snapshotSize = info.Size()
+	}
+	wal.file = file
+
+	// Fence off earlier writers before replay touches the file
+	if wal.fencing {
+		if err := wal.acquireEpoch(file.Name()); err != nil {
+			file.Close()
+			return nil, err
+		}
+	}
+
+	// Temporary files next to the log may belong to a writer still at work
+	// on it until that writer is fenced off
+	if err := wal.removeOrphans(file.Name()); err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	if err := wal.checkLogStart(); err != nil {
+		wal.stopExpiryWorker()
+		file.Close()
+		return nil, err
+	}
+
+	var err error
+	profile := wal.startRecoveryProfile()
+	withLabels(ctx, "recovery", func(ctx context.Context) {
+		err = wal.replayLog(ctx)
+	})
+	profile.stop()
+	if err == nil {
+		err = wal.checkLogEnd()
+	}
+	if err != nil {
+		wal.stopExpiryWorker()
+		file.Close()
+		return nil, err
+	}
+
+	if err := wal.openMirrors(); err != nil {
+		wal.stopExpiryWorker()
+		file.Close()
+		return nil, err
+	}
+
+	if wal.hashChain {
+		if err := wal.anchorChain(); err != nil {
+			wal.closeMirrors()
+			wal.stopExpiryWorker()
+			file.Close()
+			return nil, err
+		}
+	}
+
+	if wal.sessionInfo && !wal.follower {
+		wal.logMutex.Lock()
+		err := wal.writeSession()
+		wal.logMutex.Unlock()
+		if err != nil {
+			wal.closeMirrors()
+			wal.stopExpiryWorker()
+			file.Close()
+			return nil, err
+		}
+	}
+
+	if wal.asyncApply {
+		wal.startApplier()
+	}
+	if wal.heartbeatPeriod > 0 {
+		wal.startHeartbeat()
+	}
+	if wal.scrubInterval > 0 {
+		wal.startScrubber()
+	}
+	if wal.remote != nil && !wal.remote.synchronous {
+		wal.startRemote()
+	}
+	if wal.watermarkFile != "" {
+		wal.startWatermarks()
+	}
+
+	return wal, nil
+}
+
+// Close waits for queued transactions to be applied, then closes the log
+// and its mirrors
+func (wal *WAL) Close() error {
+	// First, so that a commit waiting for room in the remote queue, with
+	// the log lock held, gives up and lets the other workers stop
+	wal.stopRemote()
+	wal.stopScrubber()
+	wal.stopHeartbeat()
+	applyErr := wal.stopApplier()
+	wal.stopExpiryWorker()
+	wal.stopWatermarks()
+
+	wal.logMutex.Lock()
+	defer wal.logMutex.Unlock()
+
+	mirrorErr := wal.closeMirrors()
+	if err := wal.file.Close(); err != nil {
+		return err
+	}
+	if applyErr != nil {
+		return applyErr
+	}
+	return mirrorErr
 }
 
-// WriteRecord writes a log record to the WAL
+// WriteRecord writes a log record to the WAL. The record reaches stable
+// storage when the transaction commits.
 func (wal *WAL) WriteRecord(operation, data string) error {
 	wal.logMutex.Lock()
 	defer wal.logMutex.Unlock()
 
+	return wal.appendRecord(operation, data)
+}
+
+// WriteRecordDurable writes a log record to the WAL and syncs it (and the
+// mirrors) before returning instead of waiting for the commit. As with any
+// record, replay only applies it once its transaction has committed.
+func (wal *WAL) WriteRecordDurable(operation, data string) error {
+	wal.logMutex.Lock()
+	defer wal.logMutex.Unlock()
+
+	if err := wal.appendRecord(operation, data); err != nil {
+		return err
+	}
+
+	return wal.syncLog()
+}
+
+// appendRecord adds a record to the current transaction and writes it to disk
+func (wal *WAL) appendRecord(operation, data string) error {
+	return wal.appendTermRecord(wal.term, operation, data)
+}
+
+// appendTermRecord is appendRecord for a record written in the given term
+func (wal *WAL) appendTermRecord(term uint64, operation, data string) error {
+	if wal.follower {
+		return ErrFollower
+	}
+	// A commit record, e.g. one ingested, is always written, so the
+	// transaction can be finished
+	size := frameOverhead(wal.logVersion) + len(operation) + len(data)
+	if operation != opCommit {
+		if err := wal.checkPending(size); err != nil {
+			return err
+		}
+		if err := wal.checkQuota(size); err != nil {
+			return err
+		}
+	}
+
 	lsn := wal.currentLSN + 1
 	record := LogRecord{
 		LSN:       lsn,
+		Term:      term,
 		Operation: operation,
 		Data:      data,
 	}
 
 	// Calculate CRC32
-	crc32Checksum := crc32.ChecksumIEEE([]byte(fmt.Sprintf("%d%s%s", record.LSN, record.Operation, record.Data)))
-	record.CRC32 = crc32Checksum
+	record.CRC32 = recordChecksum(record)
+	wal.compressRecord(&record)
 
-	// Write to in-memory log
-	wal.Records = append(wal.Records, record)
-	wal.currentLSN = lsn
-
-	// Write to disk
-	err := wal.writeToDisk(record)
-	if err != nil {
+	// Write to disk, then to the in-memory log, so a failed write leaves
+	// no trace
+	if err := wal.writeToDisk(record); err != nil {
 		return err
 	}
+	wal.records = append(wal.records, record)
+	wal.currentLSN = lsn
+	wal.setPending(wal.pendingBytes + int64(size))
+	if debugChecks {
+		wal.checkRecords()
+	}
 
 	return nil
 }
 
 // writeToDisk writes a log record to disk
 func (wal *WAL) writeToDisk(record LogRecord) error {
-	buf := make([]byte, 0)
-	buf = append(buf, uint64ToBytes(record.LSN)...)
-	buf = append(buf, []byte(record.Operation)...)
-	buf = append(buf, []byte(record.Data)...)
-	buf = append(buf, uint32ToBytes(record.CRC32)...)
+	return wal.writeEncoded(wal.encodeParts(record)...)
+}
+
+// writeEncoded writes an encoded record to the log, after checking that
+// this WAL may still write to it. The epoch is checked by the first write
+// after each sync, so once per commit or batch rather than per record.
+func (wal *WAL) writeEncoded(frame ...[]byte) error {
+	if wal.follower {
+		return ErrFollower
+	}
+	if !wal.epochChecked {
+		if err := wal.checkEpoch(); err != nil {
+			return err
+		}
+		wal.epochChecked = true
+	}
+
+	return wal.appendFrame(frame...)
+}
 
-	_, err := wal.File.Write(buf)
+// appendFrame writes an encoded record, which may come in parts, to the log
+// and its mirrors in one write each, preceded by padding if records are
+// aligned. The caller must hold logMutex.
+func (wal *WAL) appendFrame(frame ...[]byte) error {
+	if wal.readOnlyErr != nil {
+		return wal.readOnlyErr
+	}
+	if debugChecks {
+		wal.checkFrame(frame[0])
+	}
+	bufs := frame
+	if pad := wal.padding(frameSize(frame)); pad != nil {
+		bufs = append([][]byte{pad}, frame...)
+	}
+
+	n, err := wal.writeLog(bufs)
+	wal.noteWriteResult(err)
 	if err != nil {
+		wal.rollbackWrite(n, err)
 		return err
 	}
+	wal.logSize += int64(n)
+	if debugChecks {
+		wal.checkLogSize()
+	}
+	wal.writeMirrors(bufs)
+	if wal.chain != nil {
+		wal.chain.addFrame(frame...)
+	}
+	if wal.remote != nil {
+		wal.remote.add(wal.logVersion, frame...)
+	}
 
 	return nil
 }
 
+// rollbackWrite removes what a failed write of the log left after logSize,
+// so that the next record follows the last whole one; appending after a
+// torn frame would hide every later record from replay. If the log cannot
+// be cut back, it is made read-only until Reopen recovers it. The caller
+// must hold logMutex.
+func (wal *WAL) rollbackWrite(written int, writeErr error) {
+	if err := wal.file.Truncate(wal.logSize); err != nil {
+		wal.setReadOnly(fmt.Errorf("%w: %d bytes of a failed write (%v) could not be removed: %v", ErrReadOnly, written, writeErr, err))
+	}
+}
+
+// strandRecords makes the WAL read-only when records of a transaction that
+// failed are in the log and no abort record could be written after them:
+// the next commit would adopt them. Reopen drops them. The caller must hold
+// logMutex.
+func (wal *WAL) strandRecords(abortErr error) {
+	wal.setReadOnly(fmt.Errorf("%w: records of a failed transaction could not be aborted: %v", ErrReadOnly, abortErr))
+}
+
+// strandCommits makes the WAL read-only when commit records are in the log
+// but the sync that was to make them durable failed. They may or may not
+// survive a crash, and the database does not reflect them, so nothing may
+// be written after them until Reopen settles the matter by replaying the
+// log. The caller must hold logMutex.
+func (wal *WAL) strandCommits(syncErr error) {
+	wal.setReadOnly(fmt.Errorf("%w: commit records could not be synced: %v", ErrReadOnly, syncErr))
+}
+
+// setReadOnly refuses further writes with err, unless they already are.
+// The caller must hold logMutex.
+func (wal *WAL) setReadOnly(err error) {
+	if wal.readOnlyErr != nil {
+		return
+	}
+	wal.readOnlyErr = err
+	if wal.onReadOnly != nil {
+		wal.onReadOnly(err)
+	}
+}
+
 // applyChanges applies a log record to the in-memory database
 func (wal *WAL) applyChanges(record LogRecord) error {
 	wal.dbMutex.Lock()
 	defer wal.dbMutex.Unlock()
 
 	switch record.Operation {
-	case "BEGIN TRANSACTION":
+	case opBegin:
 		// Handle begin transaction if necessary
-	case "COMMIT TRANSACTION":
+	case opCommit:
 		// Handle commit transaction if necessary
+	case opCheck:
+		// Conditions are checked before the commit record is written
+	case opNoop, opChain, opRedacted, opOutbox, opConfig:
+		// Heartbeats, hash chain records, redaction markers, outbox
+		// messages and option changes change nothing
+	case OpPut, OpDelete, OpIncrement, OpAppend, OpCompareAndSwap, opPutTTL, opExpire:
+		wal.applyOperation(record)
 	default:
 		// Assume it's an update operation in the format "UPDATE table SET column=value WHERE condition"
 		// For simplicity, we handle a single update operation
-		fmt.Printf("Applying change to DB: %s\n", record.Data)
 		// This example doesn't parse the SQL, just a simplified update
-		wal.inMemoryDB["balance"] = record.Data
+		wal.setKey("balance", record.Data)
 	}
 
 	wal.version++
@@ -113,25 +523,30 @@ func (wal *WAL) applyChanges(record LogRecord) error {
 	return nil
 }
 
-// flushDB flushes the in-memory database to disk
-func (wal *WAL) flushDB() error {
+// flushDB flushes the in-memory database to disk, recording that it
+// reflects every transaction up to lsn
+func (wal *WAL) flushDB(lsn uint64) error {
 	wal.dbMutex.Lock()
 	defer wal.dbMutex.Unlock()
 
-	file, err := os.Create("database_state")
+	file, err := wal.openFile(snapshotFile, os.O_WRONLY|os.O_TRUNC)
 	if err != nil {
 		return err
 	}
 	defer file.Close()
 
-	for key, value := range wal.inMemoryDB {
-		_, err := file.WriteString(fmt.Sprintf("%s=%s\n", key, value))
-		if err != nil {
-			return err
-		}
+	if err := wal.snapshotCodec.Encode(file, wal.inMemoryDB); err != nil {
+		return err
+	}
+	if info, err := file.Stat(); err == nil {
+		wal.snapshotSize = info.Size()
 	}
 
-	wal.committedLSN = wal.currentLSN
+	wal.committedLSN = lsn
+
+	// Wake up WaitForLSN callers
+	close(wal.committed)
+	wal.committed = make(chan struct{})
 
 	return nil
 }
@@ -149,6 +564,24 @@ func (wal *WAL) ReadDB() map[string]string {
 	return result
 }
 
+// Filename returns the name of the log file. It changes when the log is
+// relocated.
+func (wal *WAL) Filename() string {
+	wal.logMutex.Lock()
+	defer wal.logMutex.Unlock()
+
+	return wal.file.Name()
+}
+
+// PendingRecords returns a copy of the records written with WriteRecord, or
+// Put and friends, that are waiting for Commit
+func (wal *WAL) PendingRecords() []LogRecord {
+	wal.logMutex.Lock()
+	defer wal.logMutex.Unlock()
+
+	return append([]LogRecord(nil), wal.records...)
+}
+
 // uint64ToBytes converts a uint64 to a byte slice
 func uint64ToBytes(num uint64) []byte {
 	buf := make([]byte, 8)
@@ -165,44 +598,148 @@ func uint32ToBytes(num uint32) []byte {
 
 // commitTransaction commits the current transaction and flushes changes to the database
 func (wal *WAL) CommitTransaction() error {
+	_, err := wal.Commit()
+	return err
+}
+
+// Commit commits the current transaction like CommitTransaction and returns
+// the LSN of its commit record. Passing that LSN to WaitForLSN or
+// ReadAtLeast gives read-your-writes consistency.
+func (wal *WAL) Commit() (uint64, error) {
+	start := wal.clock.Now()
 	wal.logMutex.Lock()
-	defer wal.logMutex.Unlock()
+	result := CommitResult{Queue: wal.clock.Now().Sub(start)}
+	var records []LogRecord
+	err := wal.runPreCommitHooks(wal.records)
+	if err != nil {
+		if abortErr := wal.abortTransaction(); abortErr != nil {
+			err = abortErr
+		}
+	} else {
+		records, err = wal.commitLocked(&result)
+	}
+	hooks := wal.postCommitHooks
+	wal.logMutex.Unlock()
+
+	wal.observeCommit(result, err)
+	if err != nil {
+		return 0, err
+	}
+	runPostCommitHooks(hooks, result.LSN, records)
+	return result.LSN, nil
+}
+
+// commitLocked commits the current transaction, recording the time spent in
+// each phase in result, and returns its records. The caller must hold
+// logMutex.
+func (wal *WAL) commitLocked(result *CommitResult) ([]LogRecord, error) {
+	// Surface failures of transactions applied in the background
+	if err := wal.asyncApplyError(); err != nil {
+		return nil, err
+	}
+
+	// Validate CompareAndSet conditions under the write lock
+	if err := wal.checkConditions(); err != nil {
+		if abortErr := wal.abortTransaction(); abortErr != nil {
+			return nil, abortErr
+		}
+		return nil, err
+	}
+
+	// Vouch for the transaction in the hash chain
+	if wal.chain != nil {
+		if err := wal.writeChain(); err != nil {
+			return nil, err
+		}
+	}
 
 	// Create a commit log record
+	phase := wal.clock.Now()
 	commitRecord := LogRecord{
 		LSN:       wal.currentLSN + 1,
-		Operation: "COMMIT TRANSACTION",
+		Term:      wal.term,
+		Operation: opCommit,
 		Data:      "",
 		CRC32:     0, // CRC32 will be calculated below
 	}
 
 	// Calculate CRC32
-	commitRecord.CRC32 = crc32.ChecksumIEEE([]byte(fmt.Sprintf("%d%s%s", commitRecord.LSN, commitRecord.Operation, commitRecord.Data)))
-
-	// Write to in-memory log
-	wal.Records = append(wal.Records, commitRecord)
+	commitRecord.CRC32 = recordChecksum(commitRecord)
+	frame := wal.encodeParts(commitRecord)
+	result.Encode = wal.clock.Now().Sub(phase)
+
+	// Write to disk, then to the in-memory log; a failed write leaves the
+	// transaction open, to be committed again or aborted. The transaction
+	// may have been open a while, so the epoch is checked again.
+	phase = wal.clock.Now()
+	wal.epochChecked = false
+	if err := wal.writeEncoded(frame...); err != nil {
+		return nil, err
+	}
+	wal.records = append(wal.records, commitRecord)
 	wal.currentLSN = commitRecord.LSN
+	result.LSN = commitRecord.LSN
+	result.Records = len(wal.records)
+	wal.noteWrites(wal.records, commitRecord.LSN)
+	result.Write = wal.clock.Now().Sub(phase)
+
+	// Make the transaction durable before applying it. The commit record
+	// is past taking back, so if that fails the log decides its fate, and
+	// the transaction can no longer be aborted
+	phase = wal.clock.Now()
+	if err := wal.syncLog(); err != nil {
+		wal.strandCommits(err)
+		return nil, err
+	}
+	result.Sync = wal.clock.Now().Sub(phase)
+
+	// Apply all changes, or leave that to the background applier
+	phase = wal.clock.Now()
+	if wal.applyQueue != nil {
+		wal.applyQueue <- applyBatch{records: wal.records, lsn: commitRecord.LSN}
+		wal.queuedLSN = commitRecord.LSN
+	} else if err := wal.applyTransaction(wal.records, commitRecord.LSN); err != nil {
+		return nil, err
+	}
+	result.Apply = wal.clock.Now().Sub(phase)
 
-	// Write to disk
-	err := wal.writeToDisk(commitRecord)
-	if err != nil {
-		return err
+	// Clear the log
+	records := wal.records
+	wal.records = []LogRecord{}
+	wal.setPending(0)
+
+	return records, nil
+}
+
+// AbortTransaction discards the current transaction. An abort record is
+// logged so replay skips the transaction's records.
+func (wal *WAL) AbortTransaction() error {
+	wal.logMutex.Lock()
+	defer wal.logMutex.Unlock()
+
+	return wal.abortTransaction()
+}
+
+// abortTransaction logs an abort record and clears the pending records.
+// The caller must hold logMutex.
+func (wal *WAL) abortTransaction() error {
+	if len(wal.records) == 0 {
+		return nil
 	}
 
-	// Apply all changes to the in-memory database
-	for _, record := range wal.Records {
-		if err := wal.applyChanges(record); err != nil {
-			return err
-		}
+	abortRecord := LogRecord{
+		LSN:       wal.currentLSN + 1,
+		Term:      wal.term,
+		Operation: opAbort,
 	}
+	abortRecord.CRC32 = recordChecksum(abortRecord)
 
-	// Flush the in-memory database state to disk
-	if err := wal.flushDB(); err != nil {
+	if err := wal.writeToDisk(abortRecord); err != nil {
 		return err
 	}
+	wal.currentLSN = abortRecord.LSN
+	wal.records = []LogRecord{}
+	wal.setPending(0)
 
-	// Clear the log
-	wal.Records = []LogRecord{}
-
-	return nil
-}
\ No newline at end of file
+	return wal.syncLog()
+}
@@ -0,0 +1,15 @@
+package wal
+
+// vectoredMin is the stored data size from which a record's data is written
+// from where it is, with its frame around it in one vectored write, rather
+// than copied into the frame first
+const vectoredMin = 32 << 10
+
+// frameSize is the size of a frame written in parts
+func frameSize(parts [][]byte) int {
+	n := 0
+	for _, part := range parts {
+		n += len(part)
+	}
+	return n
+}
@@ -0,0 +1,70 @@
+package wal
+
+import (
+	"io"
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+// writeVectored writes bufs to file in order with writev, so that they need
+// not be copied into one buffer first, and returns the number of bytes
+// written
+func writeVectored(file *os.File, bufs [][]byte) (int, error) {
+	if len(bufs) == 1 {
+		return file.Write(bufs[0])
+	}
+	conn, err := file.SyscallConn()
+	if err != nil {
+		return 0, err
+	}
+
+	bufs = append([][]byte(nil), bufs...)
+	iovecs := make([]syscall.Iovec, 0, len(bufs))
+	total := 0
+	for len(bufs) > 0 {
+		iovecs = iovecs[:0]
+		for _, buf := range bufs {
+			if len(buf) == 0 {
+				continue
+			}
+			iovec := syscall.Iovec{Base: &buf[0]}
+			iovec.SetLen(len(buf))
+			iovecs = append(iovecs, iovec)
+		}
+		if len(iovecs) == 0 {
+			break
+		}
+
+		var n uintptr
+		var errno syscall.Errno
+		err := conn.Write(func(fd uintptr) bool {
+			n, _, errno = syscall.Syscall(syscall.SYS_WRITEV, fd, uintptr(unsafe.Pointer(&iovecs[0])), uintptr(len(iovecs)))
+			return true
+		})
+		if err != nil {
+			return total, err
+		}
+		if errno == syscall.EINTR {
+			continue
+		}
+		if errno != 0 {
+			return total, &os.PathError{Op: "writev", Path: file.Name(), Err: errno}
+		}
+		if n == 0 {
+			return total, io.ErrShortWrite
+		}
+
+		// Carry on after what a short write did not get to
+		total += int(n)
+		left := int(n)
+		for len(bufs) > 0 && left >= len(bufs[0]) {
+			left -= len(bufs[0])
+			bufs = bufs[1:]
+		}
+		if left > 0 {
+			bufs[0] = bufs[0][left:]
+		}
+	}
+	return total, nil
+}
@@ -0,0 +1,17 @@
+//go:build !linux
+
+package wal
+
+import (
+	"bytes"
+	"os"
+)
+
+// writeVectored writes bufs to file in order. Without writev they are
+// copied into one buffer, so the log sees a single write.
+func writeVectored(file *os.File, bufs [][]byte) (int, error) {
+	if len(bufs) == 1 {
+		return file.Write(bufs[0])
+	}
+	return file.Write(bytes.Join(bufs, nil))
+}